@@ -0,0 +1,203 @@
+// Package admin is an HTTP API for inspecting a running proxy.  It reports the
+// effective config and its version, shows which `match` clause a request
+// would hit and previews the redaction of sample requests, so rules can be
+// checked against a live deployment without sending it real traffic.
+package admin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/button/privacy-proxy/redactor"
+)
+
+// DefaultAddress is where the admin API listens if the config doesn't say.
+// It's only reachable locally by default, since it reveals the config.
+const DefaultAddress = "127.0.0.1:8889"
+
+// The largest sample body that may be previewed.
+const maxPreviewSize = 4 * 1024 * 1024
+
+// State describes the rules a proxy is running.
+type State struct {
+	Redactor *redactor.Redactor
+
+	// Version is the control plane version of the config, or 0 if it's the
+	// local config.
+	Version  int
+	LoadedAt time.Time
+}
+
+// VersionInfo is the response of `GET /version`.
+type VersionInfo struct {
+	Version  int       `json:"version"`
+	Hash     string    `json:"hash"`
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+// MatchInfo is the response of `GET /match`.  Index is the position of the
+// matching clause among the config's HTTP match clauses, or -1 if none match
+// (and everything is redacted).
+type MatchInfo struct {
+	Index int                 `json:"index"`
+	Match *redactor.HTTPMatch `json:"match"`
+}
+
+// Preview is the response of `POST /preview`.
+type Preview struct {
+	Index       int                 `json:"index"`
+	Path        string              `json:"path"`
+	Querystring string              `json:"querystring"`
+	Headers     map[string][]string `json:"headers"`
+	Body        string              `json:"body"`
+	Error       string              `json:"error,omitempty"`
+}
+
+// Handler serves the admin API:
+//
+//   - `GET /config`:  the effective config as JSON.
+//   - `GET /version`:  the config's version, hash and load time.
+//   - `GET /match?method=&path=`:  the HTTP match clause a request would hit.
+//   - `POST /preview?method=&path=&query=`:  the posted body, and headers and
+//     querystring, redacted as a request to `path` would be.  The body's
+//     Content-Type selects the document type as it would when proxying.
+//     `tokenize` rules issue tokens that aren't stored in the vault.
+type Handler struct {
+	state func() State
+	token string
+	mux   *http.ServeMux
+}
+
+// NewHandler returns a Handler for the state returned by `state`, which is
+// called on every request so that reloaded rules are reported.  If `token` is
+// set, requests must send it as a bearer token.
+func NewHandler(state func() State, token string) *Handler {
+	h := &Handler{state: state, token: token, mux: http.NewServeMux()}
+
+	h.mux.HandleFunc("/config", allow(http.MethodGet, h.getConfig))
+	h.mux.HandleFunc("/version", allow(http.MethodGet, h.getVersion))
+	h.mux.HandleFunc("/match", allow(http.MethodGet, h.getMatch))
+	h.mux.HandleFunc("/preview", allow(http.MethodPost, h.preview))
+
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.token != "" {
+		expected := "Bearer " + h.token
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	h.mux.ServeHTTP(w, r)
+}
+
+// Wraps a handler so it only serves `method`, responding 405 to the rest.
+func allow(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// Hash returns the hex SHA-256 of a config's JSON encoding, which identifies
+// the effective rules regardless of how the config was formatted.
+func Hash(config redactor.Config) string {
+	data, _ := json.Marshal(config)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (h *Handler) getConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, h.state().Redactor.Config())
+}
+
+func (h *Handler) getVersion(w http.ResponseWriter, r *http.Request) {
+	state := h.state()
+
+	writeJSON(w, VersionInfo{
+		Version:  state.Version,
+		Hash:     Hash(state.Redactor.Config()),
+		LoadedAt: state.LoadedAt,
+	})
+}
+
+func (h *Handler) getMatch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	config := h.state().Redactor.Config()
+
+	pathname := (&url.URL{Path: query.Get("path")}).EscapedPath()
+
+	info := MatchInfo{Index: config.FindHTTPMatchIndex(query.Get("method"), pathname)}
+	if info.Index >= 0 {
+		info.Match = &config.Match.HTTP[info.Index]
+	}
+
+	writeJSON(w, info)
+}
+
+func (h *Handler) preview(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	config := h.state().Redactor.Config()
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPreviewSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Build the request as the proxy would receive it, minus our own
+	// querystring and credentials.
+	sample, err := http.NewRequest(query.Get("method"), (&url.URL{Path: query.Get("path"), RawQuery: query.Get("query")}).String(), bytes.NewReader(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sample.Header = r.Header.Clone()
+	sample.Header.Del("Authorization")
+
+	index := config.FindHTTPMatchIndex(sample.Method, sample.URL.EscapedPath())
+	// Tokens are issued from a vault of the preview's own, so samples aren't
+	// stored in the config's.
+	match := config.FindHTTPMatch(sample.Method, sample.URL.EscapedPath()).WithVault(redactor.NewMemoryVault())
+
+	preview := Preview{Index: index}
+
+	err = redactor.RedactRequest(match, sample)
+	if err != nil {
+		preview.Error = err.Error()
+	}
+
+	redacted, err := ioutil.ReadAll(sample.Body)
+	if err != nil {
+		log.Println(err)
+	}
+
+	preview.Path = sample.URL.Path
+	preview.Querystring = sample.URL.RawQuery
+	preview.Headers = sample.Header
+	preview.Body = string(redacted)
+
+	writeJSON(w, preview)
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,241 @@
+package admin
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/button/privacy-proxy/redactor"
+	"github.com/stretchr/testify/assert"
+)
+
+var loadedAt = time.Date(2018, 1, 29, 0, 0, 0, 0, time.UTC)
+
+func makeHandler(token string) *Handler {
+	config := redactor.Config{
+		ProxyPass: "http://upstream",
+		Admin:     &redactor.AdminOptions{Token: token},
+		Match: redactor.MatchOptions{
+			HTTP: []redactor.HTTPMatch{
+				redactor.HTTPMatch{
+					Path:   "/users",
+					Method: "POST",
+					RuleOptions: redactor.RuleOptions{
+						Body:        []redactor.ConfigRule{redactor.ConfigRule{Whitelist: "$.id"}},
+						Querystring: []redactor.ConfigRule{redactor.ConfigRule{Whitelist: "page"}},
+					},
+				},
+			},
+		},
+	}
+
+	compiled := redactor.MustCompile(config)
+
+	return NewHandler(func() State {
+		return State{Redactor: compiled, Version: 3, LoadedAt: loadedAt}
+	}, token)
+}
+
+func serveRequest(handler *Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestAuthorization(t *testing.T) {
+	handler := makeHandler("secret")
+
+	w := serveRequest(handler, httptest.NewRequest("GET", "/version", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	r := httptest.NewRequest("GET", "/version", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w = serveRequest(handler, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestGetConfig(t *testing.T) {
+	handler := makeHandler("secret")
+
+	r := httptest.NewRequest("GET", "/config", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w := serveRequest(handler, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"match": {
+			"http": [{
+				"path": "/users",
+				"method": "POST",
+				"rule": {
+					"body": [{"whitelist": "$.id"}],
+					"querystring": [{"whitelist": "page"}]
+				}
+			}]
+		},
+		"proxy_pass": "http://upstream",
+		"admin": {}
+	}`, w.Body.String())
+}
+
+func TestGetVersion(t *testing.T) {
+	handler := makeHandler("")
+
+	w := serveRequest(handler, httptest.NewRequest("GET", "/version", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	info := VersionInfo{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(t, 3, info.Version)
+	assert.Equal(t, loadedAt, info.LoadedAt)
+	assert.Equal(t, Hash(handler.state().Redactor.Config()), info.Hash)
+	assert.Equal(t, 64, len(info.Hash))
+
+	w = serveRequest(handler, httptest.NewRequest("POST", "/version", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET", w.Header().Get("Allow"))
+}
+
+func TestHash(t *testing.T) {
+	a := redactor.Config{Port: "8080"}
+	b := redactor.Config{Port: "9090"}
+
+	assert.Equal(t, Hash(a), Hash(redactor.Config{Port: "8080"}))
+	assert.NotEqual(t, Hash(a), Hash(b))
+}
+
+func TestGetMatch(t *testing.T) {
+	handler := makeHandler("")
+
+	type testCase struct {
+		name   string
+		target string
+		out    string
+	}
+
+	cases := []testCase{
+		{
+			name:   "with a match",
+			target: "/match?method=post&path=/users",
+			out:    `{"index": 0, "match": {"path": "/users", "method": "POST", "rule": {"body": [{"whitelist": "$.id"}], "querystring": [{"whitelist": "page"}]}}}`,
+		},
+		{
+			name:   "with no match",
+			target: "/match?method=GET&path=/users",
+			out:    `{"index": -1, "match": null}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := serveRequest(handler, httptest.NewRequest("GET", c.target, nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.JSONEq(t, c.out, w.Body.String())
+		})
+	}
+}
+
+func TestPreviewWithVault(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "vault.key")
+	assert.Nil(t, ioutil.WriteFile(keyFile, []byte(strings.Repeat("ab", 32)), 0600))
+
+	options := redactor.VaultOptions{Path: filepath.Join(dir, "vault.db"), KeyFile: keyFile}
+	compiled := redactor.MustCompile(redactor.Config{
+		Vault: &options,
+		Match: redactor.MatchOptions{HTTP: []redactor.HTTPMatch{
+			redactor.HTTPMatch{RuleOptions: redactor.RuleOptions{
+				Body: []redactor.ConfigRule{redactor.ConfigRule{Whitelist: "$.email", Action: "tokenize"}},
+			}},
+		}},
+	})
+	handler := NewHandler(func() State { return State{Redactor: compiled} }, "")
+
+	r := httptest.NewRequest("POST", "/preview?method=POST&path=/users", strings.NewReader(`{"email": "a@b.c"}`))
+	r.Header.Set("Content-Type", "application/json")
+
+	w := serveRequest(handler, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	preview := Preview{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &preview))
+	assert.Contains(t, preview.Body, `"email":"tok_`)
+
+	data, err := ioutil.ReadFile(options.Path)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(data))
+}
+
+func TestPreview(t *testing.T) {
+	handler := makeHandler("")
+
+	type testCase struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		out         Preview
+	}
+
+	cases := []testCase{
+		{
+			name:        "with a match",
+			target:      "/preview?method=POST&path=/users&query=page%3D2%26email%3Da%40b.c",
+			contentType: "application/json",
+			body:        `{"id": 1, "email": "a@b.c"}`,
+			out: Preview{
+				Index:       0,
+				Path:        "/users",
+				Querystring: "page=2&email=REDACTED",
+				Headers:     map[string][]string{"Content-Type": []string{"application/json"}, "Content-Length": []string{"27"}},
+				Body:        `{"email":"REDACTED","id":1}`,
+			},
+		},
+		{
+			name:        "with no match",
+			target:      "/preview?method=PUT&path=/users",
+			contentType: "application/json",
+			body:        `{"id": 1}`,
+			out: Preview{
+				Index:       -1,
+				Path:        "/users",
+				Querystring: "",
+				Headers:     map[string][]string{"Content-Type": []string{"application/json"}, "Content-Length": []string{"8"}},
+				Body:        `{"id":0}`,
+			},
+		},
+		{
+			name:        "with an unparseable body",
+			target:      "/preview?method=POST&path=/users",
+			contentType: "application/json",
+			body:        `{"id":`,
+			out: Preview{
+				Index:       0,
+				Path:        "/users",
+				Querystring: "",
+				Headers:     map[string][]string{"Content-Type": []string{"application/json"}, "Content-Length": []string{"0"}},
+				Body:        "",
+				Error:       "unexpected end of JSON input",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", c.target, strings.NewReader(c.body))
+			r.Header.Set("Content-Type", c.contentType)
+
+			w := serveRequest(handler, r)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			preview := Preview{}
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &preview))
+			assert.Equal(t, c.out, preview)
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/button/privacy-proxy/redactor"
+)
+
+// Decrypts the envelopes in a JSON document, returning it re-encoded.  Any
+// other values are left as they are.
+func decryptJSON(keyring *redactor.Keyring, data []byte) ([]byte, error) {
+	var parsed interface{}
+	err := json.Unmarshal(data, &parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted, err := keyring.DecryptDocument(parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(decrypted)
+}
+
+// Runs the `decrypt` subcommand, which decrypts the values replaced by
+// `encrypt` rules in each JSON file (or stdin, if there are none).
+func runDecrypt(keyring *redactor.Keyring, lines bool, files []string, out io.Writer) error {
+	decrypt := func(data []byte) ([]byte, error) {
+		return decryptJSON(keyring, data)
+	}
+
+	return transformFiles(decrypt, lines, files, out)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/button/privacy-proxy/redactor"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeKeyring(t *testing.T) *redactor.Keyring {
+	keyring, err := redactor.ParseKeyring([]byte("k1 " + strings.Repeat("ab", 32)))
+	assert.Nil(t, err)
+	return keyring
+}
+
+func TestDecryptJSON(t *testing.T) {
+	keyring := makeKeyring(t)
+	envelope, err := keyring.Encrypt("bloop")
+	assert.Nil(t, err)
+
+	decrypted, err := decryptJSON(keyring, []byte(`{"a": "`+envelope+`", "b": 10}`))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a":"bloop","b":10}`, string(decrypted))
+
+	t.Log("Running with an envelope from another keyring")
+	other, err := redactor.ParseKeyring([]byte("k2 " + strings.Repeat("cd", 32)))
+	assert.Nil(t, err)
+	envelope, _ = other.Encrypt("bloop")
+	_, err = decryptJSON(keyring, []byte(`{"a": "`+envelope+`"}`))
+	assert.NotNil(t, err)
+
+	t.Log("Running with text that isn't an envelope")
+	decrypted, err = decryptJSON(keyring, []byte(`{"a": "enc:k1:not base64"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a":"enc:k1:not base64"}`, string(decrypted))
+
+	t.Log("Running with invalid JSON")
+	_, err = decryptJSON(keyring, []byte(`{`))
+	assert.NotNil(t, err)
+}
+
+func TestRunDecrypt(t *testing.T) {
+	keyring := makeKeyring(t)
+	envelope, err := keyring.Encrypt(1.0)
+	assert.Nil(t, err)
+
+	file := filepath.Join(t.TempDir(), "encrypted.json")
+	ioutil.WriteFile(file, []byte(`{"a": "`+envelope+`"}`+"\n\n{\"a\": 2}\n"), 0600)
+
+	out := &bytes.Buffer{}
+	err = runDecrypt(keyring, true, []string{file}, out)
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"a\":1}\n\n{\"a\":2}\n", out.String())
+
+	t.Log("Running with an invalid line")
+	ioutil.WriteFile(file, []byte("{\"a\": 1}\n{\n"), 0600)
+	err = runDecrypt(keyring, true, []string{file}, &bytes.Buffer{})
+	assert.EqualError(t, err, file+": line 2: unexpected end of JSON input")
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/button/privacy-proxy/redactor"
+)
+
+// Options for the `redact` subcommand, which runs the same redaction the
+// proxy performs against documents on disk or stdin.
+type redactOptions struct {
+	Method      string
+	Path        string
+	ContentType string
+	Query       string
+	Lines       bool
+}
+
+// Runs the `redact` subcommand.  The match clause is selected from the config
+// by method and path exactly as the proxy would for an incoming request.  If
+// a querystring is given, only it is redacted; otherwise each file (or stdin,
+// if there are none) is redacted as a request body.
+func runRedact(compiled *redactor.Redactor, options redactOptions, files []string, out io.Writer) error {
+	match := compiled.Match(options.Method, options.Path)
+
+	if options.Query != "" {
+		query := redactor.RedactQuerystring(match, &url.URL{RawQuery: options.Query})
+		_, err := fmt.Fprintln(out, query)
+		return err
+	}
+
+	redact := func(body []byte) ([]byte, error) {
+		return redactor.MapBody(match, options.ContentType, body)
+	}
+
+	return transformFiles(redact, options.Lines, files, out)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/button/privacy-proxy/redactor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunRedact(t *testing.T) {
+	config := redactor.Config{
+		Match: redactor.MatchOptions{
+			HTTP: []redactor.HTTPMatch{
+				redactor.HTTPMatch{
+					Path:   "/post",
+					Method: "POST",
+					RuleOptions: redactor.RuleOptions{
+						Body:        []redactor.ConfigRule{redactor.ConfigRule{Whitelist: "$.a"}},
+						Querystring: []redactor.ConfigRule{redactor.ConfigRule{Whitelist: "a"}},
+					},
+				},
+			},
+		},
+	}
+
+	compiled, err := redactor.Compile(config)
+	assert.Nil(t, err)
+
+	file, err := ioutil.TempFile("", "privacy-proxy")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+
+	file.WriteString(`{"a": "data", "b": "data"}`)
+	file.Close()
+
+	type testCase struct {
+		name    string
+		options redactOptions
+		out     string
+	}
+
+	cases := []testCase{
+		{
+			name:    "with a matching clause",
+			options: redactOptions{Method: "POST", Path: "/post", ContentType: redactor.JSON},
+			out:     "{\"a\":\"data\",\"b\":\"REDACTED\"}\n",
+		},
+		{
+			name:    "with no matching clause",
+			options: redactOptions{Method: "GET", Path: "/post", ContentType: redactor.JSON},
+			out:     "{\"a\":\"REDACTED\",\"b\":\"REDACTED\"}\n",
+		},
+		{
+			name:    "with an unsupported content-type",
+			options: redactOptions{Method: "POST", Path: "/post", ContentType: "text/plain"},
+			out:     "\n",
+		},
+		{
+			name:    "with lines",
+			options: redactOptions{Method: "POST", Path: "/post", ContentType: redactor.JSON, Lines: true},
+			out:     "{\"a\":\"data\",\"b\":\"REDACTED\"}\n",
+		},
+		{
+			name:    "with a querystring",
+			options: redactOptions{Method: "POST", Path: "/post", Query: "a=1&b=2"},
+			out:     "a=1&b=REDACTED\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			err := runRedact(compiled, c.options, []string{file.Name()}, out)
+			assert.Nil(t, err)
+			assert.Equal(t, c.out, out.String())
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// The largest single line we'll accept when reading JSON-lines input.
+const maxLineSize = 16 * 1024 * 1024
+
+// Transforms a single document, as the `redact` and `decrypt` subcommands
+// redact or decrypt them.
+type transform func(document []byte) ([]byte, error)
+
+// Transforms a single document read from `in`, writing the result to `out`
+// followed by a newline.
+func transformDocument(fn transform, in io.Reader, out io.Writer) error {
+	body, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	transformed, err := fn(body)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(out, "%s\n", transformed)
+	return err
+}
+
+// Transforms a stream of documents from `in`, one per line, writing each
+// result to `out` on its own line.  Blank lines are passed through so line
+// numbers in the output correspond to the input.
+func transformLines(fn transform, in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			if _, err := fmt.Fprintln(out); err != nil {
+				return err
+			}
+			continue
+		}
+
+		transformed, err := fn(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+
+		if _, err := fmt.Fprintf(out, "%s\n", transformed); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Transforms each file (or stdin, if there are none) as a single document
+// or, if `lines` is set, as one document per line, writing the results to
+// `out`.  Errors name the file they occurred in.
+func transformFiles(fn transform, lines bool, files []string, out io.Writer) error {
+	transformInput := transformDocument
+	if lines {
+		transformInput = transformLines
+	}
+
+	if len(files) == 0 {
+		return transformInput(fn, os.Stdin, out)
+	}
+
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+
+		err = transformInput(fn, f, out)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/button/privacy-proxy/redactor"
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns a transform redacting JSON documents against body rules.
+func redactJSONWith(rules ...redactor.ConfigRule) transform {
+	return func(body []byte) ([]byte, error) {
+		return redactor.MapBody(makeBodyMatch(rules...), redactor.JSON, body)
+	}
+}
+
+func TestTransformDocument(t *testing.T) {
+	out := &bytes.Buffer{}
+	in := strings.NewReader(`{"a": "bloop", "b": 10}`)
+
+	err := transformDocument(redactJSONWith(redactor.ConfigRule{Whitelist: "$.a"}), in, out)
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"a\":\"bloop\",\"b\":0}\n", out.String())
+}
+
+func TestTransformLines(t *testing.T) {
+	type testCase struct {
+		name string
+		in   string
+		out  string
+		err  string
+	}
+
+	cases := []testCase{
+		{
+			name: "with no lines",
+			in:   "",
+			out:  "",
+		},
+		{
+			name: "with one document per line",
+			in:   "{\"a\": 1, \"b\": 2}\n{\"a\": 3}\n",
+			out:  "{\"a\":1,\"b\":0}\n{\"a\":3}\n",
+		},
+		{
+			name: "with blank lines",
+			in:   "{\"a\": 1}\n\n{\"b\": 2}",
+			out:  "{\"a\":1}\n\n{\"b\":0}\n",
+		},
+		{
+			name: "with an invalid line",
+			in:   "{\"a\": 1}\n{nope}\n",
+			out:  "{\"a\":1}\n",
+			err:  "line 2:",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			err := transformLines(redactJSONWith(redactor.ConfigRule{Whitelist: "$.a"}), strings.NewReader(c.in), out)
+
+			if c.err == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.Contains(t, err.Error(), c.err)
+			}
+			assert.Equal(t, c.out, out.String())
+		})
+	}
+}
+
+func TestTransformFiles(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.json")
+	second := filepath.Join(dir, "second.json")
+	ioutil.WriteFile(first, []byte("{\"a\": 1}\n{\"a\": 2}\n"), 0600)
+	ioutil.WriteFile(second, []byte("{\"a\": 3}\n{nope}\n"), 0600)
+
+	upper := func(document []byte) ([]byte, error) {
+		if bytes.Contains(document, []byte("nope")) {
+			return nil, fmt.Errorf("invalid document")
+		}
+		return bytes.ToUpper(document), nil
+	}
+
+	out := &bytes.Buffer{}
+	err := transformFiles(upper, true, []string{first}, out)
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"A\": 1}\n{\"A\": 2}\n", out.String())
+
+	out = &bytes.Buffer{}
+	err = transformFiles(upper, false, []string{first}, out)
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"A\": 1}\n{\"A\": 2}\n\n", out.String())
+
+	t.Log("Running with an invalid line")
+	err = transformFiles(upper, true, []string{first, second}, &bytes.Buffer{})
+	assert.EqualError(t, err, second+": line 2: invalid document")
+
+	t.Log("Running with a missing file")
+	err = transformFiles(upper, true, []string{filepath.Join(dir, "missing.json")}, &bytes.Buffer{})
+	assert.NotNil(t, err)
+}
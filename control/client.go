@@ -0,0 +1,283 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/button/privacy-proxy/redactor"
+)
+
+// The default time between polls, and the longest a long-poll is held open.
+const defaultPollInterval = 30 * time.Second
+
+// Client keeps a proxy's rules in sync with a control plane.  Until the first
+// version is applied, the rules of the proxy's local config are used.
+//
+// Only the `match` clauses, `grpc_descriptor_sets`, `leaf_only` and
+// `content_types` of a published config are applied; the port, upstream,
+// control options and secrets always come from the local config.  Rules are
+// leaf-only by default if either config says so.
+type Client struct {
+	local    redactor.Config
+	options  redactor.ControlOptions
+	key      ed25519.PublicKey
+	interval time.Duration
+	client   *http.Client
+	current  atomic.Pointer[redactor.Redactor]
+
+	mu       sync.Mutex
+	version  int
+	loadedAt time.Time
+	err      error
+}
+
+// NewClient returns a Client for a config with a `control` block.
+func NewClient(config redactor.Config) (*Client, error) {
+	if config.Control == nil || config.Control.URL == "" {
+		return nil, fmt.Errorf("control: config has no control url")
+	}
+
+	options := *config.Control
+
+	key, err := LoadPublicKey(options.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := defaultPollInterval
+	if options.PollInterval != "" {
+		interval, err = time.ParseDuration(options.PollInterval)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if options.ProxyID == "" {
+		options.ProxyID, _ = os.Hostname()
+	}
+
+	compiled, err := redactor.Compile(config)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		local:    config,
+		options:  options,
+		key:      key,
+		interval: interval,
+		client:   http.DefaultClient,
+		loadedAt: time.Now(),
+	}
+	c.current.Store(compiled)
+
+	return c, nil
+}
+
+// Redactor returns the redactor for the active version.  It's safe to call
+// while the client is running.
+func (c *Client) Redactor() *redactor.Redactor {
+	return c.current.Load()
+}
+
+// Version returns the active version, or 0 if the local config is active.
+func (c *Client) Version() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.version
+}
+
+// LoadedAt returns when the active version was applied.
+func (c *Client) LoadedAt() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.loadedAt
+}
+
+// Run polls the control plane and reports status until the context is done.
+// Errors are logged and reported, and the client keeps polling.
+func (c *Client) Run(ctx context.Context) error {
+	for {
+		_, err := c.Poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Println(err)
+		}
+
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+
+		err = c.Report(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Println(err)
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// A long-poll already waited, unless it failed.
+		if c.options.LongPoll && c.Healthy() {
+			continue
+		}
+
+		select {
+		case <-time.After(c.interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Healthy returns true iff the last poll succeeded.
+func (c *Client) Healthy() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err == nil
+}
+
+// Poll fetches the latest version from the control plane and applies it if
+// it's new, returning true iff it was applied.  A version that isn't signed
+// by the control plane's key, or that doesn't compile, is rejected and the
+// active rules are kept.
+func (c *Client) Poll(ctx context.Context) (bool, error) {
+	query := url.Values{}
+	query.Set("version", strconv.Itoa(c.Version()))
+
+	timeout := c.interval
+	if c.options.LongPoll {
+		query.Set("wait", c.interval.String())
+
+		// Leave the server time to respond once the wait is up.
+		timeout += 10 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.options.URL+"/config?"+query.Encode(), nil)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("control: unexpected status %d polling for config", resp.StatusCode)
+	}
+
+	version := Version{}
+	err = json.NewDecoder(resp.Body).Decode(&version)
+	if err != nil {
+		return false, err
+	}
+
+	err = c.apply(version)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Verifies, compiles and swaps in a version.
+func (c *Client) apply(version Version) error {
+	err := version.Verify(c.key)
+	if err != nil {
+		return err
+	}
+
+	if version.Version <= c.Version() {
+		return fmt.Errorf("control: refusing to apply config version %d over %d", version.Version, c.Version())
+	}
+
+	published := redactor.Config{}
+	err = redactor.ParseConfig([]byte(version.Config), &published)
+	if err != nil {
+		return fmt.Errorf("control: config version %d: %v", version.Version, err)
+	}
+
+	config := c.local
+	config.Match = published.Match
+	config.GRPCDescriptorSets = published.GRPCDescriptorSets
+	config.LeafOnly = config.LeafOnly || published.LeafOnly
+	config.ContentTypes = published.ContentTypes
+
+	compiled, err := redactor.Compile(config)
+	if err != nil {
+		return fmt.Errorf("control: config version %d: %v", version.Version, err)
+	}
+
+	c.mu.Lock()
+	c.current.Store(compiled)
+	c.version = version.Version
+	c.loadedAt = time.Now()
+	c.mu.Unlock()
+
+	log.Printf("control: applied config version %d\n", version.Version)
+
+	return nil
+}
+
+// Status returns the client's current status.
+func (c *Client) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := Status{Proxy: c.options.ProxyID, Version: c.version, Healthy: c.err == nil}
+	if c.err != nil {
+		status.Error = c.err.Error()
+	}
+
+	return status
+}
+
+// Report sends the client's status to the control plane.
+func (c *Client) Report(ctx context.Context) error {
+	data, err := json.Marshal(c.Status())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.options.URL+"/status", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.options.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.options.Token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("control: unexpected status %d reporting status", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package control
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/button/privacy-proxy/redactor"
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns a client of a control plane server, along with the server's store.
+func makeClient(t *testing.T, longPoll bool) (*Client, *Store, *Server) {
+	privatePath, publicPath := writeKeys(t)
+
+	privateKey, err := LoadPrivateKey(privatePath)
+	assert.Nil(t, err)
+
+	store, _ := NewStore("")
+	server := NewServer(store, privateKey, "secret", "status-secret")
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	config := redactor.Config{
+		ProxyPass: "http://upstream",
+		Control: &redactor.ControlOptions{
+			URL:          httpServer.URL,
+			PublicKey:    publicPath,
+			PollInterval: "50ms",
+			LongPoll:     longPoll,
+			ProxyID:      "edge-1",
+			Token:        "status-secret",
+		},
+	}
+
+	client, err := NewClient(config)
+	assert.Nil(t, err)
+
+	return client, store, server
+}
+
+func redactWith(client *Client) interface{} {
+	match := client.Redactor().Match("POST", "/")
+	return redactor.Redact(match, map[string]interface{}{"id": "1", "email": "a@b.c"}, "$")
+}
+
+func TestNewClient(t *testing.T) {
+	_, err := NewClient(redactor.Config{})
+	assert.NotNil(t, err)
+
+	_, err = NewClient(redactor.Config{Control: &redactor.ControlOptions{URL: "http://control", PublicKey: "missing.pub"}})
+	assert.NotNil(t, err)
+}
+
+func TestClientPoll(t *testing.T) {
+	client, store, server := makeClient(t, false)
+
+	assert.Equal(t, map[string]interface{}{"id": "REDACTED", "email": "REDACTED"}, redactWith(client))
+
+	t.Log("Running with nothing published")
+	applied, err := client.Poll(context.Background())
+	assert.Nil(t, err)
+	assert.False(t, applied)
+
+	t.Log("Running with a published config")
+	store.Publish([]byte(testConfig))
+	applied, err = client.Poll(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, applied)
+	assert.Equal(t, 1, client.Version())
+	assert.Equal(t, map[string]interface{}{"id": "1", "email": "REDACTED"}, redactWith(client))
+
+	t.Log("Running with a config signed by another key")
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	server.key = otherKey
+	store.Publish([]byte(`match "http" { rule "body" { whitelist = "$.email" } }`))
+	_, err = client.Poll(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, client.Version())
+	assert.Equal(t, map[string]interface{}{"id": "1", "email": "REDACTED"}, redactWith(client))
+
+	t.Log("Running with a status report")
+	assert.Nil(t, client.Report(context.Background()))
+	assert.Equal(t, Status{Proxy: "edge-1", Version: 1, Healthy: true}, client.Status())
+}
+
+func TestClientApply(t *testing.T) {
+	client, _, server := makeClient(t, false)
+	started := client.LoadedAt()
+
+	err := client.apply(Sign(server.key, 2, testConfig))
+	assert.Nil(t, err)
+	assert.True(t, client.LoadedAt().After(started))
+
+	t.Log("Running with an older version")
+	err = client.apply(Sign(server.key, 1, testConfig))
+	assert.NotNil(t, err)
+
+	t.Log("Running with an invalid config")
+	err = client.apply(Sign(server.key, 3, `match "http" { rule "body" { whitelist = "$.a(" } }`))
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, client.Version())
+
+	t.Log("Running with content types")
+	body, err := client.Redactor().Body("POST", "/", "application/x-amz-json-1.1", []byte(`{"id": "1"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "", string(body))
+
+	err = client.apply(Sign(server.key, 4, testConfig+`
+content_types {
+  "application/x-amz-json-1.1" = "json"
+}
+`))
+	assert.Nil(t, err)
+
+	body, err = client.Redactor().Body("POST", "/", "application/x-amz-json-1.1", []byte(`{"id": "1", "email": "a@b.c"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"email":"REDACTED","id":"1"}`, string(body))
+}
+
+func TestClientRun(t *testing.T) {
+	client, store, server := makeClient(t, true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- client.Run(ctx)
+	}()
+
+	store.Publish([]byte(testConfig))
+
+	assert.Eventually(t, func() bool {
+		return client.Version() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Eventually(t, func() bool {
+		w := serveRequest(server, "GET", "/status", "", nil)
+		statuses := []Status{}
+		json.NewDecoder(strings.NewReader(w.Body.String())).Decode(&statuses)
+		return len(statuses) == 1 && statuses[0].Version == 1
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}
@@ -0,0 +1,113 @@
+// Package control is a control plane for a fleet of proxies.  A Server stores
+// versioned configs and signs them with an ed25519 key; each proxy runs a
+// Client that polls (or long-polls) the server, verifies the signature of any
+// new version, swaps in its rules and reports back its active version and
+// health.
+package control
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"time"
+)
+
+// Version is a signed, versioned config as served to proxies.  Signature is
+// the ed25519 signature of the version number and config (see signedMessage).
+type Version struct {
+	Version   int    `json:"version"`
+	Config    string `json:"config"`
+	Signature []byte `json:"signature"`
+}
+
+// Status is reported by a proxy after each poll.
+type Status struct {
+	Proxy      string    `json:"proxy"`
+	Version    int       `json:"version"`
+	Healthy    bool      `json:"healthy"`
+	Error      string    `json:"error,omitempty"`
+	ReportedAt time.Time `json:"reported_at"`
+}
+
+// Returns the bytes that are signed for a version.  The version number is
+// included so an old config can't be replayed as a newer one.
+func signedMessage(version int, config string) []byte {
+	return []byte(strconv.Itoa(version) + "\n" + config)
+}
+
+// Sign returns a signed Version.
+func Sign(key ed25519.PrivateKey, version int, config string) Version {
+	return Version{
+		Version:   version,
+		Config:    config,
+		Signature: ed25519.Sign(key, signedMessage(version, config)),
+	}
+}
+
+// Verify returns an error unless the version was signed by `key`.
+func (v Version) Verify(key ed25519.PublicKey) error {
+	if !ed25519.Verify(key, signedMessage(v.Version, v.Config), v.Signature) {
+		return fmt.Errorf("control: invalid signature for config version %d", v.Version)
+	}
+
+	return nil
+}
+
+// LoadPrivateKey reads a PEM encoded PKCS #8 ed25519 private key, as generated
+// by `openssl genpkey -algorithm ed25519`.
+func LoadPrivateKey(file string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("control: %s is not an ed25519 private key", file)
+	}
+
+	return privateKey, nil
+}
+
+// LoadPublicKey reads a PEM encoded PKIX ed25519 public key, as generated by
+// `openssl pkey -pubout`.
+func LoadPublicKey(file string) (ed25519.PublicKey, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("control: %s is not an ed25519 public key", file)
+	}
+
+	return publicKey, nil
+}
+
+func readPEM(file string) (*pem.Block, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("control: no PEM data in %s", file)
+	}
+
+	return block, nil
+}
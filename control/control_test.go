@@ -0,0 +1,74 @@
+package control
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Writes a freshly generated key pair to PEM files, returning their paths.
+func writeKeys(t *testing.T) (string, string) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	dir := t.TempDir()
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.Nil(t, err)
+	privatePath := filepath.Join(dir, "control.key")
+	ioutil.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600)
+
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	assert.Nil(t, err)
+	publicPath := filepath.Join(dir, "control.pub")
+	ioutil.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0600)
+
+	return privatePath, publicPath
+}
+
+func TestLoadKeys(t *testing.T) {
+	privatePath, publicPath := writeKeys(t)
+
+	privateKey, err := LoadPrivateKey(privatePath)
+	assert.Nil(t, err)
+
+	publicKey, err := LoadPublicKey(publicPath)
+	assert.Nil(t, err)
+	assert.True(t, publicKey.Equal(privateKey.Public()))
+
+	_, err = LoadPrivateKey(publicPath)
+	assert.NotNil(t, err)
+
+	_, err = LoadPublicKey(privatePath)
+	assert.NotNil(t, err)
+
+	empty := filepath.Join(t.TempDir(), "empty")
+	ioutil.WriteFile(empty, []byte{}, 0600)
+	_, err = LoadPublicKey(empty)
+	assert.NotNil(t, err)
+}
+
+func TestVerify(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	otherKey, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	version := Sign(privateKey, 2, `port = "8080"`)
+	assert.Nil(t, version.Verify(publicKey))
+	assert.NotNil(t, version.Verify(otherKey))
+
+	t.Log("Running with a tampered config")
+	tampered := version
+	tampered.Config = `port = "9090"`
+	assert.NotNil(t, tampered.Verify(publicKey))
+
+	t.Log("Running with a replayed version")
+	replayed := version
+	replayed.Version = 3
+	assert.NotNil(t, replayed.Verify(publicKey))
+}
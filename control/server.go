@@ -0,0 +1,278 @@
+package control
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/button/privacy-proxy/redactor"
+)
+
+// The longest a poll may be held open.
+const maxWait = 5 * time.Minute
+
+// The largest config that may be published.
+const maxConfigSize = 4 * 1024 * 1024
+
+// Server serves signed configs from a Store and collects the status of the
+// proxies polling it.  It exposes:
+//
+//   - `GET /config`:  the latest version.  Pass `version` (the caller's active
+//     version) and `wait` (a duration) to long-poll for a newer one; responds
+//     304 if there is none.
+//   - `GET /config/{version}`:  a specific version.
+//   - `PUT /config`:  publish a new version, responding with its number.
+//   - `POST /status`:  report a proxy's Status.
+//   - `GET /status`:  the last Status reported by each proxy.
+//
+// Publishing and reporting each require a bearer token, and are refused if
+// the server has none.
+type Server struct {
+	store       *Store
+	key         ed25519.PrivateKey
+	token       string
+	statusToken string
+	mux         *http.ServeMux
+
+	mu       sync.Mutex
+	statuses map[string]Status
+}
+
+// NewServer returns a Server signing the configs in `store` with `key`.
+// Publishing requires `token` as a bearer token, and status reports require
+// `statusToken`.
+func NewServer(store *Store, key ed25519.PrivateKey, token string, statusToken string) *Server {
+	s := &Server{
+		store:       store,
+		key:         key,
+		token:       token,
+		statusToken: statusToken,
+		mux:         http.NewServeMux(),
+		statuses:    map[string]Status{},
+	}
+
+	s.mux.HandleFunc("/config", s.config)
+	s.mux.HandleFunc("/config/", s.getVersion)
+	s.mux.HandleFunc("/status", s.status)
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) config(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.getLatest(w, r)
+	case http.MethodPut:
+		s.publish(w, r)
+	default:
+		methodNotAllowed(w, "GET, PUT")
+	}
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.getStatuses(w, r)
+	case http.MethodPost:
+		s.report(w, r)
+	default:
+		methodNotAllowed(w, "GET, POST")
+	}
+}
+
+// Responds 405, listing the methods that are allowed.
+func methodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+}
+
+func (s *Server) getLatest(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	current := 0
+	if query.Get("version") != "" {
+		var err error
+		current, err = strconv.Atoi(query.Get("version"))
+		if err != nil {
+			http.Error(w, "invalid version", http.StatusBadRequest)
+			return
+		}
+	}
+
+	version, config := s.store.Latest()
+
+	if query.Get("wait") != "" {
+		wait, err := time.ParseDuration(query.Get("wait"))
+		if err != nil {
+			http.Error(w, "invalid wait", http.StatusBadRequest)
+			return
+		}
+
+		if wait > maxWait {
+			wait = maxWait
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), wait)
+		defer cancel()
+
+		version, config = s.store.Wait(ctx, current)
+	}
+
+	// A version older than the caller's is one it has already refused.
+	if version == 0 || version <= current {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Sign(s.key, version, string(config)))
+}
+
+func (s *Server) getVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, "GET")
+		return
+	}
+
+	version, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/config/"))
+	if err != nil {
+		http.Error(w, "invalid version", http.StatusBadRequest)
+		return
+	}
+
+	config, ok := s.store.Get(version)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Sign(s.key, version, string(config)))
+}
+
+// Returns true iff a request bears `token`, responding with an error if not.
+// Every request is refused if `token` isn't set.
+func authorize(w http.ResponseWriter, r *http.Request, token string) bool {
+	if token == "" {
+		http.Error(w, "forbidden: no token is configured", http.StatusForbidden)
+		return false
+	}
+
+	expected := "Bearer " + token
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	return true
+}
+
+func (s *Server) publish(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, s.token) {
+		return
+	}
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxConfigSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	err = validate(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	version, err := s.store.Publish(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]int{"version": version})
+}
+
+func (s *Server) getStatuses(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	statuses := make([]Status, 0, len(s.statuses))
+	for _, status := range s.statuses {
+		statuses = append(statuses, status)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Proxy < statuses[j].Proxy
+	})
+
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (s *Server) report(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, s.statusToken) {
+		return
+	}
+
+	status := Status{}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&status)
+	if err != nil || status.Proxy == "" {
+		http.Error(w, "invalid status", http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.Reserve(status.Version)
+	if err != nil {
+		http.Error(w, "invalid status: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status.ReportedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	s.statuses[status.Proxy] = status
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Checks that a config parses and validates before it's published.
+// Descriptor sets, vaults, keyrings and keys are read by each proxy from its
+// own disk (and only from its local config), so they aren't opened here,
+// lest a publisher choose a path for the control plane to open.
+func validate(data []byte) error {
+	config := redactor.Config{}
+	err := redactor.ParseConfig(data, &config)
+	if err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+
+	config.GRPCDescriptorSets = nil
+	config.Vault = nil
+	config.Keyring = ""
+	config.JWT = nil
+	config.HashKey = ""
+
+	err = redactor.Validate(config)
+	if err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,286 @@
+package control
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfig = `
+match "http" {
+  rule "body" {
+    whitelist = "$.id"
+  }
+}
+`
+
+// A config with actions that need a vault, keyring, JWT keys and hash key,
+// naming a vault the control plane mustn't open.
+const testSecretsConfig = `
+vault {
+  path = "/tmp/privacy-proxy-control-test.db"
+  key_file = "/tmp/privacy-proxy-control-test.key"
+}
+
+match "http" {
+  rule "body" {
+    whitelist = "$.email"
+    action = "tokenize"
+  }
+
+  rule "body" {
+    whitelist = "$.card"
+    action = "encrypt"
+  }
+
+  rule "body" {
+    whitelist = "$.id"
+    action = "fake"
+    format = "uuid"
+  }
+
+  rule "body" {
+    whitelist = "$.token"
+    action = "jwt"
+  }
+}
+`
+
+func makeServer(t *testing.T, token string) (*Server, ed25519.PublicKey) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	store, err := NewStore("")
+	assert.Nil(t, err)
+
+	return NewServer(store, privateKey, token, "status-secret"), publicKey
+}
+
+// Returns a header bearing `token`.
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": []string{"Bearer " + token}}
+}
+
+func serveRequest(server *Server, method string, target string, body string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for name, values := range header {
+		r.Header[name] = values
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	return w
+}
+
+func TestServerPublish(t *testing.T) {
+	server, _ := makeServer(t, "secret")
+	authorized := bearer("secret")
+
+	type testCase struct {
+		name   string
+		header http.Header
+		body   string
+		status int
+	}
+
+	cases := []testCase{
+		{
+			name:   "with no token",
+			header: http.Header{},
+			body:   testConfig,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "with the wrong token",
+			header: bearer("guess"),
+			body:   testConfig,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "with the status token",
+			header: bearer("status-secret"),
+			body:   testConfig,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "with an unparseable config",
+			header: authorized,
+			body:   `match "http" {`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "with an invalid location",
+			header: authorized,
+			body:   `match "http" { rule "body" { whitelist = "$.a(" } }`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "with actions needing secrets the proxies hold",
+			header: authorized,
+			body:   testSecretsConfig,
+			status: http.StatusCreated,
+		},
+		{
+			name:   "with a valid config",
+			header: authorized,
+			body:   testConfig,
+			status: http.StatusCreated,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := serveRequest(server, "PUT", "/config", c.body, c.header)
+			assert.Equal(t, c.status, w.Code)
+		})
+	}
+
+	version, _ := server.store.Latest()
+	assert.Equal(t, 2, version)
+
+	_, err := os.Stat("/tmp/privacy-proxy-control-test.db")
+	assert.True(t, os.IsNotExist(err))
+
+	t.Log("Running with no token configured")
+	server, _ = makeServer(t, "")
+	w := serveRequest(server, "PUT", "/config", testConfig, bearer(""))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestServerGetConfig(t *testing.T) {
+	server, publicKey := makeServer(t, "secret")
+
+	w := serveRequest(server, "GET", "/config", "", nil)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	w = serveRequest(server, "PUT", "/config", testConfig, bearer("secret"))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"version": 1}`, w.Body.String())
+
+	type testCase struct {
+		name    string
+		target  string
+		status  int
+		version int
+	}
+
+	cases := []testCase{
+		{
+			name:    "with no version",
+			target:  "/config",
+			status:  http.StatusOK,
+			version: 1,
+		},
+		{
+			name:   "with the latest version",
+			target: "/config?version=1",
+			status: http.StatusNotModified,
+		},
+		{
+			name:   "with a later version",
+			target: "/config?version=5",
+			status: http.StatusNotModified,
+		},
+		{
+			name:   "with the latest version and a wait",
+			target: "/config?version=1&wait=10ms",
+			status: http.StatusNotModified,
+		},
+		{
+			name:    "with a specific version",
+			target:  "/config/1",
+			status:  http.StatusOK,
+			version: 1,
+		},
+		{
+			name:   "with a missing version",
+			target: "/config/2",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "with an invalid wait",
+			target: "/config?wait=soon",
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := serveRequest(server, "GET", c.target, "", nil)
+			assert.Equal(t, c.status, w.Code)
+
+			if c.status == http.StatusOK {
+				version := Version{}
+				assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &version))
+				assert.Equal(t, c.version, version.Version)
+				assert.Equal(t, testConfig, version.Config)
+				assert.Nil(t, version.Verify(publicKey))
+			}
+		})
+	}
+
+	t.Log("Running with a long-poll")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		serveRequest(server, "PUT", "/config", testConfig, bearer("secret"))
+	}()
+	w = serveRequest(server, "GET", "/config?version=1&wait=1m", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"version":2`)
+
+	t.Log("Running with unsupported methods")
+	w = serveRequest(server, "DELETE", "/config", "", bearer("secret"))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, PUT", w.Header().Get("Allow"))
+	w = serveRequest(server, "PUT", "/config/1", testConfig, bearer("secret"))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	w = serveRequest(server, "DELETE", "/status", "", bearer("status-secret"))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestServerStatus(t *testing.T) {
+	server, _ := makeServer(t, "secret")
+	authorized := bearer("status-secret")
+
+	w := serveRequest(server, "POST", "/status", `{"proxy": "edge-2", "version": 1}`, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = serveRequest(server, "POST", "/status", `{"proxy": "edge-2", "version": 1}`, bearer("secret"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = serveRequest(server, "POST", "/status", `{"version": 1}`, authorized)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serveRequest(server, "POST", "/status", `{"proxy": "edge-3", "version": 9223372036854775807}`, authorized)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serveRequest(server, "POST", "/status", `{"proxy": "edge-2", "version": 7, "healthy": true}`, authorized)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = serveRequest(server, "POST", "/status", `{"proxy": "edge-1", "version": 0, "healthy": false, "error": "timeout"}`, authorized)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = serveRequest(server, "GET", "/status", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	statuses := []Status{}
+	assert.Nil(t, json.NewDecoder(bytes.NewReader(w.Body.Bytes())).Decode(&statuses))
+	assert.Equal(t, 2, len(statuses))
+	assert.Equal(t, "edge-1", statuses[0].Proxy)
+	assert.Equal(t, "timeout", statuses[0].Error)
+	assert.Equal(t, "edge-2", statuses[1].Proxy)
+	assert.True(t, statuses[1].Healthy)
+	assert.False(t, statuses[1].ReportedAt.IsZero())
+
+	t.Log("Running with a publish after a proxy reported a later version")
+	w = serveRequest(server, "PUT", "/config", testConfig, bearer("secret"))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"version": 8}`, w.Body.String())
+}
@@ -0,0 +1,157 @@
+package control
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// How far past the latest version Reserve may reserve.  It's far more
+// versions than a store could lose, but keeps a bad report from pushing
+// version numbers towards overflow.
+const maxReserveAhead = 1000000
+
+// Store holds every published config by version number.  Versions start at 1
+// and are never reused.  If the store has a directory each version is kept
+// there as `<version>.hcl`, so they survive restarts; otherwise they start
+// from 1 again, and only the versions reserved with Reserve are skipped.
+type Store struct {
+	dir      string
+	mu       sync.Mutex
+	configs  map[int][]byte
+	latest   int
+	reserved int
+	changed  chan struct{}
+}
+
+// NewStore returns a store backed by `dir`, loading any versions already in
+// it.  If `dir` is empty versions are only kept in memory.
+func NewStore(dir string) (*Store, error) {
+	s := &Store{dir: dir, configs: map[int][]byte{}, changed: make(chan struct{})}
+	if dir == "" {
+		return s, nil
+	}
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasSuffix(name, ".hcl") {
+			continue
+		}
+
+		version, err := strconv.Atoi(strings.TrimSuffix(name, ".hcl"))
+		if err != nil || version < 1 {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		s.configs[version] = data
+		if version > s.latest {
+			s.latest = version
+		}
+	}
+
+	return s, nil
+}
+
+// Publish stores a config as the next version, returning its number.
+func (s *Store) Publish(config []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	version := s.latest + 1
+	if s.reserved >= version {
+		version = s.reserved + 1
+	}
+
+	if s.dir != "" {
+		file := filepath.Join(s.dir, fmt.Sprintf("%d.hcl", version))
+		err := ioutil.WriteFile(file, config, 0600)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	s.configs[version] = config
+	s.latest = version
+
+	// Wake everyone waiting on the previous version.
+	close(s.changed)
+	s.changed = make(chan struct{})
+
+	return version, nil
+}
+
+// Reserve makes sure the next version published is numbered above `version`,
+// such as one a proxy reports it has applied.  Proxies refuse versions older
+// than their own, so a store that lost its versions on restart would
+// otherwise publish versions they'd never apply.  Returns an error if
+// `version` is negative or more than maxReserveAhead past the latest.
+func (s *Store) Reserve(version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if version < 0 || version > s.latest+maxReserveAhead {
+		return fmt.Errorf("version %d is out of range", version)
+	}
+
+	if version > s.reserved {
+		s.reserved = version
+	}
+
+	return nil
+}
+
+// Latest returns the latest version and its config.  The version is 0 if
+// nothing has been published.
+func (s *Store) Latest() (int, []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.latest, s.configs[s.latest]
+}
+
+// Get returns the config of a version, and whether it exists.
+func (s *Store) Get(version int) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config, ok := s.configs[version]
+	return config, ok
+}
+
+// Wait blocks until a version later than `version` is published or the
+// context is done, then returns the latest version and its config.
+func (s *Store) Wait(ctx context.Context, version int) (int, []byte) {
+	s.mu.Lock()
+	changed := s.changed
+	latest := s.latest
+	s.mu.Unlock()
+
+	if latest <= version {
+		select {
+		case <-changed:
+		case <-ctx.Done():
+		}
+	}
+
+	return s.Latest()
+}
@@ -0,0 +1,108 @@
+package control
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewStore(dir)
+	assert.Nil(t, err)
+
+	version, config := store.Latest()
+	assert.Equal(t, 0, version)
+	assert.Nil(t, config)
+
+	version, err = store.Publish([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, version)
+
+	version, err = store.Publish([]byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, version)
+
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "2.hcl"))
+	assert.Equal(t, []byte("b"), data)
+
+	t.Log("Running with a reloaded store")
+	ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0600)
+
+	reloaded, err := NewStore(dir)
+	assert.Nil(t, err)
+
+	version, config = reloaded.Latest()
+	assert.Equal(t, 2, version)
+	assert.Equal(t, []byte("b"), config)
+
+	config, ok := reloaded.Get(1)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("a"), config)
+
+	_, ok = reloaded.Get(3)
+	assert.False(t, ok)
+}
+
+func TestStoreWait(t *testing.T) {
+	store, _ := NewStore("")
+	store.Publish([]byte("a"))
+
+	t.Log("Running with an outdated version")
+	version, config := store.Wait(context.Background(), 0)
+	assert.Equal(t, 1, version)
+	assert.Equal(t, []byte("a"), config)
+
+	t.Log("Running with a timeout")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	version, _ = store.Wait(ctx, 1)
+	assert.Equal(t, 1, version)
+
+	t.Log("Running with a publish while waiting")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		store.Publish([]byte("b"))
+	}()
+	version, config = store.Wait(context.Background(), 1)
+	assert.Equal(t, 2, version)
+	assert.Equal(t, []byte("b"), config)
+}
+
+func TestStoreReserve(t *testing.T) {
+	store, _ := NewStore("")
+
+	assert.Nil(t, store.Reserve(5))
+	assert.Nil(t, store.Reserve(3))
+
+	version, err := store.Publish([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, 6, version)
+
+	version, err = store.Publish([]byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, 7, version)
+
+	t.Log("Running with a wait on a version ahead of the store")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	version, _ = store.Wait(ctx, 9)
+	assert.Equal(t, 7, version)
+	assert.NotNil(t, ctx.Err())
+
+	t.Log("Running with versions out of range")
+	assert.NotNil(t, store.Reserve(-1))
+	assert.NotNil(t, store.Reserve(math.MaxInt64))
+	assert.NotNil(t, store.Reserve(7+maxReserveAhead+1))
+	assert.Nil(t, store.Reserve(7+maxReserveAhead))
+
+	version, err = store.Publish([]byte("c"))
+	assert.Nil(t, err)
+	assert.Equal(t, 8+maxReserveAhead, version)
+}
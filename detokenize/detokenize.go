@@ -0,0 +1,95 @@
+// Package detokenize is an HTTP API for recovering the values replaced by
+// `tokenize` rules from a vault.  It's the one place raw values can be read
+// back, so every request must be authenticated and each lookup is logged
+// (without the value).
+package detokenize
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/button/privacy-proxy/redactor"
+)
+
+// DefaultAddress is where the detokenize API listens if the config doesn't
+// say.  It's only reachable locally by default.
+const DefaultAddress = "127.0.0.1:8890"
+
+// The largest request that may be sent.
+const maxRequestSize = 1024 * 1024
+
+// Request is the body of `POST /detokenize`.
+type Request struct {
+	Tokens []string `json:"tokens"`
+}
+
+// Response is the response of `POST /detokenize`.  Values maps each known
+// token to its value; unknown tokens are left out.
+type Response struct {
+	Values map[string]string `json:"values"`
+}
+
+// Handler serves the detokenize API:
+//
+//   - `POST /detokenize`:  the values of the tokens in the posted Request.
+type Handler struct {
+	vault redactor.Vault
+	token string
+	mux   *http.ServeMux
+}
+
+// NewHandler returns a Handler for a vault.  Requests must send `token` as a
+// bearer token; if it's empty, every request is refused.
+func NewHandler(vault redactor.Vault, token string) *Handler {
+	h := &Handler{vault: vault, token: token, mux: http.NewServeMux()}
+
+	h.mux.HandleFunc("/detokenize", h.detokenize)
+
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	expected := "Bearer " + h.token
+	if h.token == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) detokenize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	request := Request{}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := Response{Values: map[string]string{}}
+	for _, token := range request.Tokens {
+		value, err := h.vault.Detokenize(token)
+		if err == redactor.ErrUnknownToken {
+			continue
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response.Values[token] = value
+	}
+
+	log.Printf("detokenize: %s detokenized %d of %d tokens\n", r.RemoteAddr, len(response.Values), len(request.Tokens))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
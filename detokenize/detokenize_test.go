@@ -0,0 +1,93 @@
+package detokenize
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/button/privacy-proxy/redactor"
+	"github.com/stretchr/testify/assert"
+)
+
+// A vault holding fixed tokens.
+type testVault map[string]string
+
+func (v testVault) Tokenize(value string) (string, error) {
+	for token, v := range v {
+		if v == value {
+			return token, nil
+		}
+	}
+
+	return "", redactor.ErrUnknownToken
+}
+
+func (v testVault) Detokenize(token string) (string, error) {
+	value, ok := v[token]
+	if !ok {
+		return "", redactor.ErrUnknownToken
+	}
+
+	return value, nil
+}
+
+func serveRequest(handler *Handler, body string, authorization string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/detokenize", strings.NewReader(body))
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestAuthorization(t *testing.T) {
+	vault := testVault{"tok_1": "diggy@net.cool"}
+
+	type testCase struct {
+		name          string
+		token         string
+		authorization string
+		code          int
+	}
+
+	cases := []testCase{
+		{name: "with the token", token: "secret", authorization: "Bearer secret", code: http.StatusOK},
+		{name: "with the wrong token", token: "secret", authorization: "Bearer guess", code: http.StatusUnauthorized},
+		{name: "with no token", token: "secret", authorization: "", code: http.StatusUnauthorized},
+		{name: "with no token configured", token: "", authorization: "Bearer ", code: http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := serveRequest(NewHandler(vault, c.token), `{"tokens": []}`, c.authorization)
+			assert.Equal(t, c.code, w.Code)
+		})
+	}
+}
+
+func TestDetokenize(t *testing.T) {
+	handler := NewHandler(testVault{"tok_1": "diggy@net.cool", "tok_2": "555-1234"}, "secret")
+
+	t.Log("Running with known and unknown tokens")
+	w := serveRequest(handler, `{"tokens": ["tok_1", "tok_3"]}`, "Bearer secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	response := Response{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, map[string]string{"tok_1": "diggy@net.cool"}, response.Values)
+
+	t.Log("Running with an invalid request")
+	w = serveRequest(handler, `tok_1`, "Bearer secret")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	t.Log("Running with another method")
+	r := httptest.NewRequest("GET", "/detokenize?tokens=tok_1", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
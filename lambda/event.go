@@ -0,0 +1,261 @@
+package lambda
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/button/privacy-proxy/redactor"
+)
+
+// Request is an API Gateway Lambda proxy integration event.  It holds the
+// fields of both the REST API (payload version 1.0) and HTTP API (payload
+// version 2.0) shapes; Version tells them apart.
+//
+// Fields we don't know about are dropped when an event is decoded, so they
+// can never be passed on unredacted.
+type Request struct {
+	Version string `json:"version,omitempty"`
+
+	// Payload version 1.0 only.
+	Resource                        string              `json:"resource,omitempty"`
+	Path                            string              `json:"path,omitempty"`
+	HTTPMethod                      string              `json:"httpMethod,omitempty"`
+	MultiValueHeaders               map[string][]string `json:"multiValueHeaders,omitempty"`
+	MultiValueQueryStringParameters map[string][]string `json:"multiValueQueryStringParameters,omitempty"`
+
+	// Payload version 2.0 only.
+	RouteKey       string   `json:"routeKey,omitempty"`
+	RawPath        string   `json:"rawPath,omitempty"`
+	RawQueryString string   `json:"rawQueryString,omitempty"`
+	Cookies        []string `json:"cookies,omitempty"`
+
+	Headers               map[string]string `json:"headers,omitempty"`
+	QueryStringParameters map[string]string `json:"queryStringParameters,omitempty"`
+	PathParameters        map[string]string `json:"pathParameters,omitempty"`
+	StageVariables        map[string]string `json:"stageVariables,omitempty"`
+	RequestContext        RequestContext    `json:"requestContext"`
+	Body                  string            `json:"body,omitempty"`
+	IsBase64Encoded       bool              `json:"isBase64Encoded"`
+}
+
+// RequestContext holds the routing information of an event.  Caller identity
+// (source IP, user agent, authorizer claims, etc) is deliberately omitted.
+type RequestContext struct {
+	AccountID    string       `json:"accountId,omitempty"`
+	APIID        string       `json:"apiId,omitempty"`
+	DomainName   string       `json:"domainName,omitempty"`
+	RequestID    string       `json:"requestId,omitempty"`
+	Stage        string       `json:"stage,omitempty"`
+	ResourcePath string       `json:"resourcePath,omitempty"`
+	HTTPMethod   string       `json:"httpMethod,omitempty"`
+	HTTP         *HTTPContext `json:"http,omitempty"`
+}
+
+// HTTPContext is the `requestContext.http` object of payload version 2.0.
+type HTTPContext struct {
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// Response is an API Gateway Lambda proxy integration response.
+type Response struct {
+	StatusCode        int                 `json:"statusCode"`
+	Headers           map[string]string   `json:"headers,omitempty"`
+	MultiValueHeaders map[string][]string `json:"multiValueHeaders,omitempty"`
+	Cookies           []string            `json:"cookies,omitempty"`
+	Body              string              `json:"body"`
+	IsBase64Encoded   bool                `json:"isBase64Encoded"`
+}
+
+// Returns true iff the event uses the HTTP API (2.0) payload shape.
+func (e Request) isV2() bool {
+	return e.Version == "2.0"
+}
+
+// Returns the HTTP method of the event.
+func (e Request) method() string {
+	if e.isV2() && e.RequestContext.HTTP != nil {
+		return e.RequestContext.HTTP.Method
+	}
+
+	return e.HTTPMethod
+}
+
+// Returns the request URL's path of the event.  Payload version 1.0 has
+// the decoded path, and 2.0 the path as the client sent it, still escaped.
+func (e Request) path() (*url.URL, error) {
+	if !e.isV2() {
+		return &url.URL{Path: e.Path}, nil
+	}
+
+	decoded, err := url.PathUnescape(e.RawPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rawPath %q: %v", e.RawPath, err)
+	}
+
+	return &url.URL{Path: decoded, RawPath: e.RawPath}, nil
+}
+
+// Returns the decoded body of the event.
+func (e Request) body() ([]byte, error) {
+	if e.IsBase64Encoded {
+		return base64.StdEncoding.DecodeString(e.Body)
+	}
+
+	return []byte(e.Body), nil
+}
+
+// Converts an event into an equivalent *http.Request, so it can be redacted
+// (and forwarded) like any other request.
+func (e Request) toHTTPRequest() (*http.Request, error) {
+	body, err := e.body()
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := e.path()
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+
+	if e.isV2() {
+		u.RawQuery = e.RawQueryString
+
+		for name, value := range e.Headers {
+			header.Add(name, value)
+		}
+
+		if len(e.Cookies) > 0 {
+			header.Set("Cookie", strings.Join(e.Cookies, "; "))
+		}
+	} else {
+		query := url.Values{}
+		if e.MultiValueQueryStringParameters != nil {
+			for k, values := range e.MultiValueQueryStringParameters {
+				query[k] = values
+			}
+		} else {
+			for k, value := range e.QueryStringParameters {
+				query.Add(k, value)
+			}
+		}
+		u.RawQuery = query.Encode()
+
+		if e.MultiValueHeaders != nil {
+			for name, values := range e.MultiValueHeaders {
+				for _, value := range values {
+					header.Add(name, value)
+				}
+			}
+		} else {
+			for name, value := range e.Headers {
+				header.Add(name, value)
+			}
+		}
+	}
+
+	r, err := http.NewRequest(e.method(), u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	r.Header = header
+	return r, nil
+}
+
+// Writes the (redacted) path, querystring, headers and body of `r` back onto
+// the event, preserving the event's shape and header name casing.  Mutates e.
+func (e *Request) applyHTTPRequest(r *http.Request) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	if e.isV2() {
+		e.RawPath = r.URL.EscapedPath()
+		if e.RequestContext.HTTP != nil {
+			e.RequestContext.HTTP.Path = r.URL.Path
+		}
+	} else {
+		e.Path = r.URL.Path
+	}
+
+	if e.IsBase64Encoded {
+		e.Body = base64.StdEncoding.EncodeToString(body)
+	} else {
+		e.Body = string(body)
+	}
+
+	query := r.URL.Query()
+
+	if e.isV2() {
+		e.RawQueryString = r.URL.RawQuery
+
+		if e.QueryStringParameters != nil {
+			e.QueryStringParameters = map[string]string{}
+			for k, values := range query {
+				e.QueryStringParameters[k] = strings.Join(values, ",")
+			}
+		}
+
+		if e.Cookies != nil {
+			e.Cookies = []string{}
+			if cookies := r.Header.Get("Cookie"); cookies != "" {
+				e.Cookies = strings.Split(cookies, "; ")
+			}
+		}
+	} else {
+		if e.QueryStringParameters != nil {
+			e.QueryStringParameters = map[string]string{}
+			for k, values := range query {
+				e.QueryStringParameters[k] = values[len(values)-1]
+			}
+		}
+
+		if e.MultiValueQueryStringParameters != nil {
+			e.MultiValueQueryStringParameters = map[string][]string{}
+			for k, values := range query {
+				e.MultiValueQueryStringParameters[k] = values
+			}
+		}
+
+		for name := range e.MultiValueHeaders {
+			e.MultiValueHeaders[name] = r.Header[http.CanonicalHeaderKey(name)]
+		}
+	}
+
+	for name := range e.Headers {
+		values := r.Header[http.CanonicalHeaderKey(name)]
+		if e.isV2() {
+			e.Headers[name] = strings.Join(values, ",")
+		} else if len(values) > 0 {
+			e.Headers[name] = values[len(values)-1]
+		}
+	}
+
+	// HTTP APIs lowercase all header names, so we follow suit for those
+	// events.
+	markerName := redactor.RedactedHeader
+	if e.isV2() {
+		markerName = strings.ToLower(markerName)
+	}
+
+	if e.Headers == nil {
+		e.Headers = map[string]string{}
+	}
+	e.Headers[markerName] = "1"
+
+	if e.MultiValueHeaders != nil {
+		e.MultiValueHeaders[markerName] = []string{"1"}
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+// Package lambda hosts the redactor on AWS Lambda behind API Gateway.  Proxy
+// integration events of both REST APIs (payload version 1.0) and HTTP APIs
+// (payload version 2.0) are redacted and either forwarded to the config's
+// `proxy_pass` upstream or, if there is none, returned as a redacted event.
+package lambda
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/button/privacy-proxy/redactor"
+)
+
+// Handler redacts API Gateway events.
+type Handler struct {
+	redactor *redactor.Redactor
+	upstream *url.URL
+	client   *http.Client
+}
+
+// NewHandler compiles a config into a Handler.  If the config has a
+// `proxy_pass`, redacted requests are forwarded there and the upstream's
+// response is returned; otherwise the redacted event itself is returned.
+func NewHandler(config redactor.Config) (*Handler, error) {
+	compiled, err := redactor.Compile(config)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := &Handler{redactor: compiled, client: http.DefaultClient}
+
+	if config.ProxyPass != "" {
+		handler.upstream, err = url.Parse(config.ProxyPass)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return handler, nil
+}
+
+// Handle redacts a raw JSON event, returning the raw JSON result.
+func (h *Handler) Handle(ctx context.Context, payload []byte) ([]byte, error) {
+	var event Request
+	err := json.Unmarshal(payload, &event)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.upstream == nil {
+		redacted, err := h.RedactEvent(event)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(redacted)
+	}
+
+	response, err := h.Forward(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(response)
+}
+
+// Redacts an event, returning the redacted request and the match clause that
+// was used.
+func (h *Handler) redactRequest(event Request) (*http.Request, redactor.HTTPMatch, error) {
+	r, err := event.toHTTPRequest()
+	if err != nil {
+		return nil, redactor.HTTPMatch{}, err
+	}
+
+	match := h.redactor.Match(event.method(), r.URL.EscapedPath())
+
+	// Like the proxy, a body that can't be parsed is replaced rather than
+	// rejected.
+	err = redactor.RedactRequest(match, r)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return r, match, nil
+}
+
+// RedactEvent returns a redacted copy of an event.  If the match clause's path
+// is a template, the event's path parameters are redacted like its named
+// segments; otherwise every path parameter is redacted, since API Gateway's
+// routes can name segments the match doesn't.
+func (h *Handler) RedactEvent(event Request) (Request, error) {
+	r, match, err := h.redactRequest(event)
+	if err != nil {
+		return Request{}, err
+	}
+
+	if event.PathParameters != nil {
+		parameters := map[string]string{}
+		for name, value := range event.PathParameters {
+			if match.HasPathTemplate() {
+				parameters[name] = redactor.RedactPathSegment(match, name, value)
+			} else {
+				parameters[name] = redactor.RedactedStr
+			}
+		}
+		event.PathParameters = parameters
+	}
+
+	err = event.applyHTTPRequest(r)
+	return event, err
+}
+
+// Forward redacts an event and sends it to the upstream, returning the
+// upstream's (optionally redacted) response as an API Gateway response.
+func (h *Handler) Forward(ctx context.Context, event Request) (Response, error) {
+	r, match, err := h.redactRequest(event)
+	if err != nil {
+		return Response{}, err
+	}
+
+	upstreamURL := *h.upstream
+	upstreamURL.Path = path.Join(h.upstream.Path, r.URL.Path)
+	upstreamURL.RawQuery = r.URL.RawQuery
+
+	r = r.WithContext(ctx)
+	r.URL = &upstreamURL
+	r.Host = upstreamURL.Host
+	r.Header.Add(redactor.RedactedHeader, "1")
+
+	resp, err := h.client.Do(r)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+
+	err = redactor.RedactResponse(match, resp)
+	if err != nil {
+		log.Println(err)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Response{}, err
+	}
+
+	response := Response{StatusCode: resp.StatusCode, Headers: map[string]string{}}
+
+	if utf8.Valid(body) {
+		response.Body = string(body)
+	} else {
+		response.Body = base64.StdEncoding.EncodeToString(body)
+		response.IsBase64Encoded = true
+	}
+
+	for name, values := range resp.Header {
+		if event.isV2() {
+			if name == "Set-Cookie" {
+				response.Cookies = values
+			} else {
+				response.Headers[name] = strings.Join(values, ",")
+			}
+			continue
+		}
+
+		response.Headers[name] = values[len(values)-1]
+		if len(values) > 1 {
+			if response.MultiValueHeaders == nil {
+				response.MultiValueHeaders = map[string][]string{}
+			}
+			response.MultiValueHeaders[name] = values
+		}
+	}
+
+	return response, nil
+}
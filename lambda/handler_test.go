@@ -0,0 +1,241 @@
+package lambda
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/button/privacy-proxy/redactor"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeConfig(proxyPass string) redactor.Config {
+	return redactor.Config{
+		ProxyPass: proxyPass,
+		Match: redactor.MatchOptions{
+			HTTP: []redactor.HTTPMatch{
+				redactor.HTTPMatch{
+					Path:           "/post",
+					Method:         "POST",
+					RedactResponse: true,
+					RuleOptions: redactor.RuleOptions{
+						Body:        []redactor.ConfigRule{redactor.ConfigRule{Whitelist: "$.event_id"}},
+						Querystring: []redactor.ConfigRule{redactor.ConfigRule{Whitelist: "eventid"}},
+						Header:      []redactor.ConfigRule{redactor.ConfigRule{Whitelist: "User-Agent"}},
+						Response:    []redactor.ConfigRule{redactor.ConfigRule{Whitelist: "$.ok"}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func loadEvent(t *testing.T, file string) Request {
+	data, err := ioutil.ReadFile(file)
+	assert.Nil(t, err)
+
+	var event Request
+	assert.Nil(t, json.Unmarshal(data, &event))
+	return event
+}
+
+func TestRedactEventREST(t *testing.T) {
+	handler, err := NewHandler(makeConfig(""))
+	assert.Nil(t, err)
+
+	redacted, err := handler.RedactEvent(loadEvent(t, "testdata/rest.json"))
+	assert.Nil(t, err)
+
+	assert.Equal(t, `{"email":"REDACTED","event_id":42}`, redacted.Body)
+	assert.Equal(t, map[string]string{"eventid": "42", "email": "REDACTED"}, redacted.QueryStringParameters)
+	assert.Equal(t, map[string][]string{"eventid": []string{"42"}, "email": []string{"REDACTED"}}, redacted.MultiValueQueryStringParameters)
+	assert.Equal(t, "curl/7.54.0", redacted.Headers["User-Agent"])
+	assert.Equal(t, "application/json", redacted.Headers["Content-Type"])
+	assert.Equal(t, "1", redacted.Headers[redactor.RedactedHeader])
+	assert.Equal(t, []string{"curl/7.54.0"}, redacted.MultiValueHeaders["User-Agent"])
+	assert.Equal(t, "prod", redacted.RequestContext.Stage)
+}
+
+func TestRedactEventHTTP(t *testing.T) {
+	handler, err := NewHandler(makeConfig(""))
+	assert.Nil(t, err)
+
+	redacted, err := handler.RedactEvent(loadEvent(t, "testdata/http.json"))
+	assert.Nil(t, err)
+
+	body, err := base64.StdEncoding.DecodeString(redacted.Body)
+	assert.Nil(t, err)
+
+	assert.True(t, redacted.IsBase64Encoded)
+	assert.Equal(t, `{"email":"REDACTED","event_id":42}`, string(body))
+	assert.Equal(t, "eventid=42&email=REDACTED", redacted.RawQueryString)
+	assert.Equal(t, map[string]string{"eventid": "42", "email": "REDACTED"}, redacted.QueryStringParameters)
+	assert.Equal(t, []string{"REDACTED"}, redacted.Cookies)
+	assert.Equal(t, "curl/7.54.0", redacted.Headers["user-agent"])
+	assert.Equal(t, "1", redacted.Headers["x-privacy-proxy-redacted"])
+}
+
+func TestHandleWithoutUpstream(t *testing.T) {
+	handler, err := NewHandler(makeConfig(""))
+	assert.Nil(t, err)
+
+	payload, err := ioutil.ReadFile("testdata/rest.json")
+	assert.Nil(t, err)
+
+	result, err := handler.Handle(context.Background(), payload)
+	assert.Nil(t, err)
+
+	var event map[string]interface{}
+	assert.Nil(t, json.Unmarshal(result, &event))
+
+	assert.Equal(t, `{"email":"REDACTED","event_id":42}`, event["body"])
+	assert.NotContains(t, string(result), "203.0.113.7")
+}
+
+func TestRedactEventPathTemplate(t *testing.T) {
+	config := makeConfig("")
+	config.Match.HTTP = append(config.Match.HTTP, redactor.HTTPMatch{
+		Path:        "/users/{id}/orders/{order}",
+		RuleOptions: redactor.RuleOptions{PathRules: []redactor.ConfigRule{redactor.ConfigRule{Whitelist: "order"}}},
+	})
+
+	handler, err := NewHandler(config)
+	assert.Nil(t, err)
+
+	redacted, err := handler.RedactEvent(Request{
+		Path:           "/users/diggy@net.cool/orders/42",
+		HTTPMethod:     "GET",
+		PathParameters: map[string]string{"id": "diggy@net.cool", "order": "42"},
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "/users/REDACTED/orders/42", redacted.Path)
+	assert.Equal(t, map[string]string{"id": "REDACTED", "order": "42"}, redacted.PathParameters)
+}
+
+func TestRedactEventPathParameters(t *testing.T) {
+	config := makeConfig("")
+	config.Match.HTTP = append(config.Match.HTTP, redactor.HTTPMatch{
+		Path:        "/users/{id}/orders/{order}",
+		RuleOptions: redactor.RuleOptions{PathRules: []redactor.ConfigRule{redactor.ConfigRule{Whitelist: "order"}}},
+	})
+
+	handler, err := NewHandler(config)
+	assert.Nil(t, err)
+
+	type testCase struct {
+		name       string
+		event      Request
+		path       string
+		parameters map[string]string
+	}
+
+	cases := []testCase{
+		{
+			name: "with a match that isn't a template",
+			event: Request{
+				Path:           "/post",
+				HTTPMethod:     "POST",
+				PathParameters: map[string]string{"proxy": "post", "id": "diggy@net.cool"},
+			},
+			path:       "/post",
+			parameters: map[string]string{"proxy": "REDACTED", "id": "REDACTED"},
+		},
+		{
+			name: "with no match",
+			event: Request{
+				Path:           "/accounts/diggy@net.cool",
+				HTTPMethod:     "GET",
+				PathParameters: map[string]string{"account": "diggy@net.cool"},
+			},
+			path:       "/accounts/diggy@net.cool",
+			parameters: map[string]string{"account": "REDACTED"},
+		},
+		{
+			name: "with an escaped v2 rawPath",
+			event: Request{
+				Version:        "2.0",
+				RawPath:        "/users/a%2Fb/orders/4%202",
+				RequestContext: RequestContext{HTTP: &HTTPContext{Method: "GET", Path: "/users/a/b/orders/4 2"}},
+				PathParameters: map[string]string{"id": "a/b", "order": "4 2"},
+			},
+			path:       "/users/REDACTED/orders/4%202",
+			parameters: map[string]string{"id": "REDACTED", "order": "4 2"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			redacted, err := handler.RedactEvent(c.event)
+			assert.Nil(t, err)
+
+			if redacted.isV2() {
+				assert.Equal(t, c.path, redacted.RawPath)
+			} else {
+				assert.Equal(t, c.path, redacted.Path)
+			}
+			assert.Equal(t, c.parameters, redacted.PathParameters)
+		})
+	}
+
+	t.Log("Running with an invalid v2 rawPath")
+	_, err = handler.RedactEvent(Request{Version: "2.0", RawPath: "/users/%zz"})
+	assert.NotNil(t, err)
+}
+
+func TestHandleWithUpstream(t *testing.T) {
+	var received *http.Request
+	var receivedBody string
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = r
+		receivedBody = string(body)
+
+		http.SetCookie(w, &http.Cookie{Name: "a", Value: "1"})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok": true, "email": "diggy@net.cool"}`))
+	}))
+	defer upstream.Close()
+
+	handler, err := NewHandler(makeConfig(upstream.URL + "/ingest"))
+	assert.Nil(t, err)
+
+	// REST events carry the querystring as a map, so its order is lost.
+	queries := map[string]string{
+		"testdata/rest.json": "email=REDACTED&eventid=42",
+		"testdata/http.json": "eventid=42&email=REDACTED",
+	}
+
+	for _, file := range []string{"testdata/rest.json", "testdata/http.json"} {
+		t.Run(file, func(t *testing.T) {
+			payload, err := ioutil.ReadFile(file)
+			assert.Nil(t, err)
+
+			result, err := handler.Handle(context.Background(), payload)
+			assert.Nil(t, err)
+
+			var response Response
+			assert.Nil(t, json.Unmarshal(result, &response))
+
+			assert.Equal(t, "/ingest/post", received.URL.Path)
+			assert.Equal(t, queries[file], received.URL.RawQuery)
+			assert.Equal(t, `{"email":"REDACTED","event_id":42}`, receivedBody)
+			assert.Equal(t, "1", received.Header.Get(redactor.RedactedHeader))
+
+			assert.Equal(t, http.StatusOK, response.StatusCode)
+			assert.Equal(t, `{"email":"REDACTED","ok":true}`, response.Body)
+			assert.False(t, response.IsBase64Encoded)
+
+			if file == "testdata/http.json" {
+				assert.Equal(t, []string{"a=1"}, response.Cookies)
+			} else {
+				assert.Equal(t, "a=1", response.Headers["Set-Cookie"])
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package lambda
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// The version of the Lambda Runtime API we speak.
+const runtimeAPIVersion = "2018-06-01"
+
+// Runtime polls the Lambda Runtime API for events and posts back the results,
+// which lets the proxy binary run as a custom runtime (`provided.al2`) without
+// depending on the AWS SDK.
+type Runtime struct {
+	// The host and port of the Runtime API, e.g. from AWS_LAMBDA_RUNTIME_API.
+	API    string
+	Client *http.Client
+}
+
+// NewRuntime returns a Runtime for the API advertised by the environment.
+func NewRuntime() (*Runtime, error) {
+	api := os.Getenv("AWS_LAMBDA_RUNTIME_API")
+	if api == "" {
+		return nil, fmt.Errorf("AWS_LAMBDA_RUNTIME_API is not set; not running in Lambda?")
+	}
+
+	return &Runtime{API: api, Client: http.DefaultClient}, nil
+}
+
+// Returns the Runtime API URL for `path`.
+func (rt *Runtime) url(path string) string {
+	return "http://" + rt.API + "/" + runtimeAPIVersion + "/runtime/invocation/" + path
+}
+
+// Serve handles events forever, returning only if the Runtime API can't be
+// reached.
+func (rt *Runtime) Serve(handler *Handler) error {
+	for {
+		err := rt.next(handler)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Fetches and handles a single event.
+func (rt *Runtime) next(handler *Handler) error {
+	resp, err := rt.Client.Get(rt.url("next"))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("runtime API returned %s", resp.Status)
+	}
+
+	payload, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	requestID := resp.Header.Get("Lambda-Runtime-Aws-Request-Id")
+
+	ctx := context.Background()
+	deadline, err := strconv.ParseInt(resp.Header.Get("Lambda-Runtime-Deadline-Ms"), 10, 64)
+	if err == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, time.Unix(0, deadline*int64(time.Millisecond)))
+		defer cancel()
+	}
+
+	result, err := handler.Handle(ctx, payload)
+	if err != nil {
+		result, _ = json.Marshal(map[string]string{
+			"errorMessage": err.Error(),
+			"errorType":    fmt.Sprintf("%T", err),
+		})
+		return rt.post(requestID+"/error", result)
+	}
+
+	return rt.post(requestID+"/response", result)
+}
+
+// Posts a result back to the Runtime API.
+func (rt *Runtime) post(path string, body []byte) error {
+	resp, err := rt.Client.Post(rt.url(path), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("runtime API returned %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package lambda
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntimeServe(t *testing.T) {
+	events := []string{`{"httpMethod": "POST", "path": "/post", "headers": {"Content-Type": "application/json"}, "body": "{\"a\": 1}"}`, `nope`}
+	results := map[string]string{}
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/2018-06-01/runtime/invocation/next":
+			if len(events) == 0 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Lambda-Runtime-Aws-Request-Id", strings.Repeat("x", len(events)))
+			w.Write([]byte(events[0]))
+			events = events[1:]
+		default:
+			body, _ := ioutil.ReadAll(r.Body)
+			results[r.URL.Path] = string(body)
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer api.Close()
+
+	handler, err := NewHandler(makeConfig(""))
+	assert.Nil(t, err)
+
+	runtime := &Runtime{API: strings.TrimPrefix(api.URL, "http://"), Client: http.DefaultClient}
+	err = runtime.Serve(handler)
+	assert.NotNil(t, err)
+
+	assert.Contains(t, results["/2018-06-01/runtime/invocation/xx/response"], `"body":"{\"a\":0}"`)
+	assert.Contains(t, results["/2018-06-01/runtime/invocation/x/error"], `"errorMessage"`)
+}
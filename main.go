@@ -2,11 +2,13 @@
 // redacts all data from HTTP querystrings and request bodies while preserving
 // the shape of the data.  By specifying a whitelist in a config file, certain
 // data can be allowed to pass through unaffected.
+//
+// The redacting logic itself lives in the redactor package; this program is
+// a thin host around it.
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -15,246 +17,444 @@ import (
 	"net/url"
 	"os"
 	"path"
-	"strconv"
-	"strings"
-
+	"time"
+
+	"github.com/button/privacy-proxy/admin"
+	"github.com/button/privacy-proxy/control"
+	"github.com/button/privacy-proxy/detokenize"
+	"github.com/button/privacy-proxy/lambda"
+	"github.com/button/privacy-proxy/pipeline"
+	"github.com/button/privacy-proxy/redactor"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
-// What we redact a value, we overwrite it with these, depending on type.
-const (
-	RedactedStr    = "REDACTED"
-	RedactedNumber = 0.0
-	RedactedBool   = false
-)
+// Merge a source URL onto a destination URL.  For example, if:
+//
+// source = /v1/users?a=2#anchor
+// destination = /upstream
+//
+// then mergeUrl returns
+//
+// /upstream/v1/users?a=2#anchor
+//
+// mergeURL returns a new url.URL instance, it does not mutate its arguments.
+func mergeURL(destination *url.URL, source *url.URL) url.URL {
+	result := *destination
 
-// Supported content types
-const (
-	JSON = "application/json"
-)
+	result.Path = path.Join(destination.Path, source.Path)
+	result.RawQuery = source.RawQuery
+	result.Fragment = source.Fragment
 
-// Returns true iff two strings are equivalent regardless of trailing slashes
-func isSamePath(a string, b string) bool {
-	return strings.TrimRight(a, "/") == strings.TrimRight(b, "/")
+	return result
 }
 
-// Returns true iff two strings are equal regardless of case
-func isSameCaseInsensitive(a string, b string) bool {
-	return strings.ToLower(a) == strings.ToLower(b)
+// A director is used to handle the reading and potential re-writing of a
+// request we're proxying.
+func makeDirector(config redactor.Config) (func(*http.Request), error) {
+	compiled, err := redactor.Compile(config)
+	if err != nil {
+		return func(r *http.Request) {}, err
+	}
+
+	return makeReloadingDirector(config.ProxyPass, func() *redactor.Redactor {
+		return compiled
+	})
 }
 
-// Redacts any non-whitelisted key locations from `value`.  If a key is
-// whitelisted, the entire value of that key is passed through.
-//
-// Returns a redacted copy of `value`, does not mutate.
-func redact(match HTTPMatch, value interface{}, locationPrefix string) interface{} {
-	if match.HasBodyWhitelistMatch(locationPrefix) {
-		return value
+// Like makeDirector, but each request is redacted by whichever redactor
+// `current` returns, so rules can be swapped while the proxy is running.
+func makeReloadingDirector(proxyPass string, current func() *redactor.Redactor) (func(*http.Request), error) {
+	targetURL, err := url.Parse(proxyPass)
+	if err != nil {
+		return func(r *http.Request) {}, err
 	}
 
-	switch typedValue := value.(type) {
-	case map[string]interface{}:
-		m := make(map[string]interface{})
-		for k, v := range typedValue {
-			m[k] = redact(match, v, locationPrefix+"."+k)
-		}
-		return m
-	case []interface{}:
-		m := make([]interface{}, len(typedValue))
-		for k, v := range typedValue {
-			m[k] = redact(match, v, locationPrefix+"["+strconv.Itoa(k)+"]")
+	return func(r *http.Request) {
+		compiled := current()
+
+		originalURL := r.URL
+
+		var redactResponse responseRedactor
+
+		if redactor.IsGRPC(r.Header) {
+			compiled.RedactGRPCRequest(originalURL.Path, r)
+
+			redactResponse = func(resp *http.Response) error {
+				compiled.RedactGRPCResponse(originalURL.Path, resp)
+				return nil
+			}
+		} else {
+			// Find the first matching HTTP ruleset from the config to use
+			// for filtering the request.
+			ruleMatch := compiled.Match(r.Method, originalURL.EscapedPath())
+
+			err := redactor.RedactRequest(ruleMatch, r)
+			if err != nil {
+				fmt.Println(err)
+			}
+
+			redactResponse = func(resp *http.Response) error {
+				return redactor.RedactResponse(ruleMatch, resp)
+			}
 		}
-		return m
-	case float64:
-		return RedactedNumber
-	case string:
-		return RedactedStr
-	case bool:
-		return RedactedBool
-	case nil:
-		return nil
-	default:
-		return nil
-	}
+
+		// The path is redacted before it's merged, so match clauses see the
+		// path as it was requested.
+		upsteamURL := mergeURL(targetURL, r.URL)
+
+		r.URL = &upsteamURL
+		r.Host = r.URL.Host
+
+		// The response is filtered by the same ruleset as the request.
+		*r = *r.WithContext(context.WithValue(r.Context(), responseRedactorKey{}, redactResponse))
+
+		r.Header.Add(redactor.RedactedHeader, "1")
+	}, nil
 }
 
-// Maps a request body to a redacted version, preserving the "shape" of the
-// data.  Currently supports only the following content-types:
-//
-// * application/json
-//
-// If the content-type isn't supported, zero bytes are returned.
-func mapBody(match HTTPMatch, contentType string, body []byte) ([]byte, error) {
-	newBody := []byte{}
+// Redacts the response to a proxied request.  Mutates resp.
+type responseRedactor func(resp *http.Response) error
 
-	if !isSameCaseInsensitive(contentType, JSON) {
-		return newBody, nil
+// Context key for the responseRedactor of a proxied request.
+type responseRedactorKey struct{}
+
+// Redacts the body of a proxied response if the request's match clause asks
+// for it.  Mutates resp.
+func modifyResponse(resp *http.Response) error {
+	redactResponse, ok := resp.Request.Context().Value(responseRedactorKey{}).(responseRedactor)
+	if !ok {
+		return nil
 	}
 
-	var parsed interface{}
-	err := json.Unmarshal(body, &parsed)
+	err := redactResponse(resp)
 	if err != nil {
-		return newBody, err
+		fmt.Println(err)
 	}
 
-	redacted := redact(match, parsed, "$")
+	return nil
+}
+
+// Routes gRPC calls, which require HTTP/2, over a transport that also speaks
+// HTTP/2 to plaintext upstreams.  Everything else uses `http`.
+type proxyTransport struct {
+	http http.RoundTripper
+	grpc http.RoundTripper
+}
 
-	newBody, err = json.Marshal(redacted)
-	if err != nil {
-		return []byte{}, err
+func (t proxyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if redactor.IsGRPC(r.Header) {
+		return t.grpc.RoundTrip(r)
 	}
 
-	return newBody, nil
+	return t.http.RoundTrip(r)
 }
 
-// Extract the content-type of the request, taking care to strip any charset
-// or boundary information (delimited by a ';' character).  Returns the empty
-// string if not found.
-//
-// e.g. getContentType("application/diggy; charset=utf8")
-//   => "application/diggy"
-func getContentType(r *http.Request) string {
-	headerValue := r.Header.Get("Content-Type")
-	if headerValue == "" {
-		return ""
-	}
+// Returns a transport for proxying both HTTP requests and gRPC calls.
+func makeTransport() http.RoundTripper {
+	protocols := &http.Protocols{}
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+
+	grpcTransport := http.DefaultTransport.(*http.Transport).Clone()
+	grpcTransport.Protocols = protocols
 
-	headerValueSplit := strings.Split(headerValue, ";")
-	return headerValueSplit[0]
+	return proxyTransport{http: http.DefaultTransport, grpc: grpcTransport}
 }
 
-// Redact values from the request body unless the key location is whitelisted
-// in the config.  If the type of the body can't be inferred, the body will be
-// set to zero bytes.  Mutates r.
-func redactBody(ruleMatch HTTPMatch, r *http.Request) error {
-	if r.Body == nil {
-		return nil
+// Runs the reverse proxy described by the config file at `configPath`.
+func serve(configPath string) {
+	config := redactor.Config{}
+	err := redactor.LoadConfig(configPath, &config)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	body, err := ioutil.ReadAll(r.Body)
+	var current func() *redactor.Redactor
+	var state func() admin.State
 
+	if config.Control != nil {
+		// Rules are pulled from the control plane.
+		var client *control.Client
+		client, err = control.NewClient(config)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		go client.Run(context.Background())
+
+		current = client.Redactor
+		state = func() admin.State {
+			return admin.State{Redactor: client.Redactor(), Version: client.Version(), LoadedAt: client.LoadedAt()}
+		}
+	} else {
+		var compiled *redactor.Redactor
+		compiled, err = redactor.Compile(config)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		loadedAt := time.Now()
+		current = func() *redactor.Redactor { return compiled }
+		state = func() admin.State {
+			return admin.State{Redactor: compiled, LoadedAt: loadedAt}
+		}
+	}
+
+	director, err := makeReloadingDirector(config.ProxyPass, current)
 	if err != nil {
-		return err
+		log.Fatal(err)
+	}
+	proxy := &httputil.ReverseProxy{
+		Director:       director,
+		ModifyResponse: modifyResponse,
+		Transport:      makeTransport(),
 	}
 
-	redactedBody := []byte{}
-	contentType := getContentType(r)
+	port := config.Port
+	if port == "" {
+		port = "8888"
+	}
 
-	if contentType != "" {
-		redactedBody, err = mapBody(ruleMatch, contentType, body)
+	if config.ProxyPass == "" {
+		log.Fatal("Must specify backend server as `proxy_pass` in " + configPath)
 	}
 
-	contentLength := len(redactedBody)
+	// gRPC clients speak HTTP/2, usually without TLS.
+	protocols := &http.Protocols{}
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
 
-	r.Body = ioutil.NopCloser(bytes.NewReader(redactedBody))
-	r.Header.Set("Content-Length", strconv.Itoa(contentLength))
-	r.ContentLength = int64(contentLength)
+	server := &http.Server{Addr: ":" + port, Handler: proxy, Protocols: protocols}
 
-	return err
-}
+	if config.Admin != nil {
+		address := config.Admin.Address
+		if address == "" {
+			address = admin.DefaultAddress
+		}
 
-// Redact values from the querystring unless the key was whitelisted in the
-// config.  Returns a string that can be assigned to any url.URL's RawQuery
-// property.
-func redactQuerystring(ruleMatch HTTPMatch, u *url.URL) string {
-	queryValues := url.Values{}
-
-	for k, values := range u.Query() {
-		for _, v := range values {
-			value := RedactedStr
-			if ruleMatch.HasQuerystringWhitelistMatch(k) {
-				value = v
-			}
+		go func() {
+			log.Fatal(http.ListenAndServe(address, admin.NewHandler(state, config.Admin.Token)))
+		}()
 
-			queryValues.Add(k, value)
+		fmt.Println("Admin API listening on " + address + "...")
+	}
+
+	if config.Vault != nil && config.Vault.Token != "" {
+		vault, err := redactor.OpenVault(*config.Vault)
+		if err != nil {
+			log.Fatal(err)
 		}
+
+		address := config.Vault.Address
+		if address == "" {
+			address = detokenize.DefaultAddress
+		}
+
+		go func() {
+			log.Fatal(http.ListenAndServe(address, detokenize.NewHandler(vault, config.Vault.Token)))
+		}()
+
+		fmt.Println("Detokenize API listening on " + address + "...")
 	}
 
-	return queryValues.Encode()
+	fmt.Println("Privacy Proxy listening on " + port + "...")
+	err = server.ListenAndServe()
+	if err != nil {
+		log.Fatal(err)
+	}
 }
 
-// Merge a source URL onto a destination URL.  For example, if:
-//
-// source = /v1/users?a=2#anchor
-// destination = /upstream
-//
-// then mergeUrl returns
-//
-// /upstream/v1/users?a=2#anchor
-//
-// mergeURL returns a new url.URL instance, it does not mutate its arguments.
-func mergeURL(destination *url.URL, source *url.URL) url.URL {
-	result := *destination
+// Runs a control plane serving the configs in `storeDir`, signed with the
+// private key in `keyPath`.  Publishing requires `token`, and status reports
+// `statusToken`.
+func runControl(port string, keyPath string, storeDir string, token string, statusToken string) {
+	if token == "" {
+		log.Fatal("control: a --token is required to publish configs")
+	}
 
-	result.Path = path.Join(destination.Path, source.Path)
-	result.RawQuery = source.RawQuery
-	result.Fragment = source.Fragment
+	key, err := control.LoadPrivateKey(keyPath)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	return result
+	store, err := control.NewStore(storeDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server := control.NewServer(store, key, token, statusToken)
+
+	fmt.Println("Privacy Proxy control plane listening on " + port + "...")
+	log.Fatal(http.ListenAndServe(":"+port, server))
 }
 
-// A director is used to handle the reading and potential re-writing of a
-// request we're proxying.
-func makeDirector(config Config) (func(*http.Request), error) {
-	targetURL, err := url.Parse(config.ProxyPass)
+// Runs as an AWS Lambda custom runtime, or handles the single event in
+// `eventPath` if given.
+func runLambda(configPath string, eventPath string) {
+	config := redactor.Config{}
+	err := redactor.LoadConfig(configPath, &config)
 	if err != nil {
-		return func(r *http.Request) {}, err
+		log.Fatal(err)
 	}
 
-	return func(r *http.Request) {
-		originalURL := r.URL
-		upsteamURL := mergeURL(targetURL, r.URL)
-
-		r.URL = &upsteamURL
-		r.Host = r.URL.Host
-		r.Header.Add("x-privacy-proxy-redacted", "1")
+	handler, err := lambda.NewHandler(config)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		// Find the first matching HTTP ruleset from the config to use
-		// for filtering the request.
-		ruleMatch := config.FindHTTPMatch(r.Method, originalURL.Path)
+	if eventPath != "" {
+		payload, err := ioutil.ReadFile(eventPath)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-		err = redactBody(ruleMatch, r)
+		result, err := handler.Handle(context.Background(), payload)
 		if err != nil {
-			fmt.Println(err)
+			log.Fatal(err)
 		}
 
-		r.URL.RawQuery = redactQuerystring(ruleMatch, r.URL)
-	}, nil
-}
+		fmt.Printf("%s\n", result)
+		return
+	}
 
-func main() {
-	var (
-		app        = kingpin.New("privacy-proxy", "A Data-Redacting Reverse Proxy")
-		configPath = app.Arg("config", "An HCL formatted config file").Required().String()
-	)
+	runtime, err := lambda.NewRuntime()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	kingpin.Version("0.0.1")
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+	log.Fatal(runtime.Serve(handler))
+}
 
-	config := Config{}
-	err := loadConfig(*configPath, &config)
+// Runs a redaction pipeline between JSON-lines files, defaulting to stdin and
+// stdout.
+func runPipeline(configPath string, inPath string, outPath string, topic string) {
+	config := redactor.Config{}
+	err := redactor.LoadConfig(configPath, &config)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	director, err := makeDirector(config)
+	compiled, err := redactor.Compile(config)
 	if err != nil {
 		log.Fatal(err)
 	}
-	proxy := &httputil.ReverseProxy{Director: director}
 
-	port := config.Port
-	if port == "" {
-		port = "8888"
+	in := os.Stdin
+	if inPath != "" {
+		in, err = os.Open(inPath)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	if config.ProxyPass == "" {
-		log.Fatal("Must specify backend server as `proxy_pass` in " + *configPath)
+	out := os.Stdout
+	if outPath != "" {
+		out, err = os.Create(outPath)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	fmt.Println("Privacy Proxy listening on " + port + "...")
-	err = http.ListenAndServe(":"+port, proxy)
+	source := pipeline.NewFileSource(in, topic, config.ContentTypes)
+	defer source.Close()
+
+	sink := pipeline.NewFileSink(out, topic != "", config.ContentTypes)
+	defer sink.Close()
+
+	err = pipeline.Run(context.Background(), compiled, source, sink)
 	if err != nil {
 		log.Fatal(err)
 	}
 }
+
+func main() {
+	var (
+		app = kingpin.New("privacy-proxy", "A Data-Redacting Reverse Proxy")
+
+		serveCmd   = app.Command("serve", "Run the reverse proxy (default)").Default()
+		configPath = serveCmd.Arg("config", "An HCL formatted config file").Required().String()
+
+		redactCmd         = app.Command("redact", "Redact documents from files or stdin, writing to stdout")
+		redactConfigPath  = redactCmd.Flag("config", "An HCL formatted config file").Required().String()
+		redactMethod      = redactCmd.Flag("method", "The HTTP method used to select a match clause").String()
+		redactPath        = redactCmd.Flag("path", "The pathname used to select a match clause").String()
+		redactContentType = redactCmd.Flag("content-type", "The content-type of the documents").Default(redactor.JSON).String()
+		redactQuery       = redactCmd.Flag("query", "Redact this querystring instead of reading documents").String()
+		redactLines       = redactCmd.Flag("lines", "Read JSON-lines input, one document per line").Bool()
+		redactFiles       = redactCmd.Arg("files", "Files to redact (default: stdin)").ExistingFiles()
+
+		decryptCmd     = app.Command("decrypt", "Decrypt the values encrypted by encrypt rules in JSON documents from files or stdin")
+		decryptKeyring = decryptCmd.Flag("keyring", "The keyring file the values were encrypted with").Required().ExistingFile()
+		decryptLines   = decryptCmd.Flag("lines", "Read JSON-lines input, one document per line").Bool()
+		decryptFiles   = decryptCmd.Arg("files", "Files to decrypt (default: stdin)").ExistingFiles()
+
+		lambdaCmd        = app.Command("lambda", "Run as an AWS Lambda custom runtime behind API Gateway")
+		lambdaConfigPath = lambdaCmd.Arg("config", "An HCL formatted config file").Required().String()
+		lambdaEvent      = lambdaCmd.Flag("event", "Handle a single API Gateway event from this file and print the result").ExistingFile()
+
+		pipelineCmd        = app.Command("pipeline", "Redact queue messages read as JSON lines from a file or stdin")
+		pipelineConfigPath = pipelineCmd.Arg("config", "An HCL formatted config file").Required().String()
+		pipelineIn         = pipelineCmd.Flag("in", "File to read messages from (default: stdin)").ExistingFile()
+		pipelineOut        = pipelineCmd.Flag("out", "File to write redacted messages to (default: stdout)").String()
+		pipelineTopic      = pipelineCmd.Flag("topic", "Read and write raw payloads on this topic instead of message envelopes").String()
+
+		controlCmd         = app.Command("control", "Run a control plane serving signed configs to proxies")
+		controlPort        = controlCmd.Flag("port", "The TCP port to listen on").Default("9999").String()
+		controlKey         = controlCmd.Flag("key", "A PEM encoded ed25519 private key to sign configs with").Required().ExistingFile()
+		controlStore       = controlCmd.Flag("store", "Directory to keep published configs in (default: memory only)").String()
+		controlToken       = controlCmd.Flag("token", "Bearer token required to publish configs").Envar("PRIVACY_PROXY_CONTROL_TOKEN").String()
+		controlStatusToken = controlCmd.Flag("status-token", "Bearer token required to report status (default: reports are refused)").Envar("PRIVACY_PROXY_CONTROL_STATUS_TOKEN").String()
+	)
+
+	kingpin.Version("0.0.1")
+
+	switch kingpin.MustParse(app.Parse(os.Args[1:])) {
+	case serveCmd.FullCommand():
+		serve(*configPath)
+
+	case redactCmd.FullCommand():
+		config := redactor.Config{}
+		err := redactor.LoadConfig(*redactConfigPath, &config)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		options := redactOptions{
+			Method:      *redactMethod,
+			Path:        *redactPath,
+			ContentType: *redactContentType,
+			Query:       *redactQuery,
+			Lines:       *redactLines,
+		}
+
+		compiled, err := redactor.Compile(config)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = runRedact(compiled, options, *redactFiles, os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+	case decryptCmd.FullCommand():
+		keyring, err := redactor.LoadKeyring(*decryptKeyring)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = runDecrypt(keyring, *decryptLines, *decryptFiles, os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+	case lambdaCmd.FullCommand():
+		runLambda(*lambdaConfigPath, *lambdaEvent)
+
+	case pipelineCmd.FullCommand():
+		runPipeline(*pipelineConfigPath, *pipelineIn, *pipelineOut, *pipelineTopic)
+
+	case controlCmd.FullCommand():
+		runControl(*controlPort, *controlKey, *controlStore, *controlToken, *controlStatusToken)
+	}
+}
@@ -1,22 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"strconv"
 	"strings"
 	"testing"
 
+	"github.com/button/privacy-proxy/redactor"
 	"github.com/stretchr/testify/assert"
 )
 
-func makeBodyMatch(rules ...ConfigRule) HTTPMatch {
-	return HTTPMatch{RuleOptions: RuleOptions{Body: rules}}
-}
-
-func makeQuerystringMatch(rules ...ConfigRule) HTTPMatch {
-	return HTTPMatch{RuleOptions: RuleOptions{Querystring: rules}}
+func makeBodyMatch(rules ...redactor.ConfigRule) redactor.HTTPMatch {
+	return redactor.HTTPMatch{RuleOptions: redactor.RuleOptions{Body: rules}}
 }
 
 func makeRequest(body string, contentType string) *http.Request {
@@ -29,39 +27,6 @@ func makeRequest(body string, contentType string) *http.Request {
 	return request
 }
 
-func TestIsSamePath(t *testing.T) {
-	type testCase struct {
-		name string
-		a    string
-		b    string
-		out  bool
-	}
-
-	cases := []testCase{
-		{name: "with exact matches", a: "/v1", b: "/v1", out: true},
-		{name: "with trailing slashes", a: "/v1", b: "/v1/", out: true},
-		{name: "with trailing slashes", a: "/v1//", b: "/v1/", out: true},
-		{name: "with trailing slashes and different paths", a: "/v2", b: "/v1", out: false},
-	}
-
-	for _, c := range cases {
-		t.Run(c.name, func(t *testing.T) {
-			match := isSamePath(c.a, c.b)
-			assert.Equal(t, match, c.out)
-		})
-	}
-}
-
-func TestIsSameCaseInsensitive(t *testing.T) {
-	t.Log("Running with equavalent strings")
-	isSame := isSameCaseInsensitive("aba", "aBa")
-	assert.True(t, isSame)
-
-	t.Log("Running with non-equavalent strings")
-	isNotSame := isSameCaseInsensitive("aca", "aBa")
-	assert.False(t, isNotSame)
-}
-
 func TestMergeUrl(t *testing.T) {
 	type testCase struct {
 		name        string
@@ -99,236 +64,6 @@ func TestMergeUrl(t *testing.T) {
 	}
 }
 
-func TestRedact(t *testing.T) {
-	type testCase struct {
-		name  string
-		match HTTPMatch
-		value interface{}
-		out   interface{}
-	}
-
-	cases := []testCase{
-		{
-			name:  "with a number",
-			match: makeBodyMatch(),
-			value: 10.0,
-			out:   0.0,
-		},
-		{
-			name:  "with nil",
-			match: makeBodyMatch(),
-			value: nil,
-			out:   nil,
-		},
-		{
-			name:  "with an unsupported value",
-			match: makeBodyMatch(),
-			value: 12,
-			out:   nil,
-		},
-		{
-			name:  "with a string",
-			match: makeBodyMatch(),
-			value: "data",
-			out:   "REDACTED",
-		},
-		{
-			name:  "with a boolean",
-			match: makeBodyMatch(),
-			value: true,
-			out:   false,
-		},
-		{
-			name:  "with a slice of values",
-			match: makeBodyMatch(),
-			value: []interface{}{"a", 20.0, true},
-			out:   []interface{}{"REDACTED", 0.0, false},
-		},
-		{
-			name:  "with a map of values",
-			match: makeBodyMatch(),
-			value: map[string]interface{}{"string": "data", "bool": true},
-			out:   map[string]interface{}{"string": "REDACTED", "bool": false},
-		},
-		{
-			name:  "with a map of values",
-			match: makeBodyMatch(),
-			value: map[string]interface{}{"string": "data", "bool": true},
-			out:   map[string]interface{}{"string": "REDACTED", "bool": false},
-		},
-		{
-			name:  "with a map of values that are themselves containers",
-			match: makeBodyMatch(),
-			value: map[string]interface{}{"array": []interface{}{"str1", "str2"}},
-			out:   map[string]interface{}{"array": []interface{}{"REDACTED", "REDACTED"}},
-		},
-		{
-			name:  "with a whitelist",
-			match: makeBodyMatch(ConfigRule{Whitelist: "$.bleep"}, ConfigRule{Whitelist: "$.array[0]"}),
-			value: map[string]interface{}{"array": []interface{}{"str1", "str2"}},
-			out:   map[string]interface{}{"array": []interface{}{"str1", "REDACTED"}},
-		},
-		{
-			name:  "with a whitelist that matches two keys",
-			match: makeBodyMatch(ConfigRule{Whitelist: "$.bleep"}, ConfigRule{Whitelist: "$.array[0]"}),
-			value: map[string]interface{}{"array": []interface{}{"str1", "str2"}, "bleep": "bloop"},
-			out:   map[string]interface{}{"array": []interface{}{"str1", "REDACTED"}, "bleep": "bloop"},
-		},
-		{
-			name:  "with a wildcard whitelist",
-			match: makeBodyMatch(ConfigRule{Whitelist: "$.array[*]"}),
-			value: map[string]interface{}{"array": []interface{}{"str1", "str2"}},
-			out:   map[string]interface{}{"array": []interface{}{"str1", "str2"}},
-		},
-	}
-
-	for _, c := range cases {
-		t.Run(c.name, func(t *testing.T) {
-			value := redact(c.match, c.value, "$")
-			assert.Equal(t, c.out, value)
-		})
-	}
-}
-
-func TestMapBody(t *testing.T) {
-	type testCase struct {
-		name  string
-		match HTTPMatch
-		body  string
-		out   string
-	}
-
-	cases := []testCase{
-		{
-			name:  "with a basic body",
-			match: makeBodyMatch(),
-			body:  `{"a": "bloop"}`,
-			out:   `{"a":"REDACTED"}`,
-		},
-		{
-			name:  "with a basic body and a whitelist",
-			match: makeBodyMatch(ConfigRule{Whitelist: "$.a"}),
-			body:  `{"a": "bloop", "b": [true, "hey"]}`,
-			out:   `{"a":"bloop","b":[false,"REDACTED"]}`,
-		},
-	}
-
-	for _, c := range cases {
-		t.Run(c.name, func(t *testing.T) {
-			result, err := mapBody(c.match, "application/json", []byte(c.body))
-			if err != nil {
-				t.Fail()
-			}
-			assert.Equal(t, string(result[:]), c.out)
-		})
-	}
-}
-
-func TestMapBodyWithWrongContentType(t *testing.T) {
-	body := []byte("{ query: { id } }")
-	result, err := mapBody(HTTPMatch{}, "application/graphql", body)
-	if err != nil {
-		t.Fail()
-	}
-	assert.Equal(t, result, []byte{})
-}
-
-func TestGetContentType(t *testing.T) {
-	request, err := http.NewRequest("GET", "", strings.NewReader(""))
-	if err != nil {
-		t.Fail()
-	}
-
-	request.Header.Add("Content-Type", "application/json; charset=utf8")
-	result := getContentType(request)
-	assert.Equal(t, result, "application/json")
-}
-
-func TestRedactBody(t *testing.T) {
-	type testCase struct {
-		name         string
-		match        HTTPMatch
-		request      *http.Request
-		expectedBody string
-	}
-
-	cases := []testCase{
-		{
-			name:         "with an empty JSON body",
-			match:        HTTPMatch{},
-			request:      makeRequest(`{}`, "application/json"),
-			expectedBody: "{}",
-		},
-		{
-			name:         "with a non-empty JSON body",
-			match:        HTTPMatch{},
-			request:      makeRequest(`{"a": "data"}`, "application/json"),
-			expectedBody: `{"a":"REDACTED"}`,
-		},
-	}
-
-	for _, c := range cases {
-		t.Run(c.name, func(t *testing.T) {
-			err := redactBody(c.match, c.request)
-			if err != nil {
-				t.Fail()
-			}
-
-			body, err := ioutil.ReadAll(c.request.Body)
-			if err != nil {
-				t.Fail()
-			}
-
-			assert.Equal(t, string(body[:]), c.expectedBody)
-			assert.Equal(t, strconv.FormatInt(c.request.ContentLength, 10), c.request.Header.Get("Content-Length"))
-			assert.Equal(t, c.request.ContentLength, int64(len(body)))
-		})
-	}
-}
-
-func TestRedactQuerystring(t *testing.T) {
-	type testCase struct {
-		name  string
-		match HTTPMatch
-		in    url.URL
-		out   string
-	}
-
-	cases := []testCase{
-		{
-			name:  "with empty query",
-			match: HTTPMatch{},
-			in:    url.URL{RawQuery: ""},
-			out:   "",
-		},
-		{
-			name:  "with a query with no whitelist",
-			match: HTTPMatch{},
-			in:    url.URL{RawQuery: "a=2&b=3"},
-			out:   "a=REDACTED&b=REDACTED",
-		},
-		{
-			name:  "with a query with a single whitelist value",
-			match: makeQuerystringMatch(ConfigRule{Whitelist: "a"}),
-			in:    url.URL{RawQuery: "a=2&b=3"},
-			out:   "a=2&b=REDACTED",
-		},
-		{
-			name:  "with a query with many whitelist values",
-			match: makeQuerystringMatch(ConfigRule{Whitelist: "a"}, ConfigRule{Whitelist: "b"}),
-			in:    url.URL{RawQuery: "a=2&b=3&c=2"},
-			out:   "a=2&b=3&c=REDACTED",
-		},
-	}
-
-	for _, c := range cases {
-		t.Run(c.name, func(t *testing.T) {
-			result := redactQuerystring(c.match, &c.in)
-			assert.Equal(t, result, c.out)
-		})
-	}
-}
-
 func TestMakeDirectory(t *testing.T) {
 	makeRequestWithExtras := func(method string, path string, query string, body string) *http.Request {
 		request := makeRequest(body, "application/json")
@@ -340,29 +75,32 @@ func TestMakeDirectory(t *testing.T) {
 		return request
 	}
 
-	config := Config{
+	config := redactor.Config{
 		ProxyPass: "https://api.usebutton.com/ingest",
-		Match: MatchOptions{
-			HTTP: []HTTPMatch{
-				HTTPMatch{
+		Match: redactor.MatchOptions{
+			HTTP: []redactor.HTTPMatch{
+				redactor.HTTPMatch{
 					Path:   "/v1/whitelist",
 					Method: "GET",
-					RuleOptions: RuleOptions{
-						Body: []ConfigRule{
-							ConfigRule{
+					RuleOptions: redactor.RuleOptions{
+						Body: []redactor.ConfigRule{
+							redactor.ConfigRule{
 								Whitelist: "$.a.b",
 							},
-							ConfigRule{
+							redactor.ConfigRule{
 								Whitelist: "$.a.c",
 							},
 						},
-						Querystring: []ConfigRule{
-							ConfigRule{
+						Querystring: []redactor.ConfigRule{
+							redactor.ConfigRule{
 								Whitelist: "a",
 							},
 						},
 					},
 				},
+				redactor.HTTPMatch{
+					Path: "/users/{id}/orders",
+				},
 			},
 		},
 	}
@@ -414,6 +152,22 @@ func TestMakeDirectory(t *testing.T) {
 			expectedBody: `{"a":{"b":0}}`,
 			expectedURL:  "https://api.usebutton.com/ingest/v2/whitelist?a=REDACTED",
 		},
+		{
+			name:         "with a path template",
+			request:      makeRequestWithExtras("GET", "/users/diggy@net.cool/orders", "", `{}`),
+			expectedBody: `{}`,
+			expectedURL:  "https://api.usebutton.com/ingest/users/REDACTED/orders",
+		},
+		{
+			name: "with a path template and an escaped slash",
+			request: func() *http.Request {
+				request := makeRequestWithExtras("GET", "/users/a/b/orders", "", `{}`)
+				request.URL.RawPath = "/users/a%2Fb/orders"
+				return request
+			}(),
+			expectedBody: `{}`,
+			expectedURL:  "https://api.usebutton.com/ingest/users/REDACTED/orders",
+		},
 	}
 
 	for _, c := range cases {
@@ -432,3 +186,137 @@ func TestMakeDirectory(t *testing.T) {
 		})
 	}
 }
+
+func TestModifyResponse(t *testing.T) {
+	config := redactor.Config{
+		ProxyPass: "https://api.usebutton.com/ingest",
+		Match: redactor.MatchOptions{
+			HTTP: []redactor.HTTPMatch{
+				redactor.HTTPMatch{
+					Path:           "/v1/response",
+					RedactResponse: true,
+					RuleOptions: redactor.RuleOptions{
+						Response: []redactor.ConfigRule{redactor.ConfigRule{Whitelist: "$.a"}},
+					},
+				},
+			},
+		},
+	}
+
+	director, _ := makeDirector(config)
+
+	type testCase struct {
+		name         string
+		path         string
+		expectedBody string
+	}
+
+	cases := []testCase{
+		{
+			name:         "with a match that redacts responses",
+			path:         "/v1/response",
+			expectedBody: `{"a":"data","b":"REDACTED"}`,
+		},
+		{
+			name:         "with no match",
+			path:         "/v2/response",
+			expectedBody: `{"a": "data", "b": "data"}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			request := makeRequest("{}", "application/json")
+			request.URL.Path = c.path
+			director(request)
+
+			resp := &http.Response{
+				Request: request,
+				Header:  http.Header{"Content-Type": []string{"application/json"}},
+				Body:    ioutil.NopCloser(strings.NewReader(`{"a": "data", "b": "data"}`)),
+			}
+
+			err := modifyResponse(resp)
+			assert.Nil(t, err)
+
+			body, err := ioutil.ReadAll(resp.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, c.expectedBody, string(body))
+		})
+	}
+}
+
+func TestModifyCompressedResponse(t *testing.T) {
+	config := redactor.Config{
+		ProxyPass: "https://api.usebutton.com/ingest",
+		Match: redactor.MatchOptions{
+			HTTP: []redactor.HTTPMatch{
+				redactor.HTTPMatch{
+					RedactResponse: true,
+					RuleOptions: redactor.RuleOptions{
+						Response: []redactor.ConfigRule{redactor.ConfigRule{Whitelist: "$.a"}},
+					},
+				},
+			},
+		},
+	}
+
+	director, _ := makeDirector(config)
+
+	request := makeRequest("{}", "application/json")
+	request.Header.Set("Accept-Encoding", "gzip")
+	director(request)
+
+	// The upstream may still compress its response, since it's redacted
+	// compressed.
+	assert.Equal(t, "gzip", request.Header.Get("Accept-Encoding"))
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte(`{"a": "data", "b": "data"}`))
+	writer.Close()
+
+	resp := &http.Response{
+		Request: request,
+		Header:  http.Header{"Content-Type": []string{"application/json"}, "Content-Encoding": []string{"gzip"}},
+		Body:    ioutil.NopCloser(&compressed),
+	}
+
+	assert.Nil(t, modifyResponse(resp))
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+
+	reader, err := gzip.NewReader(resp.Body)
+	assert.Nil(t, err)
+	body, err := ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a":"data","b":"REDACTED"}`, string(body))
+}
+
+func TestMakeReloadingDirector(t *testing.T) {
+	current := redactor.MustCompile(redactor.Config{})
+
+	director, err := makeReloadingDirector("https://api.usebutton.com/ingest", func() *redactor.Redactor {
+		return current
+	})
+	assert.Nil(t, err)
+
+	request := makeRequest(`{"a":"data"}`, "application/json")
+	director(request)
+	body, _ := ioutil.ReadAll(request.Body)
+	assert.Equal(t, `{"a":"REDACTED"}`, string(body))
+
+	t.Log("Running with swapped rules")
+	current = redactor.MustCompile(redactor.Config{
+		Match: redactor.MatchOptions{
+			HTTP: []redactor.HTTPMatch{makeBodyMatch(redactor.ConfigRule{Whitelist: "$.a"})},
+		},
+	})
+
+	request = makeRequest(`{"a":"data"}`, "application/json")
+	director(request)
+	body, _ = ioutil.ReadAll(request.Body)
+	assert.Equal(t, `{"a":"data"}`, string(body))
+
+	_, err = makeReloadingDirector("://", func() *redactor.Redactor { return current })
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,145 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/button/privacy-proxy/redactor"
+)
+
+// The largest single line we'll accept from a file source.
+const maxLineSize = 16 * 1024 * 1024
+
+// The JSON-lines representation of a message.  JSON payloads are embedded
+// as-is; any other payload is embedded as a string.
+type envelope struct {
+	Topic       string            `json:"topic,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Payload     json.RawMessage   `json:"payload"`
+}
+
+// Returns true iff a payload of the content-type is embedded as-is: if it
+// has none, or it's redacted as JSON under the config's `content_types`.
+func isJSONPayload(contentTypes map[string]string, contentType string) bool {
+	return contentType == "" || redactor.ContentHandler(contentTypes, contentType) == redactor.HandlerJSON
+}
+
+// FileSource reads messages from a file (or stdin), one per line.  If it has
+// a topic, every line is the raw payload of a message on that topic;
+// otherwise every line is a JSON envelope of the form:
+//
+//	{"topic": "events", "headers": {...}, "payload": {...}}
+type FileSource struct {
+	reader       io.ReadCloser
+	scanner      *bufio.Scanner
+	topic        string
+	contentTypes map[string]string
+	line         int
+}
+
+// NewFileSource returns a FileSource reading from `reader`.  `contentTypes`
+// are the config's `content_types`, which decide whose payloads are JSON.
+func NewFileSource(reader io.ReadCloser, topic string, contentTypes map[string]string) *FileSource {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	return &FileSource{reader: reader, scanner: scanner, topic: topic, contentTypes: contentTypes}
+}
+
+// Receive reads the next non-blank line.
+func (s *FileSource) Receive(ctx context.Context) (*Message, error) {
+	for s.scanner.Scan() {
+		s.line++
+
+		line := s.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		if s.topic != "" {
+			payload := make([]byte, len(line))
+			copy(payload, line)
+			return &Message{Topic: s.topic, Payload: payload}, nil
+		}
+
+		var e envelope
+		err := json.Unmarshal(line, &e)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", s.line, err)
+		}
+
+		msg := &Message{Topic: e.Topic, ContentType: e.ContentType, Headers: e.Headers, Payload: e.Payload}
+
+		if !isJSONPayload(s.contentTypes, e.ContentType) {
+			var payload string
+			err = json.Unmarshal(e.Payload, &payload)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s payload must be a string", s.line, e.ContentType)
+			}
+			msg.Payload = []byte(payload)
+		}
+
+		return msg, nil
+	}
+
+	if err := s.scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, io.EOF
+}
+
+// Ack is a no-op; files have nothing to acknowledge.
+func (s *FileSource) Ack(ctx context.Context, msg *Message) error {
+	return nil
+}
+
+func (s *FileSource) Close() error {
+	return s.reader.Close()
+}
+
+// FileSink writes messages to a file (or stdout), one per line.  If raw, only
+// each message's payload is written; otherwise each line is a JSON envelope
+// as read by FileSource.
+type FileSink struct {
+	writer       io.WriteCloser
+	raw          bool
+	contentTypes map[string]string
+}
+
+// NewFileSink returns a FileSink writing to `writer`.  `contentTypes` are the
+// config's `content_types`, as for NewFileSource.
+func NewFileSink(writer io.WriteCloser, raw bool, contentTypes map[string]string) *FileSink {
+	return &FileSink{writer: writer, raw: raw, contentTypes: contentTypes}
+}
+
+func (s *FileSink) Publish(ctx context.Context, msg *Message) error {
+	line := msg.Payload
+
+	if !s.raw {
+		e := envelope{Topic: msg.Topic, ContentType: msg.ContentType, Headers: msg.Headers, Payload: msg.Payload}
+
+		if len(msg.Payload) == 0 {
+			e.Payload = json.RawMessage("null")
+		} else if !isJSONPayload(s.contentTypes, msg.ContentType) {
+			e.Payload, _ = json.Marshal(string(msg.Payload))
+		}
+
+		var err error
+		line, err = json.Marshal(e)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(s.writer, "%s\n", line)
+	return err
+}
+
+func (s *FileSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,130 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestFileSource(t *testing.T) {
+	t.Log("Running with envelopes")
+	in := `{"topic": "events", "headers": {"a": "1"}, "payload": {"id": 1}}
+
+{"topic": "csv", "content_type": "text/csv", "payload": "a,b"}
+`
+	source := NewFileSource(ioutil.NopCloser(strings.NewReader(in)), "", nil)
+
+	msg, err := source.Receive(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, &Message{Topic: "events", Headers: map[string]string{"a": "1"}, Payload: []byte(`{"id": 1}`)}, msg)
+
+	msg, err = source.Receive(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, &Message{Topic: "csv", ContentType: "text/csv", Payload: []byte("a,b")}, msg)
+
+	_, err = source.Receive(context.Background())
+	assert.Equal(t, io.EOF, err)
+
+	t.Log("Running with a JSON payload with parameters")
+	in = `{"topic": "events", "content_type": "application/json; charset=utf-8", "payload": {"id": 1}}`
+	source = NewFileSource(ioutil.NopCloser(strings.NewReader(in)), "", nil)
+
+	msg, err = source.Receive(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, &Message{Topic: "events", ContentType: "application/json; charset=utf-8", Payload: []byte(`{"id": 1}`)}, msg)
+
+	t.Log("Running with raw payloads")
+	source = NewFileSource(ioutil.NopCloser(strings.NewReader("{\"id\": 1}\n{\"id\": 2}")), "events", nil)
+
+	msg, err = source.Receive(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, &Message{Topic: "events", Payload: []byte(`{"id": 1}`)}, msg)
+
+	msg, err = source.Receive(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, &Message{Topic: "events", Payload: []byte(`{"id": 2}`)}, msg)
+
+	t.Log("Running with an invalid envelope")
+	source = NewFileSource(ioutil.NopCloser(strings.NewReader("nope")), "", nil)
+
+	_, err = source.Receive(context.Background())
+	assert.Contains(t, err.Error(), "line 1:")
+}
+
+func TestFileSink(t *testing.T) {
+	type testCase struct {
+		name         string
+		raw          bool
+		contentTypes map[string]string
+		msg          *Message
+		out          string
+	}
+
+	cases := []testCase{
+		{
+			name: "with a JSON payload",
+			msg:  &Message{Topic: "events", Payload: []byte(`{"id":1}`)},
+			out:  "{\"topic\":\"events\",\"payload\":{\"id\":1}}\n",
+		},
+		{
+			name: "with an empty payload",
+			msg:  &Message{Topic: "events"},
+			out:  "{\"topic\":\"events\",\"payload\":null}\n",
+		},
+		{
+			name: "with a non-JSON payload",
+			msg:  &Message{Topic: "csv", ContentType: "text/csv", Payload: []byte("a,b")},
+			out:  "{\"topic\":\"csv\",\"content_type\":\"text/csv\",\"payload\":\"a,b\"}\n",
+		},
+		{
+			name: "with a JSON payload with parameters",
+			msg:  &Message{Topic: "events", ContentType: "application/json; charset=utf-8", Payload: []byte(`{"id":1}`)},
+			out:  "{\"topic\":\"events\",\"content_type\":\"application/json; charset=utf-8\",\"payload\":{\"id\":1}}\n",
+		},
+		{
+			name: "with a JSON suffix payload",
+			msg:  &Message{Topic: "events", ContentType: "application/vnd.x+json", Payload: []byte(`{"id":1}`)},
+			out:  "{\"topic\":\"events\",\"content_type\":\"application/vnd.x+json\",\"payload\":{\"id\":1}}\n",
+		},
+		{
+			name:         "with a payload mapped to JSON",
+			contentTypes: map[string]string{"Application/X-Amz-JSON-1.1": "json"},
+			msg:          &Message{Topic: "events", ContentType: "application/x-amz-json-1.1", Payload: []byte(`{"id":1}`)},
+			out:          "{\"topic\":\"events\",\"content_type\":\"application/x-amz-json-1.1\",\"payload\":{\"id\":1}}\n",
+		},
+		{
+			name:         "with a JSON suffix payload mapped to none",
+			contentTypes: map[string]string{"application/vnd.*": "none"},
+			msg:          &Message{Topic: "events", ContentType: "application/vnd.x+json", Payload: []byte(`{"id":1}`)},
+			out:          "{\"topic\":\"events\",\"content_type\":\"application/vnd.x+json\",\"payload\":\"{\\\"id\\\":1}\"}\n",
+		},
+		{
+			name: "with raw output",
+			raw:  true,
+			msg:  &Message{Topic: "events", Payload: []byte(`{"id":1}`)},
+			out:  "{\"id\":1}\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			sink := NewFileSink(nopWriteCloser{out}, c.raw, c.contentTypes)
+
+			err := sink.Publish(context.Background(), c.msg)
+			assert.Nil(t, err)
+			assert.Equal(t, c.out, out.String())
+		})
+	}
+}
@@ -0,0 +1,100 @@
+// Package pipeline hosts the redactor between message queues.  Messages are
+// consumed from a Source, redacted using the `match "queue"` clause selected
+// by their topic, and published to a Sink.
+//
+// Sources and sinks for specific brokers (Kafka, NATS, etc) only need to
+// implement the Source and Sink interfaces; a JSON-lines file implementation
+// of both is provided.
+package pipeline
+
+import (
+	"context"
+	"io"
+	"log"
+
+	"github.com/button/privacy-proxy/redactor"
+)
+
+// Message is a single message consumed from or published to a queue.
+type Message struct {
+	// The topic (or subject) the message was consumed from, used to select
+	// the match clause to redact it with.
+	Topic string
+
+	// The content-type of the payload, if the queue carries one.
+	ContentType string
+
+	Headers map[string]string
+	Payload []byte
+
+	// Broker-specific state a Source needs to acknowledge the message.
+	// Carried through redaction untouched.
+	Handle interface{}
+}
+
+// Source consumes messages from a queue.
+type Source interface {
+	// Receive blocks until a message is available.  It returns io.EOF once
+	// the source is exhausted.
+	Receive(ctx context.Context) (*Message, error)
+
+	// Ack acknowledges that a message received from the source has been
+	// redacted and published, so it won't be redelivered.
+	Ack(ctx context.Context, msg *Message) error
+
+	Close() error
+}
+
+// Sink publishes messages to a queue.
+type Sink interface {
+	Publish(ctx context.Context, msg *Message) error
+
+	Close() error
+}
+
+// Redact returns a redacted copy of a message.  If the payload can't be
+// parsed, it is replaced with zero bytes and the error returned, so a message
+// is never passed on unredacted.
+func Redact(r *redactor.Redactor, msg *Message) (*Message, error) {
+	match := r.QueueMatch(msg.Topic)
+
+	payload, err := redactor.MapMessage(match, msg.ContentType, msg.Payload)
+
+	return &Message{
+		Topic:       msg.Topic,
+		ContentType: msg.ContentType,
+		Headers:     redactor.RedactMessageHeaders(match, msg.Headers),
+		Payload:     payload,
+		Handle:      msg.Handle,
+	}, err
+}
+
+// Run consumes, redacts and publishes messages until the source is exhausted,
+// the context is cancelled, or a source or sink fails.  Each message is only
+// acknowledged once its redacted copy has been published.
+func Run(ctx context.Context, r *redactor.Redactor, source Source, sink Sink) error {
+	for {
+		msg, err := source.Receive(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		redacted, err := Redact(r, msg)
+		if err != nil {
+			log.Println(err)
+		}
+
+		err = sink.Publish(ctx, redacted)
+		if err != nil {
+			return err
+		}
+
+		err = source.Ack(ctx, msg)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/button/privacy-proxy/redactor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	config := redactor.Config{
+		Match: redactor.MatchOptions{
+			Queue: []redactor.QueueMatch{
+				redactor.QueueMatch{
+					Topic: "events",
+					RuleOptions: redactor.RuleOptions{
+						Body:   []redactor.ConfigRule{redactor.ConfigRule{Whitelist: "$.id"}},
+						Header: []redactor.ConfigRule{redactor.ConfigRule{Whitelist: "trace"}},
+					},
+				},
+			},
+		},
+	}
+
+	compiled, err := redactor.Compile(config)
+	assert.Nil(t, err)
+
+	in := `{"topic": "events", "headers": {"trace": "1", "user": "diggy"}, "payload": {"id": 1, "email": "diggy@net.cool"}}
+{"topic": "users", "payload": {"id": 1}}
+{"topic": "events", "payload": "not an object"}
+`
+	out := &bytes.Buffer{}
+
+	source := NewFileSource(ioutil.NopCloser(strings.NewReader(in)), "", nil)
+	sink := NewFileSink(nopWriteCloser{out}, false, nil)
+
+	err = Run(context.Background(), compiled, source, sink)
+	assert.Nil(t, err)
+
+	expected := `{"topic":"events","headers":{"trace":"1","user":"REDACTED"},"payload":{"email":"REDACTED","id":1}}
+{"topic":"users","payload":{"id":0}}
+{"topic":"events","payload":"REDACTED"}
+`
+	assert.Equal(t, expected, out.String())
+}
@@ -0,0 +1,224 @@
+package redactor
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Actions a rule may take on the values at its location.  The default,
+// ActionPass, passes them through; the rest replace them.
+const (
+	ActionPass     = "pass"
+	ActionLiteral  = "literal"
+	ActionNull     = "null"
+	ActionDrop     = "drop"
+	ActionMask     = "mask"
+	ActionFake     = "fake"
+	ActionTokenize = "tokenize"
+	ActionEncrypt  = "encrypt"
+	ActionJWT      = "jwt"
+
+	// Generalizations, which coarsen values rather than replace them (see
+	// generalize.go).
+	ActionTruncate     = "truncate"
+	ActionTruncateDate = "truncate_date"
+	ActionTruncateIP   = "truncate_ip"
+	ActionRound        = "round"
+	ActionBucket       = "bucket"
+)
+
+// Formats of the values generated by ActionFake.
+const (
+	FakeUUID  = "uuid"
+	FakeEmail = "email"
+	FakeDate  = "date"
+)
+
+// The character masked characters are replaced with.
+const maskChar = "*"
+
+// Date layouts recognized by fake dates, so the fake has the same layout as
+// the value it replaces.  The first is used for values in any other layout.
+var fakeDateLayouts = []string{"2006-01-02", time.RFC3339, "2006-01-02T15:04:05", "01/02/2006"}
+
+// The range fake dates are drawn from.
+var (
+	fakeDateStart = time.Date(1950, time.January, 1, 0, 0, 0, 0, time.UTC)
+	fakeDateEnd   = time.Date(2010, time.January, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// Returns the rule's action, defaulting to ActionPass, or actionDecode if the
+// rule decodes its values.
+func (r ConfigRule) action() string {
+	if r.Decode != "" {
+		return actionDecode
+	}
+
+	if r.Action == "" {
+		return ActionPass
+	}
+
+	return r.Action
+}
+
+// Returns an error if the rule's action or its options are invalid.
+func (r ConfigRule) validateAction() error {
+	switch r.action() {
+	case ActionPass, ActionNull, ActionDrop:
+		return nil
+	case ActionLiteral:
+		switch r.Value.(type) {
+		case string, int, float64, bool:
+			return nil
+		}
+		return fmt.Errorf("literal action needs a string, number or bool value")
+	case ActionMask:
+		if r.Keep < 0 {
+			return fmt.Errorf("mask action can't keep %d characters", r.Keep)
+		}
+		return nil
+	case ActionFake:
+		if r.hashKey == nil {
+			return fmt.Errorf("fake action needs a hash_key")
+		}
+		switch r.Format {
+		case FakeUUID, FakeEmail, FakeDate:
+			return nil
+		}
+		return fmt.Errorf("unknown fake format %q", r.Format)
+	case ActionTokenize:
+		if r.vault == nil {
+			return fmt.Errorf("tokenize action needs a vault")
+		}
+		return nil
+	case ActionEncrypt:
+		if r.keyring == nil {
+			return fmt.Errorf("encrypt action needs a keyring")
+		}
+		return nil
+	case ActionJWT:
+		return r.validateJWT()
+	case actionDecode:
+		return r.validateDecode()
+	case ActionTruncate, ActionTruncateDate, ActionTruncateIP, ActionRound, ActionBucket:
+		return r.validateGeneralization()
+	}
+
+	return fmt.Errorf("unknown action %q", r.Action)
+}
+
+// Returns an error if the rule can't apply to the plain strings of
+// querystrings, paths and cookies: if it replaces values with something other
+// than a string, which only bodies and headers can hold, or decodes them.
+func (r ConfigRule) validateStringAction() error {
+	if r.action() == ActionJWT && r.jwtMode() == JWTClaims {
+		return fmt.Errorf("jwt action in claims mode only works in bodies and headers")
+	}
+
+	if r.action() == actionDecode {
+		return fmt.Errorf("decode only works in bodies")
+	}
+
+	return nil
+}
+
+// Returns the replacement for a value matched by the rule, or false if the
+// action doesn't replace values of its type, in which case it's redacted as
+// usual.  Masks, fakes, tokens and JWTs only replace strings, whereas any value
+// (even an Object or Array) may be encrypted.  If a value can't be tokenized
+// or encrypted, the error is logged and it's redacted.  Not used for ActionPass
+// or ActionDrop, which keep or remove the value.
+func (r ConfigRule) replace(value interface{}) (interface{}, bool) {
+	switch r.action() {
+	case ActionLiteral:
+		return r.Value, true
+	case ActionNull:
+		return nil, true
+	case ActionEncrypt:
+		envelope, err := r.keyring.Encrypt(value)
+		if err != nil {
+			log.Println(err)
+			return nil, false
+		}
+		return envelope, true
+	case ActionTruncate, ActionTruncateDate, ActionTruncateIP, ActionRound, ActionBucket:
+		return r.generalize(value)
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return nil, false
+	}
+
+	switch r.action() {
+	case ActionMask:
+		return mask(s, r.Keep), true
+	case ActionFake:
+		return fake(r.hashKey, s, r.Format), true
+	case ActionTokenize:
+		token, err := r.vault.Tokenize(s)
+		if err != nil {
+			log.Println(err)
+			return nil, false
+		}
+		return token, true
+	case ActionJWT:
+		return r.replaceJWT(s)
+	}
+
+	return nil, false
+}
+
+// Masks all but the last `keep` characters of a string, preserving its
+// length, as in `****1234`.  Strings no longer than `keep` are masked
+// entirely.
+func mask(s string, keep int) string {
+	length := utf8.RuneCountInString(s)
+	if length <= keep {
+		return strings.Repeat(maskChar, length)
+	}
+
+	runes := []rune(s)
+	return strings.Repeat(maskChar, length-keep) + string(runes[length-keep:])
+}
+
+// Returns a valid-looking value of a format in place of a string.  The fake
+// is derived from a keyed hash of the string, so the same input always gets
+// the same fake (and so still joins across requests), but it can't be
+// reversed by faking guesses without the key.
+func fake(key []byte, s string, format string) string {
+	sum := keyedHash(key, s)
+
+	switch format {
+	case FakeUUID:
+		b := sum[:16]
+		b[6] = b[6]&0x0f | 0x40 // Version 4
+		b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+
+		h := hex.EncodeToString(b)
+		return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+
+	case FakeEmail:
+		return "user-" + hex.EncodeToString(sum[:6]) + "@example.com"
+
+	case FakeDate:
+		layout := fakeDateLayouts[0]
+		for _, l := range fakeDateLayouts {
+			if _, err := time.Parse(l, s); err == nil {
+				layout = l
+				break
+			}
+		}
+
+		days := uint64(fakeDateEnd.Sub(fakeDateStart).Hours() / 24)
+		seconds := binary.BigEndian.Uint64(sum[:8]) % (days * 24 * 60 * 60)
+		return fakeDateStart.Add(time.Duration(seconds) * time.Second).Format(layout)
+	}
+
+	return RedactedStr
+}
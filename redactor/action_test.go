@@ -0,0 +1,117 @@
+package redactor
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAction(t *testing.T) {
+	type testCase struct {
+		name  string
+		rule  ConfigRule
+		valid bool
+	}
+
+	cases := []testCase{
+		{name: "with no action", rule: ConfigRule{}, valid: true},
+		{name: "with a pass action", rule: ConfigRule{Action: "pass"}, valid: true},
+		{name: "with a null action", rule: ConfigRule{Action: "null"}, valid: true},
+		{name: "with a drop action", rule: ConfigRule{Action: "drop"}, valid: true},
+		{name: "with a string literal", rule: ConfigRule{Action: "literal", Value: "N/A"}, valid: true},
+		{name: "with a number literal", rule: ConfigRule{Action: "literal", Value: 5}, valid: true},
+		{name: "with a missing literal", rule: ConfigRule{Action: "literal"}, valid: false},
+		{name: "with a mask", rule: ConfigRule{Action: "mask", Keep: 4}, valid: true},
+		{name: "with a negative mask", rule: ConfigRule{Action: "mask", Keep: -1}, valid: false},
+		{name: "with a fake", rule: ConfigRule{Action: "fake", Format: "uuid", hashKey: testHashKey}, valid: true},
+		{name: "with a fake and no hash key", rule: ConfigRule{Action: "fake", Format: "uuid"}, valid: false},
+		{name: "with an unknown fake", rule: ConfigRule{Action: "fake", Format: "phone", hashKey: testHashKey}, valid: false},
+		{name: "with an unknown action", rule: ConfigRule{Action: "shred"}, valid: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.rule.validateAction()
+			assert.Equal(t, c.valid, err == nil)
+		})
+	}
+}
+
+func TestReplace(t *testing.T) {
+	type testCase struct {
+		name  string
+		rule  ConfigRule
+		value interface{}
+		out   interface{}
+		ok    bool
+	}
+
+	cases := []testCase{
+		{name: "with a literal", rule: ConfigRule{Action: "literal", Value: "N/A"}, value: 5.0, out: "N/A", ok: true},
+		{name: "with null", rule: ConfigRule{Action: "null"}, value: "data", out: nil, ok: true},
+		{name: "with a mask", rule: ConfigRule{Action: "mask", Keep: 4}, value: "4111111111111234", out: "************1234", ok: true},
+		{name: "with a mask of a number", rule: ConfigRule{Action: "mask", Keep: 4}, value: 5.0, out: nil, ok: false},
+		{name: "with a fake of a bool", rule: ConfigRule{Action: "fake", Format: "email"}, value: true, out: nil, ok: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out, ok := c.rule.replace(c.value)
+			assert.Equal(t, c.ok, ok)
+			assert.Equal(t, c.out, out)
+		})
+	}
+}
+
+func TestMask(t *testing.T) {
+	type testCase struct {
+		name string
+		in   string
+		keep int
+		out  string
+	}
+
+	cases := []testCase{
+		{name: "with nothing kept", in: "secret", keep: 0, out: "******"},
+		{name: "with the last characters kept", in: "555-1234", keep: 4, out: "****1234"},
+		{name: "with a short string", in: "1234", keep: 4, out: "****"},
+		{name: "with multi-byte characters", in: "héllo", keep: 2, out: "***lo"},
+		{name: "with an empty string", in: "", keep: 4, out: ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.out, mask(c.in, c.keep))
+		})
+	}
+}
+
+func TestFake(t *testing.T) {
+	type testCase struct {
+		name    string
+		in      string
+		format  string
+		pattern string
+	}
+
+	cases := []testCase{
+		{name: "with a uuid", in: "3b241101-e2bb-4255-8caf-4136c566a962", format: "uuid", pattern: `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{name: "with an email", in: "diggy@net.cool", format: "email", pattern: `^user-[0-9a-f]{12}@example\.com$`},
+		{name: "with a date", in: "1987-06-05", format: "date", pattern: `^(19[5-9]\d|200\d)-\d{2}-\d{2}$`},
+		{name: "with a timestamp", in: "1987-06-05T04:03:02Z", format: "date", pattern: `^(19[5-9]\d|200\d)-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z$`},
+		{name: "with a date in another layout", in: "06/05/1987", format: "date", pattern: `^\d{2}/\d{2}/(19[5-9]\d|200\d)$`},
+		{name: "with an unparseable date", in: "last tuesday", format: "date", pattern: `^\d{4}-\d{2}-\d{2}$`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out := fake(testHashKey, c.in, c.format)
+			assert.Regexp(t, regexp.MustCompile(c.pattern), out)
+			assert.NotEqual(t, c.in, out)
+			assert.Equal(t, out, fake(testHashKey, c.in, c.format))
+			assert.NotEqual(t, out, fake(testHashKey, c.in+"x", c.format))
+			assert.NotEqual(t, out, fake([]byte("another key"), c.in, c.format))
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package redactor
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultMaxDecompressedSize is the largest a compressed body may grow to
+// when decompressed, unless a match sets `max_decompressed_size`.
+const DefaultMaxDecompressedSize = 10 << 20
+
+// ErrDecompressedSize is returned for compressed bodies that decompress to
+// more than the size limit, which are likely zip bombs.
+var ErrDecompressedSize = errors.New("compress: decompressed body exceeds size limit")
+
+// A content-coding of a body, as named in its Content-Encoding header.
+// "deflate" should be zlib wrapped, but some clients send raw deflate, so
+// which one a body used is kept to re-compress it the same way.
+type contentCoding struct {
+	name       string
+	rawDeflate bool
+}
+
+// Parses the content-codings of a Content-Encoding header, in the order they
+// were applied.  "identity" is skipped.  Returns an error if any coding isn't
+// supported.
+func parseContentEncoding(header http.Header) ([]contentCoding, error) {
+	codings := []contentCoding{}
+
+	for _, value := range header.Values("Content-Encoding") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+
+			switch name {
+			case "", "identity":
+				continue
+			case "gzip", "x-gzip", "deflate", "br", "zstd":
+				codings = append(codings, contentCoding{name: name})
+			default:
+				return nil, fmt.Errorf("compress: unsupported content-encoding %q", name)
+			}
+		}
+	}
+
+	return codings, nil
+}
+
+// Decompresses a body, undoing its codings in reverse order.  Returns
+// ErrDecompressedSize if any step decompresses to more than `limit` bytes.
+// Records which deflate codings were raw.
+func decompressBody(codings []contentCoding, data []byte, limit int) ([]byte, error) {
+	for i := len(codings) - 1; i >= 0; i-- {
+		reader, err := newDecompressor(&codings[i], data, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err = ioutil.ReadAll(io.LimitReader(reader, int64(limit)+1))
+		reader.Close()
+		if err == zstd.ErrDecoderSizeExceeded || err == zstd.ErrWindowSizeExceeded {
+			return nil, ErrDecompressedSize
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(data) > limit {
+			return nil, ErrDecompressedSize
+		}
+	}
+
+	return data, nil
+}
+
+// Returns a reader decompressing `data` with `coding`.  A zstd decoder runs
+// on the calling goroutine and won't allocate more than `limit` bytes, and
+// closing the reader closes it.
+func newDecompressor(coding *contentCoding, data []byte, limit int) (io.ReadCloser, error) {
+	switch coding.name {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(bytes.NewReader(data))
+	case "deflate":
+		if reader, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+			return reader, nil
+		}
+
+		coding.rawDeflate = true
+		return flate.NewReader(bytes.NewReader(data)), nil
+	case "br":
+		return ioutil.NopCloser(brotli.NewReader(bytes.NewReader(data))), nil
+	case "zstd":
+		decoder, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(limit)))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+
+	return nil, fmt.Errorf("compress: unsupported content-encoding %q", coding.name)
+}
+
+// Compresses a redacted body with the codings its original was compressed
+// with, in order.
+func compressBody(codings []contentCoding, data []byte) ([]byte, error) {
+	for _, coding := range codings {
+		var buffer bytes.Buffer
+
+		writer, err := newCompressor(coding, &buffer)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+
+		data = buffer.Bytes()
+	}
+
+	return data, nil
+}
+
+// Returns a writer compressing to `w` with `coding`.
+func newCompressor(coding contentCoding, w io.Writer) (io.WriteCloser, error) {
+	switch coding.name {
+	case "gzip", "x-gzip":
+		return gzip.NewWriter(w), nil
+	case "deflate":
+		if coding.rawDeflate {
+			return flate.NewWriter(w, flate.DefaultCompression)
+		}
+		return zlib.NewWriter(w), nil
+	case "br":
+		return brotli.NewWriter(w), nil
+	case "zstd":
+		return zstd.NewWriter(w)
+	}
+
+	return nil, fmt.Errorf("compress: unsupported content-encoding %q", coding.name)
+}
@@ -0,0 +1,151 @@
+package redactor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Compresses `s` with the codings of a Content-Encoding header.
+func compressString(t *testing.T, encoding string, raw bool, s string) []byte {
+	codings, err := parseContentEncoding(http.Header{"Content-Encoding": {encoding}})
+	assert.Nil(t, err)
+	for i := range codings {
+		codings[i].rawDeflate = raw
+	}
+
+	data, err := compressBody(codings, []byte(s))
+	assert.Nil(t, err)
+	return data
+}
+
+func TestParseContentEncoding(t *testing.T) {
+	type testCase struct {
+		name    string
+		header  http.Header
+		codings []contentCoding
+		valid   bool
+	}
+
+	cases := []testCase{
+		{name: "with no encoding", header: http.Header{}, codings: []contentCoding{}, valid: true},
+		{name: "with identity", header: http.Header{"Content-Encoding": {"identity"}}, codings: []contentCoding{}, valid: true},
+		{name: "with gzip", header: http.Header{"Content-Encoding": {"GZIP"}}, codings: []contentCoding{{name: "gzip"}}, valid: true},
+		{
+			name:    "with several codings",
+			header:  http.Header{"Content-Encoding": {"deflate, br", "zstd"}},
+			codings: []contentCoding{{name: "deflate"}, {name: "br"}, {name: "zstd"}},
+			valid:   true,
+		},
+		{name: "with an unsupported coding", header: http.Header{"Content-Encoding": {"gzip, compress"}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			codings, err := parseContentEncoding(c.header)
+			assert.Equal(t, c.valid, err == nil)
+			if c.valid {
+				assert.Equal(t, c.codings, codings)
+			}
+		})
+	}
+}
+
+func TestRedactCompressedBody(t *testing.T) {
+	match := HTTPMatch{RuleOptions: RuleOptions{Body: []ConfigRule{ConfigRule{Whitelist: "$.a"}}}}
+
+	type testCase struct {
+		name     string
+		encoding string
+		raw      bool
+	}
+
+	cases := []testCase{
+		{name: "with gzip", encoding: "gzip"},
+		{name: "with x-gzip", encoding: "x-gzip"},
+		{name: "with deflate", encoding: "deflate"},
+		{name: "with raw deflate", encoding: "deflate", raw: true},
+		{name: "with brotli", encoding: "br"},
+		{name: "with zstd", encoding: "zstd"},
+		{name: "with several codings", encoding: "gzip, zstd"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			body := compressString(t, c.encoding, c.raw, `{"a": "data", "b": "diggy@net.cool"}`)
+
+			request, _ := http.NewRequest("POST", "", bytes.NewReader(body))
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("Content-Encoding", c.encoding)
+
+			assert.Nil(t, redactBody(match, request))
+
+			redacted, err := ioutil.ReadAll(request.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, compressString(t, c.encoding, c.raw, `{"a":"data","b":"REDACTED"}`), redacted)
+			assert.Equal(t, c.encoding, request.Header.Get("Content-Encoding"))
+			assert.Equal(t, int64(len(redacted)), request.ContentLength)
+		})
+	}
+}
+
+func TestRedactCompressedBodyErrors(t *testing.T) {
+	bomb := compressString(t, "gzip", false, `{"a": "`+strings.Repeat("0", 4096)+`"}`)
+	zstdBomb := compressString(t, "zstd", false, `{"a": "`+strings.Repeat("0", 1<<20)+`"}`)
+
+	type testCase struct {
+		name     string
+		match    HTTPMatch
+		encoding string
+		body     []byte
+		err      error
+	}
+
+	cases := []testCase{
+		{name: "with a body over the size limit", match: HTTPMatch{MaxDecompressedSize: 1024}, encoding: "gzip", body: bomb, err: ErrDecompressedSize},
+		{name: "with a zstd body over the size limit", match: HTTPMatch{MaxDecompressedSize: 1024}, encoding: "zstd", body: zstdBomb, err: ErrDecompressedSize},
+		{name: "with a corrupt body", encoding: "gzip", body: []byte(`{"a": "data"}`)},
+		{name: "with an unsupported coding", encoding: "compress", body: []byte(`{"a": "data"}`)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			request, _ := http.NewRequest("POST", "", bytes.NewReader(c.body))
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("Content-Encoding", c.encoding)
+
+			err := redactBody(c.match, request)
+			redacted, _ := ioutil.ReadAll(request.Body)
+
+			assert.NotNil(t, err)
+			if c.err != nil {
+				assert.Equal(t, c.err, err)
+			}
+			assert.Equal(t, []byte{}, redacted)
+			assert.Equal(t, "", request.Header.Get("Content-Encoding"))
+			assert.Equal(t, "0", request.Header.Get("Content-Length"))
+		})
+	}
+}
+
+func TestRedactCompressedResponse(t *testing.T) {
+	match := HTTPMatch{
+		RedactResponse: true,
+		RuleOptions:    RuleOptions{Response: []ConfigRule{ConfigRule{Whitelist: "$.id"}}},
+	}
+
+	resp := &http.Response{
+		Header: http.Header{"Content-Type": {"application/json"}, "Content-Encoding": {"br"}},
+		Body:   ioutil.NopCloser(bytes.NewReader(compressString(t, "br", false, `{"id": 1, "email": "diggy@net.cool"}`))),
+	}
+
+	assert.Nil(t, RedactResponse(match, resp))
+
+	redacted, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, compressString(t, "br", false, `{"email":"REDACTED","id":1}`), redacted)
+}
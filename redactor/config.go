@@ -0,0 +1,515 @@
+package redactor
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	// hashicorp/hcl has a bug that was a show-stopper for parsing the config
+	// the way I wanted: https://github.com/hashicorp/hcl/issues/164
+	//
+	// This is fixed by the following fork (a PR has been submitted against it:
+	// https://github.com/hashicorp/hcl/pull/228)
+	//
+	// TODO: replace with hashicorp/hcl when 228 is merged.
+	"github.com/carlsverre/hcl"
+)
+
+// ConfigRule whitelists a location.  If the value at the location is an
+// Object or Array it's passed through whole, unless LeafOnly is set, in which
+// case only the leaves beneath it that are whitelisted by other rules are.
+// LeafOnly defaults to the config's `leaf_only`.  If Pattern is set, the rule
+// only matches strings matching that regular expression.
+//
+// Action replaces the values at the location rather than passing them
+// through (see action.go).  Value is the replacement of ActionLiteral, Keep
+// the number of characters ActionMask leaves unmasked (or ActionTruncate
+// keeps), and Format the kind of value ActionFake generates.  Mode and
+// Claims are the options of ActionJWT (see jwt.go): Claims whitelists the
+// locations of a token's claims.  Decode parses the strings at the location
+// as an encoded payload, whose nested locations are whitelisted by other
+// rules, instead of taking an action (see decode.go).  The rest are options
+// of the generalizations in generalize.go.
+type ConfigRule struct {
+	Whitelist string `json:"whitelist"`
+	LeafOnly  *bool  `hcl:"leaf_only" json:"leaf_only,omitempty"`
+	Pattern   string `hcl:"pattern" json:"pattern,omitempty"`
+
+	Action string      `hcl:"action" json:"action,omitempty"`
+	Value  interface{} `hcl:"value" json:"value,omitempty"`
+	Keep   int         `hcl:"keep" json:"keep,omitempty"`
+	Format string      `hcl:"format" json:"format,omitempty"`
+
+	Mode   string   `hcl:"mode" json:"mode,omitempty"`
+	Claims []string `hcl:"claims" json:"claims,omitempty"`
+
+	Decode string `hcl:"decode" json:"decode,omitempty"`
+
+	To         string    `hcl:"to" json:"to,omitempty"`
+	Digits     int       `hcl:"digits" json:"digits,omitempty"`
+	Size       float64   `hcl:"size" json:"size,omitempty"`
+	Bounds     []float64 `hcl:"bounds" json:"bounds,omitempty"`
+	IPv4Prefix int       `hcl:"ipv4_prefix" json:"ipv4_prefix,omitempty"`
+	IPv6Prefix int       `hcl:"ipv6_prefix" json:"ipv6_prefix,omitempty"`
+
+	// The config's vault, keyring, JWT keys and hash key, for
+	// ActionTokenize, ActionEncrypt, ActionJWT and ActionFake.  Set by
+	// Compile.
+	vault   Vault
+	keyring *Keyring
+	jwtKeys *JWTKeys
+	hashKey []byte
+}
+
+// IsLeafOnly returns true iff the rule never passes through a container.
+func (r ConfigRule) IsLeafOnly() bool {
+	return r.LeafOnly != nil && *r.LeafOnly
+}
+
+type RuleOptions struct {
+	Body        []ConfigRule `json:"body,omitempty"`
+	Querystring []ConfigRule `json:"querystring,omitempty"`
+	Header      []ConfigRule `json:"header,omitempty"`
+	Response    []ConfigRule `json:"response,omitempty"`
+	PathRules   []ConfigRule `hcl:"path" json:"path,omitempty"`
+	Cookie      []ConfigRule `json:"cookie,omitempty"`
+}
+
+// HTTPMatch selects rules for requests by path and method.  Path may be a
+// template with named segments, as in `/users/{id}/orders`, whose values are
+// redacted unless whitelisted by a `rule "path"` (see RedactPath).
+// QuerystringPolicy decides what happens to querystring values that aren't
+// whitelisted: "redact" (the default), "drop" or "hash".  PathPolicy does the
+// same for named path segments: "redact" (the default) or "hash".
+// MaxDecompressedSize limits the size compressed bodies may decompress to, by
+// default DefaultMaxDecompressedSize.
+type HTTPMatch struct {
+	Path                string `json:"path,omitempty"`
+	Method              string `json:"method,omitempty"`
+	RedactResponse      bool   `hcl:"redact_response" json:"redact_response,omitempty"`
+	QuerystringPolicy   string `hcl:"querystring_policy" json:"querystring_policy,omitempty"`
+	PathPolicy          string `hcl:"path_policy" json:"path_policy,omitempty"`
+	MaxDecompressedSize int    `hcl:"max_decompressed_size" json:"max_decompressed_size,omitempty"`
+	RuleOptions         `hcl:"rule" json:"rule"`
+
+	// The config's `content_types` and hash key, for the "hash" policies.
+	// Set by Compile.
+	contentTypes map[string]string
+	hashKey      []byte
+}
+
+// Returns the size limit of decompressed bodies.
+func (m HTTPMatch) maxDecompressedSize() int {
+	if m.MaxDecompressedSize <= 0 {
+		return DefaultMaxDecompressedSize
+	}
+
+	return m.MaxDecompressedSize
+}
+
+// WithVault returns a copy of a match whose `tokenize` rules store values in
+// `vault` rather than the config's.
+func (m HTTPMatch) WithVault(vault Vault) HTTPMatch {
+	options := MatchOptions{HTTP: []HTTPMatch{m}}.mapRules(func(rule ConfigRule) ConfigRule {
+		if rule.vault != nil {
+			rule.vault = vault
+		}
+		return rule
+	})
+
+	return options.HTTP[0]
+}
+
+// QueueMatch selects rules for messages consumed from a queue by topic (or
+// subject).  Topic may be a pattern using `*` and `?` wildcards.  Messages
+// that don't declare a content-type are assumed to be ContentType, or JSON if
+// it is unset.
+type QueueMatch struct {
+	Topic       string `json:"topic,omitempty"`
+	ContentType string `hcl:"content_type" json:"content_type,omitempty"`
+	RuleOptions `hcl:"rule" json:"rule"`
+
+	// The config's `content_types`.  Set by Compile.
+	contentTypes map[string]string
+}
+
+// GRPCMatch selects rules for gRPC calls by fully-qualified service name
+// (e.g. `package.Service`) and method name.  Either may be omitted to match
+// any value.
+type GRPCMatch struct {
+	Service        string `json:"service,omitempty"`
+	Method         string `json:"method,omitempty"`
+	RedactResponse bool   `hcl:"redact_response" json:"redact_response,omitempty"`
+	RuleOptions    `hcl:"rule" json:"rule"`
+}
+
+type MatchOptions struct {
+	HTTP  []HTTPMatch  `json:"http,omitempty"`
+	Queue []QueueMatch `json:"queue,omitempty"`
+	GRPC  []GRPCMatch  `json:"grpc,omitempty"`
+}
+
+// Returns a copy of the match clauses with `fn` applied to each body,
+// response, querystring, path, cookie and header rule (other than those of
+// queue clauses, whose header rules only whitelist).
+func (m MatchOptions) mapRules(fn func(ConfigRule) ConfigRule) MatchOptions {
+	result := MatchOptions{
+		HTTP:  append([]HTTPMatch(nil), m.HTTP...),
+		Queue: append([]QueueMatch(nil), m.Queue...),
+		GRPC:  append([]GRPCMatch(nil), m.GRPC...),
+	}
+
+	for i := range result.HTTP {
+		result.HTTP[i].Body = mapRules(result.HTTP[i].Body, fn)
+		result.HTTP[i].Response = mapRules(result.HTTP[i].Response, fn)
+		result.HTTP[i].Querystring = mapRules(result.HTTP[i].Querystring, fn)
+		result.HTTP[i].PathRules = mapRules(result.HTTP[i].PathRules, fn)
+		result.HTTP[i].Cookie = mapRules(result.HTTP[i].Cookie, fn)
+		result.HTTP[i].Header = mapRules(result.HTTP[i].Header, fn)
+	}
+
+	for i := range result.Queue {
+		result.Queue[i].Body = mapRules(result.Queue[i].Body, fn)
+	}
+
+	for i := range result.GRPC {
+		result.GRPC[i].Body = mapRules(result.GRPC[i].Body, fn)
+		result.GRPC[i].Response = mapRules(result.GRPC[i].Response, fn)
+		result.GRPC[i].Header = mapRules(result.GRPC[i].Header, fn)
+	}
+
+	return result
+}
+
+// Returns a copy of `rules` with `fn` applied to each.
+func mapRules(rules []ConfigRule, fn func(ConfigRule) ConfigRule) []ConfigRule {
+	if rules == nil {
+		return nil
+	}
+
+	result := make([]ConfigRule, len(rules))
+	for i, rule := range rules {
+		result[i] = fn(rule)
+	}
+
+	return result
+}
+
+// ControlOptions configures a proxy to pull its rules from a control plane
+// (see the control package) rather than only its local config.
+// PollInterval is a duration string like `30s`.  If LongPoll is set the
+// control plane holds each poll open until a new version is published or the
+// interval elapses.  Token is sent as a bearer token with status reports.
+type ControlOptions struct {
+	URL          string `hcl:"url" json:"url"`
+	PublicKey    string `hcl:"public_key" json:"public_key"`
+	PollInterval string `hcl:"poll_interval" json:"poll_interval,omitempty"`
+	LongPoll     bool   `hcl:"long_poll" json:"long_poll,omitempty"`
+	ProxyID      string `hcl:"proxy_id" json:"proxy_id,omitempty"`
+	Token        string `hcl:"token" json:"-"`
+}
+
+// VaultOptions configures the vault that `tokenize` rules store values in.
+// Type selects a vault registered with RegisterVault, by default "file": an
+// encrypted local file at Path, using the key in KeyFile.  If Token is set,
+// the detokenize API (see the detokenize package) listens at Address and
+// requests must send it as a bearer token.
+type VaultOptions struct {
+	Type    string `hcl:"type" json:"type,omitempty"`
+	Path    string `hcl:"path" json:"path,omitempty"`
+	KeyFile string `hcl:"key_file" json:"key_file,omitempty"`
+	Address string `hcl:"address" json:"address,omitempty"`
+	Token   string `hcl:"token" json:"-"`
+}
+
+// JWTOptions configures the keys of `jwt` rules.  Tokens must be signed by
+// one of VerifyKeys, and are re-signed with SigningKey, whose ID (if any) is
+// SigningKeyID.  See LoadJWTKeys for the key formats.
+type JWTOptions struct {
+	VerifyKeys   []string `hcl:"verify_keys" json:"verify_keys,omitempty"`
+	SigningKey   string   `hcl:"signing_key" json:"signing_key,omitempty"`
+	SigningKeyID string   `hcl:"signing_key_id" json:"signing_key_id,omitempty"`
+}
+
+// AdminOptions configures the admin API (see the admin package).  Address
+// defaults to `127.0.0.1:8889`.  If Token is set, requests must send it as a
+// bearer token.
+type AdminOptions struct {
+	Address string `hcl:"address" json:"address,omitempty"`
+	Token   string `hcl:"token" json:"-"`
+}
+
+type Config struct {
+	Match     MatchOptions `json:"match"`
+	Port      string       `json:"port,omitempty"`
+	ProxyPass string       `hcl:"proxy_pass" json:"proxy_pass,omitempty"`
+
+	// Binary FileDescriptorSets describing the gRPC services to proxy.
+	GRPCDescriptorSets []string `hcl:"grpc_descriptor_sets" json:"grpc_descriptor_sets,omitempty"`
+
+	// The default `leaf_only` of rules that don't set it.
+	LeafOnly bool `hcl:"leaf_only" json:"leaf_only,omitempty"`
+
+	// Maps media types (or globs of them) to the handlers redacting bodies
+	// of those types, overriding the defaults (see contentHandler).
+	ContentTypes map[string]string `hcl:"content_types" json:"content_types,omitempty"`
+
+	Control *ControlOptions `hcl:"control" json:"control,omitempty"`
+	Admin   *AdminOptions   `hcl:"admin" json:"admin,omitempty"`
+	Vault   *VaultOptions   `hcl:"vault" json:"vault,omitempty"`
+	JWT     *JWTOptions     `hcl:"jwt" json:"jwt,omitempty"`
+
+	// A keyring file (see LoadKeyring) for `encrypt` rules.
+	Keyring string `hcl:"keyring" json:"keyring,omitempty"`
+
+	// A file holding the secret (see LoadHashKey) that `fake` rules and the
+	// "hash" policies are keyed with.
+	HashKey string `hcl:"hash_key" json:"hash_key,omitempty"`
+}
+
+// LoadConfig reads and parses the HCL formatted config file at `file`.
+func LoadConfig(file string, config *Config) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	return ParseConfig(data, config)
+}
+
+// ParseConfig parses an HCL formatted config.
+func ParseConfig(data []byte, config *Config) error {
+	return hcl.Unmarshal(data, config)
+}
+
+// FindHTTPMatch finds the first http match clause in the server's config that
+// matches the method and pathname of the current request.  Used to lookup the
+// whitelist rules defined for the match.  The pathname is escaped (see
+// url.URL.EscapedPath), so a segment holding an escaped slash, as in
+// `/users/a%2Fb/orders`, matches a template's named segment as RedactPath
+// redacts it.
+func (config Config) FindHTTPMatch(method string, pathname string) HTTPMatch {
+	i := config.FindHTTPMatchIndex(method, pathname)
+	if i < 0 {
+		return HTTPMatch{}
+	}
+
+	return config.Match.HTTP[i]
+}
+
+// FindHTTPMatchIndex is like FindHTTPMatch, but returns the index of the
+// clause in `Match.HTTP`, or -1 if none match.
+func (config Config) FindHTTPMatchIndex(method string, pathname string) int {
+	for i, m := range config.Match.HTTP {
+		isMatch := true
+
+		if m.Method != "" {
+			isMatch = isMatch && isSameCaseInsensitive(m.Method, method)
+		}
+
+		if isPathTemplate(m.Path) {
+			isMatch = isMatch && matchPathTemplate(m.Path, pathname)
+		} else if m.Path != "" {
+			isMatch = isMatch && isSamePath(m.Path, unescapePath(pathname))
+		}
+
+		if isMatch {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// FindQueueMatch finds the first queue match clause in the config that
+// matches the topic of a message.
+func (config Config) FindQueueMatch(topic string) QueueMatch {
+	for _, m := range config.Match.Queue {
+		if m.Topic == "" {
+			return m
+		}
+
+		if isMatch, _ := path.Match(m.Topic, topic); isMatch {
+			return m
+		}
+	}
+
+	return QueueMatch{}
+}
+
+// FindGRPCMatch finds the first grpc match clause in the config that matches
+// the service and method of a gRPC request path (`/package.Service/Method`).
+func (config Config) FindGRPCMatch(path string) GRPCMatch {
+	service, method := splitGRPCPath(path)
+
+	for _, m := range config.Match.GRPC {
+		isMatch := true
+
+		if m.Service != "" {
+			isMatch = isMatch && m.Service == service
+		}
+
+		if m.Method != "" {
+			isMatch = isMatch && m.Method == method
+		}
+
+		if isMatch {
+			return m
+		}
+	}
+
+	return GRPCMatch{}
+}
+
+// Splits a gRPC request path into its service and method names.
+func splitGRPCPath(path string) (string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+	if len(parts) != 2 {
+		return parts[0], ""
+	}
+
+	return parts[0], parts[1]
+}
+
+// Returns whether or not any of the location whitelist rules match the
+// location of data currently being scanned.
+func hasLocationWhitelistMatch(rules []ConfigRule, location string) bool {
+	_, ok := findLocationWhitelistMatch(rules, location, false)
+	return ok
+}
+
+// Like findPathWhitelistMatch, for the location of a value.
+func findLocationWhitelistMatch(rules []ConfigRule, location string, container bool) (ConfigRule, bool) {
+	if len(rules) == 0 {
+		return ConfigRule{}, false
+	}
+
+	steps, err := parsePath(location)
+	if err != nil {
+		return ConfigRule{}, false
+	}
+
+	return findPathWhitelistMatch(rules, steps, container)
+}
+
+// Like hasLocationWhitelistMatch, for a parsed path.
+func hasPathWhitelistMatch(rules []ConfigRule, path []pathStep) bool {
+	_, ok := findPathWhitelistMatch(rules, path, false)
+	return ok
+}
+
+// Whitelist locations that have already been warned about matching a
+// container, so each is only logged once.
+var warnedContainerRules sync.Map
+
+// Returns the first rule matching the path, which decides what happens to the
+// value there.  If the value is a container (an Object or Array), leaf-only
+// rules are skipped.  Passing a container through whole risks leaking any data
+// added to it later, so the first time each rule does it a warning is logged.
+func findPathWhitelistMatch(rules []ConfigRule, path []pathStep, container bool) (ConfigRule, bool) {
+	for _, rule := range rules {
+		if container && rule.IsLeafOnly() {
+			continue
+		}
+
+		if !mustCompileLocation(rule.Whitelist).match(path) {
+			continue
+		}
+
+		// A value pattern is matched against the value at the end of the path.
+		if rule.Pattern != "" {
+			if len(path) == 0 {
+				continue
+			}
+
+			last := path[len(path)-1]
+			if !rule.matchesValue(last.value, last.hasValue) {
+				continue
+			}
+		}
+
+		if container && rule.action() == ActionPass {
+			if _, warned := warnedContainerRules.LoadOrStore(rule.Whitelist, true); !warned {
+				log.Printf("warning: whitelist %q matched the container at %s, passing it through whole; set leaf_only to only pass through its whitelisted leaves\n", rule.Whitelist, pathLocation(path))
+			}
+		}
+
+		return rule, true
+	}
+
+	return ConfigRule{}, false
+}
+
+// HasBodyWhitelistMatch returns whether or not the whitelist request body rules
+// match the location of data currently being scanned.
+func (r RuleOptions) HasBodyWhitelistMatch(location string) bool {
+	return hasLocationWhitelistMatch(r.Body, location)
+}
+
+// HasResponseWhitelistMatch returns whether or not the whitelist response
+// body rules match the location of data currently being scanned.
+func (r RuleOptions) HasResponseWhitelistMatch(location string) bool {
+	return hasLocationWhitelistMatch(r.Response, location)
+}
+
+// HasQuerystringWhitelistMatch returns whether or not a key in a querystring
+// has been whitelisted, regardless of value patterns.  See
+// findQueryWhitelistMatch.
+func (r RuleOptions) HasQuerystringWhitelistMatch(key string) bool {
+	for _, rule := range r.Querystring {
+		rule.Pattern = ""
+		if _, ok := findQueryWhitelistMatch([]ConfigRule{rule}, key, 0, 1, ""); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the first rule whitelisting a name, such as a path segment's or a
+// cookie's.  A rule's name may be a glob, and it may also have a value
+// pattern.
+func findNameWhitelistMatch(rules []ConfigRule, name string, value string) (ConfigRule, bool) {
+	for _, rule := range rules {
+		if globMatch(rule.Whitelist, name) && rule.matchesValue(value, true) {
+			return rule, true
+		}
+	}
+
+	return ConfigRule{}, false
+}
+
+// HasHeaderWhitelistMatch returns whether or not a header name has been
+// whitelisted.  Header names are compared case-insensitively.  Headers
+// matched by a rule with an action (such as a `jwt` rule) aren't whitelisted.
+func (r RuleOptions) HasHeaderWhitelistMatch(name string) bool {
+	rule, ok := findHeaderWhitelistMatch(r.Header, name)
+	return ok && rule.action() == ActionPass
+}
+
+// Returns the first rule matching a header name, compared
+// case-insensitively.
+func findHeaderWhitelistMatch(rules []ConfigRule, name string) (ConfigRule, bool) {
+	for _, rule := range rules {
+		if http.CanonicalHeaderKey(rule.Whitelist) == http.CanonicalHeaderKey(name) {
+			return rule, true
+		}
+	}
+
+	return ConfigRule{}, false
+}
+
+// Returns true iff any of the header rules whitelists a header, opting in
+// to header redaction.
+func hasHeaderWhitelist(rules []ConfigRule) bool {
+	for _, rule := range rules {
+		if rule.action() == ActionPass {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,542 @@
+package redactor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindHTTPMatch(t *testing.T) {
+	makeConfig := func(matches ...HTTPMatch) Config {
+		return Config{Match: MatchOptions{HTTP: matches}}
+	}
+
+	type testCase struct {
+		name   string
+		config Config
+		method string
+		path   string
+		out    HTTPMatch
+	}
+
+	cases := []testCase{
+		{
+			name:   "with no rules",
+			config: makeConfig(),
+			out:    HTTPMatch{},
+		},
+		{
+			name:   "with no match for method",
+			config: makeConfig(HTTPMatch{Method: "POST"}),
+			out:    HTTPMatch{},
+		},
+		{
+			name:   "with a match for method",
+			config: makeConfig(HTTPMatch{Method: "POST"}),
+			method: "POST",
+			out:    HTTPMatch{Method: "POST"},
+		},
+		{
+			name:   "with a case-insensitive match for method",
+			config: makeConfig(HTTPMatch{Method: "POST"}),
+			method: "post",
+			out:    HTTPMatch{Method: "POST"},
+		},
+		{
+			name:   "with no match for path",
+			config: makeConfig(HTTPMatch{Path: "/v1"}),
+			out:    HTTPMatch{},
+		},
+		{
+			name:   "with a match for path",
+			config: makeConfig(HTTPMatch{Path: "/v1"}),
+			path:   "/v1",
+			out:    HTTPMatch{Path: "/v1"},
+		},
+		{
+			name:   "with a trailing-slash insensitive match for path",
+			config: makeConfig(HTTPMatch{Path: "/v1"}),
+			path:   "/v1/",
+			out:    HTTPMatch{Path: "/v1"},
+		},
+		{
+			name:   "with a match for a path template",
+			config: makeConfig(HTTPMatch{Path: "/users/{id}/orders"}),
+			path:   "/users/diggy@net.cool/orders/",
+			out:    HTTPMatch{Path: "/users/{id}/orders"},
+		},
+		{
+			name:   "with a match for a path template with an escaped slash",
+			config: makeConfig(HTTPMatch{Path: "/users/{id}/orders"}),
+			path:   "/users/a%2Fb/orders",
+			out:    HTTPMatch{Path: "/users/{id}/orders"},
+		},
+		{
+			name:   "with a match for an escaped path",
+			config: makeConfig(HTTPMatch{Path: "/café"}),
+			path:   "/caf%C3%A9",
+			out:    HTTPMatch{Path: "/café"},
+		},
+		{
+			name:   "with no match for a path template",
+			config: makeConfig(HTTPMatch{Path: "/users/{id}/orders"}),
+			path:   "/users/diggy@net.cool",
+			out:    HTTPMatch{},
+		},
+		{
+			name:   "with no matches that satisfy method and path",
+			config: makeConfig(HTTPMatch{Path: "/v1", Method: "GET"}, HTTPMatch{Path: "/v2", Method: "POST"}),
+			path:   "/v1",
+			method: "POST",
+			out:    HTTPMatch{},
+		},
+		{
+			name:   "with only the first match returning",
+			config: makeConfig(HTTPMatch{Path: "/v1", Method: "GET"}, HTTPMatch{Method: "POST"}, HTTPMatch{Path: "/v1", Method: "POST"}),
+			path:   "/v1",
+			method: "POST",
+			out:    HTTPMatch{Method: "POST"},
+		},
+		{
+			name:   "with only the first match returning",
+			config: makeConfig(HTTPMatch{Path: "/v1", Method: "GET"}, HTTPMatch{Method: "POST"}, HTTPMatch{}),
+			path:   "/v2",
+			method: "GET",
+			out:    HTTPMatch{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			match := c.config.FindHTTPMatch(c.method, c.path)
+			assert.Equal(t, match, c.out)
+		})
+	}
+}
+
+func TestFindHTTPMatchIndex(t *testing.T) {
+	config := Config{
+		Match: MatchOptions{
+			HTTP: []HTTPMatch{
+				HTTPMatch{Path: "/users"},
+				HTTPMatch{Method: "POST"},
+			},
+		},
+	}
+
+	assert.Equal(t, 0, config.FindHTTPMatchIndex("POST", "/users"))
+	assert.Equal(t, 1, config.FindHTTPMatchIndex("POST", "/events"))
+	assert.Equal(t, -1, config.FindHTTPMatchIndex("GET", "/events"))
+}
+
+func TestHasBodyWhitelistMatch(t *testing.T) {
+	makeRuleOptions := func(rules ...ConfigRule) RuleOptions {
+		return RuleOptions{Body: rules}
+	}
+
+	type testCase struct {
+		name        string
+		ruleOptions RuleOptions
+		location    string
+		out         bool
+	}
+
+	cases := []testCase{
+		{
+			name:        "with no rules",
+			ruleOptions: makeRuleOptions(),
+			location:    "$.a",
+			out:         false,
+		},
+		{
+			name:        "with a rule that doesn't match",
+			ruleOptions: makeRuleOptions(ConfigRule{Whitelist: "$.a"}),
+			location:    "$.b",
+			out:         false,
+		},
+		{
+			name:        "with a rule that matches",
+			ruleOptions: makeRuleOptions(ConfigRule{Whitelist: "$.a"}),
+			location:    "$.a",
+			out:         true,
+		},
+		{
+			name:        "with a complex rule that matches",
+			ruleOptions: makeRuleOptions(ConfigRule{Whitelist: "$[*]"}),
+			location:    "$[5]",
+			out:         true,
+		},
+		{
+			name:        "with a rule that matches out of many",
+			ruleOptions: makeRuleOptions(ConfigRule{Whitelist: "$.b"}, ConfigRule{Whitelist: "$.a"}),
+			location:    "$.a",
+			out:         true,
+		},
+		{
+			name:        "with no rule that matches out of many",
+			ruleOptions: makeRuleOptions(ConfigRule{Whitelist: "$.b"}, ConfigRule{Whitelist: "$.a"}),
+			location:    "$.c",
+			out:         false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hasMatch := c.ruleOptions.HasBodyWhitelistMatch(c.location)
+			assert.Equal(t, hasMatch, c.out)
+		})
+	}
+}
+
+func TestHasQuerystringWhitelistMatch(t *testing.T) {
+	makeRuleOptions := func(rules ...ConfigRule) RuleOptions {
+		return RuleOptions{Querystring: rules}
+	}
+
+	type testCase struct {
+		name        string
+		ruleOptions RuleOptions
+		key         string
+		out         bool
+	}
+
+	cases := []testCase{
+		{
+			name:        "with no rules",
+			ruleOptions: makeRuleOptions(),
+			key:         "a",
+			out:         false,
+		},
+		{
+			name:        "with one matching rule",
+			ruleOptions: makeRuleOptions(ConfigRule{Whitelist: "a"}),
+			key:         "a",
+			out:         true,
+		},
+		{
+			name:        "one matching rule out of many",
+			ruleOptions: makeRuleOptions(ConfigRule{Whitelist: "a"}, ConfigRule{Whitelist: "b"}),
+			key:         "b",
+			out:         true,
+		},
+		{
+			name:        "no matching rules out of many",
+			ruleOptions: makeRuleOptions(ConfigRule{Whitelist: "a"}, ConfigRule{Whitelist: "b"}),
+			key:         "c",
+			out:         false,
+		},
+		{
+			name:        "with a matching glob",
+			ruleOptions: makeRuleOptions(ConfigRule{Whitelist: "utm_*"}),
+			key:         "utm_source",
+			out:         true,
+		},
+		{
+			name:        "with a matching location",
+			ruleOptions: makeRuleOptions(ConfigRule{Whitelist: "$.filter.id"}),
+			key:         "filter[id]",
+			out:         true,
+		},
+		{
+			name:        "with a matching rule with a value pattern",
+			ruleOptions: makeRuleOptions(ConfigRule{Whitelist: "a", Pattern: "^[0-9]+$"}),
+			key:         "a",
+			out:         true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hasMatch := c.ruleOptions.HasQuerystringWhitelistMatch(c.key)
+			assert.Equal(t, hasMatch, c.out)
+		})
+	}
+}
+
+func TestLocationMatchString(t *testing.T) {
+	type testCase struct {
+		name    string
+		pattern string
+		test    string
+		match   bool
+	}
+
+	cases := []testCase{
+		{
+			name:    "matches itself",
+			pattern: "$.a",
+			test:    "$.a",
+			match:   true,
+		},
+		{
+			name:    "must match the entire pattern",
+			pattern: "$.a",
+			test:    "!$.a",
+			match:   false,
+		},
+		{
+			name:    "must match the entire pattern",
+			pattern: "$.a",
+			test:    "$.a!",
+			match:   false,
+		},
+		{
+			name:    "must match the entire pattern",
+			pattern: "$.a",
+			test:    "!$.a!",
+			match:   false,
+		},
+		{
+			name:    "matches array indices",
+			pattern: "$.a[5]",
+			test:    "$.a[5]",
+			match:   true,
+		},
+		{
+			name:    "matches array indices",
+			pattern: "$.a[5]",
+			test:    "$.a[4]",
+			match:   false,
+		},
+		{
+			name:    "matches wildcard array indices",
+			pattern: "$.a[*]",
+			test:    "$.a[4]",
+			match:   true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hasMatch := mustCompileLocation(c.pattern).matchString(c.test)
+			assert.Equal(t, hasMatch, c.match)
+		})
+	}
+}
+
+func TestHasHeaderWhitelistMatch(t *testing.T) {
+	makeRuleOptions := func(rules ...ConfigRule) RuleOptions {
+		return RuleOptions{Header: rules}
+	}
+
+	type testCase struct {
+		name        string
+		ruleOptions RuleOptions
+		header      string
+		out         bool
+	}
+
+	cases := []testCase{
+		{
+			name:        "with no rules",
+			ruleOptions: makeRuleOptions(),
+			header:      "User-Agent",
+			out:         false,
+		},
+		{
+			name:        "with one matching rule",
+			ruleOptions: makeRuleOptions(ConfigRule{Whitelist: "User-Agent"}),
+			header:      "User-Agent",
+			out:         true,
+		},
+		{
+			name:        "with a case-insensitive match",
+			ruleOptions: makeRuleOptions(ConfigRule{Whitelist: "user-agent"}),
+			header:      "User-Agent",
+			out:         true,
+		},
+		{
+			name:        "no matching rules out of many",
+			ruleOptions: makeRuleOptions(ConfigRule{Whitelist: "Accept"}, ConfigRule{Whitelist: "User-Agent"}),
+			header:      "Authorization",
+			out:         false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hasMatch := c.ruleOptions.HasHeaderWhitelistMatch(c.header)
+			assert.Equal(t, hasMatch, c.out)
+		})
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	data := []byte(`
+port = "8080"
+proxy_pass = "http://httpbin.org"
+
+content_types {
+  "application/x-amz-json-1.1" = "json"
+}
+
+match "http" {
+  path = "/post"
+  method = "post"
+
+  rule "body" {
+    whitelist = "$.event_id"
+  }
+
+  rule "body" {
+    whitelist = "$.items"
+    leaf_only = true
+  }
+
+  rule "header" {
+    whitelist = "User-Agent"
+  }
+}
+
+match "http" {
+  path = "/users/{id}/orders/{order}"
+  path_policy = "hash"
+
+  rule "path" {
+    whitelist = "order"
+  }
+
+  rule "cookie" {
+    whitelist = "session"
+  }
+}
+
+control {
+  url = "http://control:9999"
+  public_key = "control.pub"
+  long_poll = true
+}
+`)
+
+	config := Config{}
+	err := ParseConfig(data, &config)
+	assert.Nil(t, err)
+
+	leafOnly := true
+
+	assert.Equal(t, "8080", config.Port)
+	assert.Equal(t, "http://httpbin.org", config.ProxyPass)
+	assert.Equal(t, map[string]string{"application/x-amz-json-1.1": "json"}, config.ContentTypes)
+	assert.Equal(t, []HTTPMatch{
+		HTTPMatch{
+			Path:   "/post",
+			Method: "post",
+			RuleOptions: RuleOptions{
+				Body: []ConfigRule{
+					ConfigRule{Whitelist: "$.event_id"},
+					ConfigRule{Whitelist: "$.items", LeafOnly: &leafOnly},
+				},
+				Header: []ConfigRule{ConfigRule{Whitelist: "User-Agent"}},
+			},
+		},
+		HTTPMatch{
+			Path:       "/users/{id}/orders/{order}",
+			PathPolicy: "hash",
+			RuleOptions: RuleOptions{
+				PathRules: []ConfigRule{ConfigRule{Whitelist: "order"}},
+				Cookie:    []ConfigRule{ConfigRule{Whitelist: "session"}},
+			},
+		},
+	}, config.Match.HTTP)
+	assert.Equal(t, &ControlOptions{URL: "http://control:9999", PublicKey: "control.pub", LongPoll: true}, config.Control)
+}
+
+func TestFindQueueMatch(t *testing.T) {
+	makeConfig := func(matches ...QueueMatch) Config {
+		return Config{Match: MatchOptions{Queue: matches}}
+	}
+
+	type testCase struct {
+		name   string
+		config Config
+		topic  string
+		out    QueueMatch
+	}
+
+	cases := []testCase{
+		{
+			name:   "with no rules",
+			config: makeConfig(),
+			topic:  "events",
+			out:    QueueMatch{},
+		},
+		{
+			name:   "with an exact match",
+			config: makeConfig(QueueMatch{Topic: "users"}, QueueMatch{Topic: "events"}),
+			topic:  "events",
+			out:    QueueMatch{Topic: "events"},
+		},
+		{
+			name:   "with a wildcard match",
+			config: makeConfig(QueueMatch{Topic: "events.*"}),
+			topic:  "events.click",
+			out:    QueueMatch{Topic: "events.*"},
+		},
+		{
+			name:   "with no match",
+			config: makeConfig(QueueMatch{Topic: "events.*"}),
+			topic:  "users",
+			out:    QueueMatch{},
+		},
+		{
+			name:   "with a match for any topic",
+			config: makeConfig(QueueMatch{Topic: "users"}, QueueMatch{ContentType: "application/json"}),
+			topic:  "events",
+			out:    QueueMatch{ContentType: "application/json"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			match := c.config.FindQueueMatch(c.topic)
+			assert.Equal(t, match, c.out)
+		})
+	}
+}
+
+func TestFindGRPCMatch(t *testing.T) {
+	makeConfig := func(matches ...GRPCMatch) Config {
+		return Config{Match: MatchOptions{GRPC: matches}}
+	}
+
+	type testCase struct {
+		name   string
+		config Config
+		path   string
+		out    GRPCMatch
+	}
+
+	cases := []testCase{
+		{
+			name:   "with no rules",
+			config: makeConfig(),
+			path:   "/test.Users/GetUser",
+			out:    GRPCMatch{},
+		},
+		{
+			name:   "with a match for service",
+			config: makeConfig(GRPCMatch{Service: "test.Users"}),
+			path:   "/test.Users/GetUser",
+			out:    GRPCMatch{Service: "test.Users"},
+		},
+		{
+			name:   "with a match for service and method",
+			config: makeConfig(GRPCMatch{Service: "test.Users", Method: "CreateUsers"}, GRPCMatch{Service: "test.Users", Method: "GetUser"}),
+			path:   "/test.Users/GetUser",
+			out:    GRPCMatch{Service: "test.Users", Method: "GetUser"},
+		},
+		{
+			name:   "with no match for method",
+			config: makeConfig(GRPCMatch{Method: "CreateUsers"}),
+			path:   "/test.Users/GetUser",
+			out:    GRPCMatch{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			match := c.config.FindGRPCMatch(c.path)
+			assert.Equal(t, match, c.out)
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package redactor
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Returns true iff a header carries cookies, and so is filtered by `rule
+// "cookie"` rather than `rule "header"`.
+func isCookieHeader(name string) bool {
+	name = http.CanonicalHeaderKey(name)
+	return name == "Cookie" || name == "Set-Cookie"
+}
+
+// Redacts the value of a cookie.  Returns false if the cookie should be
+// dropped, either because no rule whitelists it or its rule drops it.
+func redactCookieValue(rules []ConfigRule, name string, value string) (string, bool) {
+	rule, ok := findNameWhitelistMatch(rules, name, value)
+	if !ok {
+		return "", false
+	}
+
+	switch rule.action() {
+	case ActionPass:
+		return value, true
+	case ActionDrop:
+		return "", false
+	}
+
+	replaced, ok := rule.replace(value)
+	if !ok {
+		return RedactedStr, true
+	}
+
+	if replaced == nil {
+		return "", true
+	}
+
+	// A replacement that would break the header, or add attributes to it,
+	// is redacted instead.
+	if !isCookieValue(fmt.Sprint(replaced)) {
+		return RedactedStr, true
+	}
+
+	return fmt.Sprint(replaced), true
+}
+
+// Returns true iff a string can be written as a cookie value (RFC 6265):
+// printable ASCII other than whitespace, `"`, `,`, `;` and `\`.
+func isCookieValue(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || c == '"' || c == ',' || c == ';' || c == '\\' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Filters the cookies in a `Cookie` header value, as in `a=1; b=2`, keeping
+// their order.  Cookies that aren't whitelisted are dropped.
+func redactCookieList(rules []ConfigRule, header string) string {
+	result := []string{}
+
+	for _, pair := range strings.Split(header, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		name, value := pair, ""
+		if i := strings.IndexByte(pair, '='); i >= 0 {
+			name, value = pair[:i], pair[i+1:]
+		}
+
+		if redacted, ok := redactCookieValue(rules, name, value); ok {
+			result = append(result, name+"="+redacted)
+		}
+	}
+
+	return strings.Join(result, "; ")
+}
+
+// Filters a `Set-Cookie` header value, as in `a=1; Path=/; HttpOnly`.
+// Returns false if the cookie isn't whitelisted.  Attributes are kept.
+func redactSetCookie(rules []ConfigRule, header string) (string, bool) {
+	pair, attributes := header, ""
+	if i := strings.IndexByte(header, ';'); i >= 0 {
+		pair, attributes = header[:i], header[i:]
+	}
+
+	name, value := strings.TrimSpace(pair), ""
+	if i := strings.IndexByte(name, '='); i >= 0 {
+		name, value = name[:i], name[i+1:]
+	}
+
+	redacted, ok := redactCookieValue(rules, name, value)
+	if !ok {
+		return "", false
+	}
+
+	return name + "=" + redacted + attributes, true
+}
+
+// RedactCookies filters the `Cookie` and `Set-Cookie` headers against the
+// `rule "cookie"` whitelist of `match`, keeping only whitelisted cookies.
+// Cookie redaction is opt-in: if the match declares no `rule "cookie"`
+// clauses, the headers are returned unchanged.  Headers left with no cookies
+// are removed.
+//
+// Returns a redacted copy of `header`, does not mutate.
+func RedactCookies(match HTTPMatch, header http.Header) http.Header {
+	result := header.Clone()
+	if len(match.Cookie) == 0 || result == nil {
+		return result
+	}
+
+	for name, values := range result {
+		if !isCookieHeader(name) {
+			continue
+		}
+
+		kept := []string{}
+		for _, v := range values {
+			if http.CanonicalHeaderKey(name) == "Cookie" {
+				if cookies := redactCookieList(match.Cookie, v); cookies != "" {
+					kept = append(kept, cookies)
+				}
+			} else if cookie, ok := redactSetCookie(match.Cookie, v); ok {
+				kept = append(kept, cookie)
+			}
+		}
+
+		if len(kept) == 0 {
+			delete(result, name)
+		} else {
+			result[name] = kept
+		}
+	}
+
+	return result
+}
+
+// Returns an error if any of the cookie rules has an invalid pattern or
+// action, or a literal that isn't a valid cookie value.
+func validateCookieRules(rules []ConfigRule) error {
+	for _, rule := range rules {
+		if _, err := compilePattern(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid cookie whitelist %q: %v", rule.Whitelist, err)
+		}
+
+		if err := rule.validateAction(); err != nil {
+			return fmt.Errorf("invalid cookie whitelist %q: %v", rule.Whitelist, err)
+		}
+
+		if err := rule.validateStringAction(); err != nil {
+			return fmt.Errorf("invalid cookie whitelist %q: %v", rule.Whitelist, err)
+		}
+
+		if rule.action() == ActionLiteral && !isCookieValue(fmt.Sprint(rule.Value)) {
+			return fmt.Errorf("invalid cookie whitelist %q: literal %q isn't a valid cookie value", rule.Whitelist, fmt.Sprint(rule.Value))
+		}
+	}
+
+	return nil
+}
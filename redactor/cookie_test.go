@@ -0,0 +1,118 @@
+package redactor
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactCookies(t *testing.T) {
+	makeCookieMatch := func(rules ...ConfigRule) HTTPMatch {
+		return HTTPMatch{RuleOptions: RuleOptions{Cookie: rules}}
+	}
+
+	type testCase struct {
+		name  string
+		match HTTPMatch
+		in    http.Header
+		out   http.Header
+	}
+
+	cases := []testCase{
+		{
+			name:  "with no cookie rules",
+			match: HTTPMatch{},
+			in:    http.Header{"Cookie": {"session=abc; _ga=GA1.2.3"}},
+			out:   http.Header{"Cookie": {"session=abc; _ga=GA1.2.3"}},
+		},
+		{
+			name:  "with a whitelisted cookie",
+			match: makeCookieMatch(ConfigRule{Whitelist: "session"}),
+			in:    http.Header{"Cookie": {"_ga=GA1.2.3; session=abc; _fbp=fb.1"}},
+			out:   http.Header{"Cookie": {"session=abc"}},
+		},
+		{
+			name:  "with a glob whitelist",
+			match: makeCookieMatch(ConfigRule{Whitelist: "pref_*"}),
+			in:    http.Header{"Cookie": {"pref_lang=en; pref_tz=UTC; session=abc"}},
+			out:   http.Header{"Cookie": {"pref_lang=en; pref_tz=UTC"}},
+		},
+		{
+			name:  "with a value pattern",
+			match: makeCookieMatch(ConfigRule{Whitelist: "lang", Pattern: "^[a-z]{2}$"}),
+			in:    http.Header{"Cookie": {"lang=en", "lang=diggy@net.cool"}},
+			out:   http.Header{"Cookie": {"lang=en"}},
+		},
+		{
+			name:  "with an action",
+			match: makeCookieMatch(ConfigRule{Whitelist: "session", Action: "mask", Keep: 2}),
+			in:    http.Header{"Cookie": {"session=abcdef"}},
+			out:   http.Header{"Cookie": {"session=****ef"}},
+		},
+		{
+			name:  "with no whitelisted cookies",
+			match: makeCookieMatch(ConfigRule{Whitelist: "session"}),
+			in:    http.Header{"Cookie": {"_ga=GA1.2.3"}, "User-Agent": {"curl"}},
+			out:   http.Header{"User-Agent": {"curl"}},
+		},
+		{
+			name:  "with set-cookies",
+			match: makeCookieMatch(ConfigRule{Whitelist: "session"}),
+			in:    http.Header{"Set-Cookie": {"session=abc; Path=/; HttpOnly", "_ga=GA1.2.3; Max-Age=100"}},
+			out:   http.Header{"Set-Cookie": {"session=abc; Path=/; HttpOnly"}},
+		},
+		{
+			name:  "with a set-cookie action",
+			match: makeCookieMatch(ConfigRule{Whitelist: "session", Action: "literal", Value: "x"}),
+			in:    http.Header{"Set-Cookie": {"session=abc; Secure"}},
+			out:   http.Header{"Set-Cookie": {"session=x; Secure"}},
+		},
+		{
+			name:  "with a replacement that isn't a cookie value",
+			match: makeCookieMatch(ConfigRule{Whitelist: "session", Action: "literal", Value: "x; Domain=evil.com"}),
+			in:    http.Header{"Set-Cookie": {"session=abc; Secure"}, "Cookie": {"session=abc; lang=en"}},
+			out:   http.Header{"Set-Cookie": {"session=REDACTED; Secure"}, "Cookie": {"session=REDACTED"}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			in := c.in.Clone()
+			assert.Equal(t, c.out, RedactCookies(c.match, c.in))
+			assert.Equal(t, in, c.in)
+		})
+	}
+}
+
+func TestRedactHeaderWithCookies(t *testing.T) {
+	match := HTTPMatch{RuleOptions: RuleOptions{
+		Header: []ConfigRule{ConfigRule{Whitelist: "User-Agent"}},
+		Cookie: []ConfigRule{ConfigRule{Whitelist: "session"}},
+	}}
+
+	header := http.Header{
+		"Cookie":     {"session=abc; _ga=GA1.2.3"},
+		"User-Agent": {"curl"},
+		"Referer":    {"https://example.com"},
+	}
+
+	assert.Equal(t, http.Header{
+		"Cookie":     {"session=abc"},
+		"User-Agent": {"curl"},
+		"Referer":    {"REDACTED"},
+	}, RedactHeader(match, header))
+}
+
+func TestValidateCookieRules(t *testing.T) {
+	assert.Nil(t, validateCookieRules([]ConfigRule{ConfigRule{Whitelist: "session", Pattern: "^[a-f0-9]+$"}}))
+	assert.NotNil(t, validateCookieRules([]ConfigRule{ConfigRule{Whitelist: "session", Pattern: "("}}))
+	assert.NotNil(t, validateCookieRules([]ConfigRule{ConfigRule{Whitelist: "session", Action: "fake"}}))
+	assert.Nil(t, validateCookieRules([]ConfigRule{ConfigRule{Whitelist: "session", Action: "literal", Value: "none"}}))
+	assert.Nil(t, validateCookieRules([]ConfigRule{ConfigRule{Whitelist: "session", Action: "literal", Value: 0}}))
+	assert.Nil(t, validateCookieRules([]ConfigRule{ConfigRule{Whitelist: "session", Action: "literal", Value: ""}}))
+
+	for _, literal := range []string{"a; Domain=evil.com", "a,b", "a b", `"a"`, "caf\u00e9"} {
+		assert.NotNil(t, validateCookieRules([]ConfigRule{ConfigRule{Whitelist: "session", Action: "literal", Value: literal}}), literal)
+	}
+}
@@ -0,0 +1,263 @@
+package redactor
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Delimiters of the fields of CSV and TSV bodies.
+const (
+	csvDelimiter = ','
+	tsvDelimiter = '\t'
+)
+
+// A field of a CSV record, and whether it was quoted, so it's written back
+// the same way.
+type csvField struct {
+	value  string
+	quoted bool
+}
+
+// A CSV record and the line ending that followed it ("\r\n", "\n" or, for
+// the last record, nothing).  A blank line is a record with no fields.
+type csvRecord struct {
+	fields []csvField
+	end    string
+}
+
+// Parses a CSV (RFC 4180) or TSV document.  Quoted fields may hold
+// delimiters, newlines and doubled quotes.  Returns an error if a quoted
+// field isn't terminated, or is followed by anything but a delimiter or line
+// ending.
+func parseCSV(data []byte, delimiter byte) ([]csvRecord, error) {
+	records := []csvRecord{}
+	s := string(data)
+	line := 1
+
+	for i := 0; i < len(s); {
+		record := csvRecord{fields: []csvField{}}
+
+		for {
+			if i < len(s) && s[i] == '"' {
+				var value strings.Builder
+				start := line
+
+				for i++; ; i++ {
+					if i >= len(s) {
+						return nil, fmt.Errorf("line %d: unterminated quoted field", start)
+					}
+
+					if s[i] == '"' {
+						if i+1 < len(s) && s[i+1] == '"' {
+							value.WriteByte('"')
+							i++
+							continue
+						}
+						i++
+						break
+					}
+
+					if s[i] == '\n' {
+						line++
+					}
+					value.WriteByte(s[i])
+				}
+
+				record.fields = append(record.fields, csvField{value: value.String(), quoted: true})
+
+				if i < len(s) && s[i] != delimiter && s[i] != '\n' && !strings.HasPrefix(s[i:], "\r\n") {
+					return nil, fmt.Errorf("line %d: unexpected %q after quoted field", line, s[i])
+				}
+			} else {
+				end := i
+				for end < len(s) && s[end] != delimiter && s[end] != '\n' && !strings.HasPrefix(s[end:], "\r\n") {
+					end++
+				}
+
+				record.fields = append(record.fields, csvField{value: s[i:end]})
+				i = end
+			}
+
+			if i < len(s) && s[i] == delimiter {
+				i++
+				continue
+			}
+
+			break
+		}
+
+		switch {
+		case strings.HasPrefix(s[i:], "\r\n"):
+			record.end = "\r\n"
+		case strings.HasPrefix(s[i:], "\n"):
+			record.end = "\n"
+		}
+		i += len(record.end)
+		line++
+
+		// A blank line has a single empty, unquoted field.
+		if len(record.fields) == 1 && record.fields[0] == (csvField{}) {
+			record.fields = []csvField{}
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// Writes records back out, quoting the fields that were quoted or now need
+// to be.
+func writeCSV(records []csvRecord, delimiter byte) []byte {
+	var buffer bytes.Buffer
+
+	for _, record := range records {
+		for i, field := range record.fields {
+			if i > 0 {
+				buffer.WriteByte(delimiter)
+			}
+
+			if field.quoted || needsCSVQuotes(field.value, delimiter) {
+				buffer.WriteString(`"` + strings.Replace(field.value, `"`, `""`, -1) + `"`)
+			} else {
+				buffer.WriteString(field.value)
+			}
+		}
+
+		buffer.WriteString(record.end)
+	}
+
+	return buffer.Bytes()
+}
+
+// Returns true iff an unquoted field would be misread: if it holds a
+// delimiter or line break, or starts with a quote.
+func needsCSVQuotes(value string, delimiter byte) bool {
+	return strings.ContainsAny(value, string(delimiter)+"\r\n") || strings.HasPrefix(value, `"`)
+}
+
+// Redacts a CSV or TSV document against a list of location whitelist rules,
+// as though it were an Array of rows.  If `header` is set, the first record
+// names the columns and is kept, and each row is an Object keyed by column,
+// so `$[*].email` whitelists the email column; otherwise rows are Arrays, and
+// columns are whitelisted by index, as in `$[*][2]`.  Cells that aren't
+// whitelisted are redacted, and the quoting, delimiter, line endings and
+// number of rows and cells are kept.
+//
+// Rules apply to cells: a row or document can only be passed through whole.
+// A cell that's dropped or nulled is left empty.
+func redactCSV(rules []ConfigRule, data []byte, delimiter byte, header bool) ([]byte, error) {
+	records, err := parseCSV(data, delimiter)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	// Rows share their fields with records, so redacting a row's cells
+	// redacts the document.
+	rows := []csvRecord{}
+	var columns []csvField
+	for _, record := range records {
+		if len(record.fields) == 0 {
+			continue
+		}
+
+		if header && columns == nil {
+			columns = record.fields
+			continue
+		}
+
+		rows = append(rows, record)
+	}
+
+	if hasPathWhitelistPass(rules, nil) {
+		return writeCSV(records, delimiter), nil
+	}
+
+	for i, row := range rows {
+		rowStep := pathStep{index: i, isIndex: true, length: len(rows), value: csvRowValue(row, columns, header), hasValue: true}
+		if hasPathWhitelistPass(rules, []pathStep{rowStep}) {
+			continue
+		}
+
+		for j, field := range row.fields {
+			cellStep := pathStep{index: j, isIndex: true, length: len(row.fields), value: field.value, hasValue: true}
+			if header {
+				if j >= len(columns) {
+					row.fields[j].value = RedactedStr
+					continue
+				}
+				cellStep = pathStep{key: columns[j].value, value: field.value, hasValue: true}
+			}
+
+			row.fields[j].value = redactCSVCell(rules, field.value, []pathStep{rowStep, cellStep})
+		}
+	}
+
+	return writeCSV(records, delimiter), nil
+}
+
+// Returns true iff a rule passes the container at `path` through whole.
+func hasPathWhitelistPass(rules []ConfigRule, path []pathStep) bool {
+	rule, ok := findPathWhitelistMatch(rules, path, true)
+	return ok && rule.action() == ActionPass
+}
+
+// Returns a row as the value filters see: an Object keyed by column if the
+// document has a header (the first of any duplicate columns winning), or an
+// Array of cells.
+func csvRowValue(row csvRecord, columns []csvField, header bool) interface{} {
+	if !header {
+		cells := make([]interface{}, len(row.fields))
+		for i, field := range row.fields {
+			cells[i] = field.value
+		}
+		return cells
+	}
+
+	cells := map[string]interface{}{}
+	for i, field := range row.fields {
+		if i >= len(columns) {
+			break
+		}
+
+		if _, ok := cells[columns[i].value]; !ok {
+			cells[columns[i].value] = field.value
+		}
+	}
+	return cells
+}
+
+// Redacts the value of a cell at `path` according to the rule matching it.
+// Replacements that aren't strings are formatted (or, if they're Objects or
+// Arrays, redacted), and a dropped or nulled cell is left empty.
+func redactCSVCell(rules []ConfigRule, value string, path []pathStep) string {
+	rule, ok := findPathWhitelistMatch(rules, path, false)
+	if !ok {
+		return RedactedStr
+	}
+
+	switch rule.action() {
+	case ActionPass:
+		return value
+	case ActionDrop, ActionNull:
+		return ""
+	case actionDecode:
+		return fmt.Sprint(redactEncoded(rules, rule.Decode, value, path))
+	}
+
+	replaced, ok := rule.replace(value)
+	if !ok {
+		return RedactedStr
+	}
+
+	if replaced == nil {
+		return ""
+	}
+
+	if isContainer(replaced) {
+		return RedactedStr
+	}
+
+	return fmt.Sprint(replaced)
+}
@@ -0,0 +1,169 @@
+package redactor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCSV(t *testing.T) {
+	type testCase struct {
+		name    string
+		in      string
+		records []csvRecord
+		valid   bool
+	}
+
+	cases := []testCase{
+		{
+			name: "with plain and quoted fields",
+			in:   "a,\"b, c\",\"d \"\"e\"\"\"\r\n1,,\"2\nline\"\n",
+			records: []csvRecord{
+				{fields: []csvField{{value: "a"}, {value: "b, c", quoted: true}, {value: `d "e"`, quoted: true}}, end: "\r\n"},
+				{fields: []csvField{{value: "1"}, {value: ""}, {value: "2\nline", quoted: true}}, end: "\n"},
+			},
+			valid: true,
+		},
+		{
+			name: "with blank lines and no trailing newline",
+			in:   "a\n\n\"\"",
+			records: []csvRecord{
+				{fields: []csvField{{value: "a"}}, end: "\n"},
+				{fields: []csvField{}, end: "\n"},
+				{fields: []csvField{{value: "", quoted: true}}},
+			},
+			valid: true,
+		},
+		{name: "with no records", in: "", records: []csvRecord{}, valid: true},
+		{name: "with an unterminated quote", in: "a,\"b\n"},
+		{name: "with text after a quote", in: "\"a\"b,c\n"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			records, err := parseCSV([]byte(c.in), csvDelimiter)
+			assert.Equal(t, c.valid, err == nil)
+			if c.valid {
+				assert.Equal(t, c.records, records)
+				assert.Equal(t, c.in, string(writeCSV(records, csvDelimiter)))
+			}
+		})
+	}
+}
+
+func TestRedactCSV(t *testing.T) {
+	type testCase struct {
+		name      string
+		rules     []ConfigRule
+		delimiter byte
+		header    bool
+		in        string
+		out       string
+	}
+
+	cases := []testCase{
+		{
+			name:      "with no rules",
+			rules:     []ConfigRule{},
+			delimiter: csvDelimiter,
+			header:    true,
+			in:        "id,email\n1,diggy@net.cool\n",
+			out:       "id,email\nREDACTED,REDACTED\n",
+		},
+		{
+			name:      "with whitelisted columns",
+			rules:     []ConfigRule{ConfigRule{Whitelist: "$[*].id"}, ConfigRule{Whitelist: "$[*].plan"}},
+			delimiter: csvDelimiter,
+			header:    true,
+			in:        "id,email,plan\r\n1,\"diggy@net.cool\",\"pro, annual\"\r\n2,,free\r\n",
+			out:       "id,email,plan\r\n1,\"REDACTED\",\"pro, annual\"\r\n2,REDACTED,free\r\n",
+		},
+		{
+			name:      "with headerless columns",
+			rules:     []ConfigRule{ConfigRule{Whitelist: "$[*][0]"}, ConfigRule{Whitelist: "$[1][-1]"}},
+			delimiter: csvDelimiter,
+			in:        "1,diggy@net.cool,pro\n2,a@b.c,free\n",
+			out:       "1,REDACTED,REDACTED\n2,REDACTED,free\n",
+		},
+		{
+			name:      "with tabs",
+			rules:     []ConfigRule{ConfigRule{Whitelist: "$[*].id"}},
+			delimiter: tsvDelimiter,
+			header:    true,
+			in:        "id\temail\n1\tdiggy@net.cool\n",
+			out:       "id\temail\n1\tREDACTED\n",
+		},
+		{
+			name: "with rule actions",
+			rules: []ConfigRule{
+				ConfigRule{Whitelist: "$[*].card", Action: "mask", Keep: 4},
+				ConfigRule{Whitelist: "$[*].cvv", Action: "drop"},
+				ConfigRule{Whitelist: "$[*].lat", Action: "round", Digits: 2},
+			},
+			delimiter: csvDelimiter,
+			header:    true,
+			in:        "card,cvv,lat\n4242424242424242,123,40.712776\n",
+			out:       "card,cvv,lat\n************4242,,40.71\n",
+		},
+		{
+			name:      "with a filter",
+			rules:     []ConfigRule{ConfigRule{Whitelist: "$[?(@.country == 'US')].email"}},
+			delimiter: csvDelimiter,
+			header:    true,
+			in:        "email,country\na@b.c,US\nd@e.f,DE\n",
+			out:       "email,country\na@b.c,REDACTED\nREDACTED,REDACTED\n",
+		},
+		{
+			name:      "with a whitelisted row",
+			rules:     []ConfigRule{ConfigRule{Whitelist: "$[0]"}},
+			delimiter: csvDelimiter,
+			header:    true,
+			in:        "id,email\n1,a@b.c\n2,d@e.f\n",
+			out:       "id,email\n1,a@b.c\nREDACTED,REDACTED\n",
+		},
+		{
+			name:      "with ragged rows and blank lines",
+			rules:     []ConfigRule{ConfigRule{Whitelist: "$[*].id"}},
+			delimiter: csvDelimiter,
+			header:    true,
+			in:        "\nid\n\n1,extra\n",
+			out:       "\nid\n\n1,REDACTED\n",
+		},
+		{
+			name:      "with a decoded cell",
+			rules:     []ConfigRule{ConfigRule{Whitelist: "$[*].payload", Decode: "json"}, ConfigRule{Whitelist: "$[*].payload.type"}},
+			delimiter: csvDelimiter,
+			header:    true,
+			in:        "payload\n\"{\"\"type\"\":\"\"signup\"\",\"\"ip\"\":\"\"10.0.0.1\"\"}\"\n",
+			out:       "payload\n\"{\"\"ip\"\":\"\"REDACTED\"\",\"\"type\"\":\"\"signup\"\"}\"\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out, err := redactCSV(c.rules, []byte(c.in), c.delimiter, c.header)
+			assert.Nil(t, err)
+			assert.Equal(t, c.out, string(out))
+		})
+	}
+}
+
+func TestMapBodyWithCSV(t *testing.T) {
+	match := HTTPMatch{RuleOptions: RuleOptions{Body: []ConfigRule{ConfigRule{Whitelist: "$[*].id"}, ConfigRule{Whitelist: "$[*][0]"}}}}
+
+	body, err := MapBody(match, "text/csv; charset=utf-8", []byte("id,email\n1,a@b.c\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "id,email\n1,REDACTED\n", string(body))
+
+	body, err = MapBody(match, "text/csv; header=absent", []byte("1,a@b.c\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1,REDACTED\n", string(body))
+
+	body, err = MapBody(match, "text/tab-separated-values", []byte("id\temail\n1\ta@b.c\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "id\temail\n1\tREDACTED\n", string(body))
+
+	body, err = MapBody(match, "text/csv", []byte("id\n\"1\n"))
+	assert.NotNil(t, err)
+	assert.Equal(t, []byte{}, body)
+}
@@ -0,0 +1,124 @@
+package redactor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Encodings a rule may `decode` the strings at its location from, so the
+// payloads nested in them are redacted rather than the whole string.
+const (
+	DecodeJSON       = "json"
+	DecodeBase64JSON = "base64+json"
+)
+
+// The action of a rule that decodes its values.  It isn't configured with
+// `action`, but by setting `decode` on a rule (see ConfigRule.action).
+const actionDecode = "decode"
+
+// The base64 alphabets a "base64+json" payload may be encoded with, with and
+// without padding.  The payload is re-encoded with the one that decoded it.
+var (
+	paddedEncodings   = []*base64.Encoding{base64.StdEncoding, base64.URLEncoding}
+	unpaddedEncodings = []*base64.Encoding{base64.RawStdEncoding, base64.RawURLEncoding}
+)
+
+// Returns an error if the rule's decode options are invalid.  Decoding
+// replaces the rule's action, so the two can't be combined.
+func (r ConfigRule) validateDecode() error {
+	if r.Decode == "" {
+		return fmt.Errorf("unknown action %q", r.Action)
+	}
+
+	if r.Action != "" {
+		return fmt.Errorf("decode can't be combined with action %q", r.Action)
+	}
+
+	switch r.Decode {
+	case DecodeJSON, DecodeBase64JSON:
+		return nil
+	}
+
+	return fmt.Errorf("unknown decode %q", r.Decode)
+}
+
+// Decodes the encoded payload at `path` and redacts it against `rules`, with
+// its locations nested beneath `path`, then re-encodes it in its place.
+// Values that aren't strings are redacted as usual.  If the payload can't be
+// decoded or re-encoded, the error is logged (without the payload) and the
+// value is redacted.
+func redactEncoded(rules []ConfigRule, format string, value interface{}, path []pathStep) interface{} {
+	s, ok := value.(string)
+	if !ok {
+		return redactValue(rules, value, path)
+	}
+
+	decoded, encoding, err := decodePayload(format, s)
+	if err != nil {
+		log.Printf("failed to decode %s payload at %s: %v\n", format, pathLocation(path), err)
+		return RedactedStr
+	}
+
+	encoded, err := encodePayload(encoding, redactValue(rules, decoded, path))
+	if err != nil {
+		log.Printf("failed to encode %s payload at %s: %v\n", format, pathLocation(path), err)
+		return RedactedStr
+	}
+
+	return encoded
+}
+
+// Decodes a payload in `format`, returning the base64 alphabet it was encoded
+// with, if any.
+func decodePayload(format string, s string) (interface{}, *base64.Encoding, error) {
+	data := []byte(s)
+	var encoding *base64.Encoding
+
+	if format == DecodeBase64JSON {
+		encodings := unpaddedEncodings
+		if strings.HasSuffix(s, "=") {
+			encodings = paddedEncodings
+		}
+
+		for _, e := range encodings {
+			if decoded, err := e.DecodeString(s); err == nil {
+				data, encoding = decoded, e
+				break
+			}
+		}
+
+		if encoding == nil {
+			return nil, nil, fmt.Errorf("invalid base64")
+		}
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, nil, err
+	}
+
+	return decoded, encoding, nil
+}
+
+// Encodes a redacted payload as JSON, then in base64 if `encoding` is set.
+// Unlike json.Marshal, HTML characters aren't escaped, so the rest of the
+// payload is left as it was.
+func encodePayload(encoding *base64.Encoding, value interface{}) (string, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return "", err
+	}
+
+	data := bytes.TrimSuffix(buffer.Bytes(), []byte("\n"))
+	if encoding != nil {
+		return encoding.EncodeToString(data), nil
+	}
+
+	return string(data), nil
+}
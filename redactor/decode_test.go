@@ -0,0 +1,158 @@
+package redactor
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactEncoded(t *testing.T) {
+	encode := func(e *base64.Encoding, s string) string {
+		return e.EncodeToString([]byte(s))
+	}
+
+	type testCase struct {
+		name  string
+		rules []ConfigRule
+		in    map[string]interface{}
+		out   map[string]interface{}
+	}
+
+	cases := []testCase{
+		{
+			name: "with a json payload",
+			rules: []ConfigRule{
+				ConfigRule{Whitelist: "$.payload", Decode: "json"},
+				ConfigRule{Whitelist: "$.payload.type"},
+			},
+			in:  map[string]interface{}{"payload": `{"type":"signup","email":"diggy@net.cool"}`},
+			out: map[string]interface{}{"payload": `{"email":"REDACTED","type":"signup"}`},
+		},
+		{
+			name: "with a base64 payload",
+			rules: []ConfigRule{
+				ConfigRule{Whitelist: "$.data", Decode: "base64+json"},
+				ConfigRule{Whitelist: "$.data.user.id"},
+			},
+			in:  map[string]interface{}{"data": encode(base64.StdEncoding, `{"user":{"id":7,"name":"Diggy"}}`)},
+			out: map[string]interface{}{"data": encode(base64.StdEncoding, `{"user":{"id":7,"name":"REDACTED"}}`)},
+		},
+		{
+			name: "with an unpadded url-safe base64 payload",
+			rules: []ConfigRule{
+				ConfigRule{Whitelist: "$.data", Decode: "base64+json"},
+				ConfigRule{Whitelist: "$.data.id"},
+			},
+			in:  map[string]interface{}{"data": encode(base64.RawURLEncoding, `{"id":"??>","name":"Diggy"}`)},
+			out: map[string]interface{}{"data": encode(base64.RawURLEncoding, `{"id":"??>","name":"REDACTED"}`)},
+		},
+		{
+			name: "with nested payloads",
+			rules: []ConfigRule{
+				ConfigRule{Whitelist: "$.messages[*].body", Decode: "json"},
+				ConfigRule{Whitelist: "$.messages[*].body.event", Decode: "json"},
+				ConfigRule{Whitelist: "$.messages[*].body.event.kind"},
+			},
+			in: map[string]interface{}{"messages": []interface{}{
+				map[string]interface{}{"body": `{"event":"{\"kind\":\"click\",\"ip\":\"10.0.0.1\"}"}`},
+			}},
+			out: map[string]interface{}{"messages": []interface{}{
+				map[string]interface{}{"body": `{"event":"{\"ip\":\"REDACTED\",\"kind\":\"click\"}"}`},
+			}},
+		},
+		{
+			name: "with rule actions in the payload",
+			rules: []ConfigRule{
+				ConfigRule{Whitelist: "$.payload", Decode: "json"},
+				ConfigRule{Whitelist: "$.payload.card", Action: "mask", Keep: 4},
+				ConfigRule{Whitelist: "$.payload.cvv", Action: "drop"},
+			},
+			in:  map[string]interface{}{"payload": `{"card":"4242424242424242","cvv":"123"}`},
+			out: map[string]interface{}{"payload": `{"card":"************4242"}`},
+		},
+		{
+			name: "with a decoded object",
+			rules: []ConfigRule{
+				ConfigRule{Whitelist: "$.payload", Decode: "json"},
+				ConfigRule{Whitelist: "$.payload.type"},
+			},
+			in:  map[string]interface{}{"payload": map[string]interface{}{"type": "signup", "email": "diggy@net.cool"}},
+			out: map[string]interface{}{"payload": map[string]interface{}{"type": "signup", "email": "REDACTED"}},
+		},
+		{
+			name: "with invalid json",
+			rules: []ConfigRule{
+				ConfigRule{Whitelist: "$.payload", Decode: "json"},
+				ConfigRule{Whitelist: "$.payload.type"},
+			},
+			in:  map[string]interface{}{"payload": `{"type":`},
+			out: map[string]interface{}{"payload": "REDACTED"},
+		},
+		{
+			name: "with invalid base64",
+			rules: []ConfigRule{
+				ConfigRule{Whitelist: "$.data", Decode: "base64+json"},
+			},
+			in:  map[string]interface{}{"data": "diggy@net.cool"},
+			out: map[string]interface{}{"data": "REDACTED"},
+		},
+		{
+			name: "with a value pattern",
+			rules: []ConfigRule{
+				ConfigRule{Whitelist: "$.payload", Pattern: "^\\{", Decode: "json"},
+				ConfigRule{Whitelist: "$.payload.type"},
+			},
+			in:  map[string]interface{}{"payload": `"diggy@net.cool"`},
+			out: map[string]interface{}{"payload": "REDACTED"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.out, redact(c.rules, c.in, "$"))
+		})
+	}
+}
+
+func TestRedactProtobufWithDecode(t *testing.T) {
+	descriptors := loadTestDescriptors(t)
+	user := descriptors.messages["test.User"]
+
+	rules := []ConfigRule{
+		ConfigRule{Whitelist: "$.id", Decode: "json"},
+		ConfigRule{Whitelist: "$.id.kind"},
+	}
+
+	message := pbConcat(pbString(1, `{"kind":"user","email":"diggy@net.cool"}`))
+	redacted, err := redactProtobuf(rules, descriptors, user, message, "$")
+	assert.Nil(t, err)
+	assert.Equal(t, pbConcat(pbString(1, `{"email":"REDACTED","kind":"user"}`)), redacted)
+}
+
+func TestValidateDecode(t *testing.T) {
+	type testCase struct {
+		name  string
+		rule  ConfigRule
+		valid bool
+	}
+
+	cases := []testCase{
+		{name: "with json", rule: ConfigRule{Decode: "json"}, valid: true},
+		{name: "with base64 json", rule: ConfigRule{Decode: "base64+json"}, valid: true},
+		{name: "with an unknown encoding", rule: ConfigRule{Decode: "xml"}},
+		{name: "with an action", rule: ConfigRule{Decode: "json", Action: "mask"}},
+		{name: "with a decode action", rule: ConfigRule{Action: "decode"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.rule.validateAction()
+			assert.Equal(t, c.valid, err == nil)
+		})
+	}
+
+	assert.NotNil(t, validateQueryRules("", []ConfigRule{ConfigRule{Whitelist: "payload", Decode: "json"}}))
+	assert.NotNil(t, validateCookieRules([]ConfigRule{ConfigRule{Whitelist: "session", Decode: "base64+json"}}))
+	assert.NotNil(t, validateHeaderRules([]ConfigRule{ConfigRule{Whitelist: "X-Payload", Decode: "json"}}))
+}
@@ -0,0 +1,293 @@
+package redactor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A filter predicate of a location, like `?(@.type == 'click')`.  It's a
+// disjunction (`||`) of conjunctions (`&&`) of comparisons.
+type filter struct {
+	any [][]comparison
+}
+
+// A comparison of the value at a path relative to `@` with a literal.  If op
+// is empty, it tests that the path exists.
+type comparison struct {
+	path  []pathStep
+	op    string
+	value interface{}
+}
+
+// Comparison operators, longest first so they're matched greedily.
+var comparisonOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// Parses the filter starting at `location[i]` (the `?`), returning it and the
+// offset just after its closing parenthesis.  A filter is written
+// `?(<expression>)` where the expression is one or more comparisons joined by
+// `&&` or `||`.  A comparison is a path relative to the filtered value,
+// written `@`, optionally followed by an operator and a literal:
+//
+//	@.type == 'click'
+//	@.price >= 10 && @.currency == "USD"
+//	@.tags[0]
+//
+// Literals are quoted strings, numbers, `true`, `false` and `null`.
+// Operators are `==`, `!=`, `<`, `<=`, `>` and `>=`; ordering only applies to
+// two numbers or two strings.
+func parseFilter(location string, i int) (*filter, int, error) {
+	start := i
+	if !strings.HasPrefix(location[i:], "?(") {
+		return nil, 0, fmt.Errorf("invalid filter at offset %d", start)
+	}
+	i += 2
+
+	f := &filter{}
+	conjunction := []comparison{}
+
+	for {
+		var c comparison
+		var err error
+
+		c, i, err = parseComparison(location, i)
+		if err != nil {
+			return nil, 0, err
+		}
+		conjunction = append(conjunction, c)
+
+		i = skipSpaces(location, i)
+
+		switch {
+		case strings.HasPrefix(location[i:], "&&"):
+			i += 2
+		case strings.HasPrefix(location[i:], "||"):
+			f.any = append(f.any, conjunction)
+			conjunction = []comparison{}
+			i += 2
+		case strings.HasPrefix(location[i:], ")"):
+			f.any = append(f.any, conjunction)
+			return f, i + 1, nil
+		default:
+			return nil, 0, fmt.Errorf("unterminated filter at offset %d", start)
+		}
+	}
+}
+
+// Parses a comparison starting at `location[i]`.
+func parseComparison(location string, i int) (comparison, int, error) {
+	i = skipSpaces(location, i)
+	if i >= len(location) || location[i] != '@' {
+		return comparison{}, 0, fmt.Errorf("filter must compare @ at offset %d", i)
+	}
+	i++
+
+	c := comparison{}
+
+	// The relative path: keys and non-negative indexes.
+	for i < len(location) {
+		if location[i] == '.' {
+			start := i + 1
+			i = start
+			for i < len(location) && !strings.ContainsRune(reservedKeyChars+" =!<>&|", rune(location[i])) {
+				i++
+			}
+
+			key := location[start:i]
+			if !isBareKey(key) {
+				return comparison{}, 0, fmt.Errorf("invalid key %q at offset %d", key, start)
+			}
+
+			c.path = append(c.path, pathStep{key: key})
+			continue
+		}
+
+		if location[i] == '[' {
+			seg, end, err := parseBracket(location, i)
+			if err != nil {
+				return comparison{}, 0, err
+			}
+
+			switch {
+			case seg.kind == segmentKey:
+				c.path = append(c.path, pathStep{key: seg.key})
+			case seg.kind == segmentIndex && seg.index >= 0:
+				c.path = append(c.path, pathStep{index: seg.index, isIndex: true})
+			default:
+				return comparison{}, 0, fmt.Errorf("filter paths only support keys and indexes at offset %d", i)
+			}
+
+			i = end
+			continue
+		}
+
+		break
+	}
+
+	i = skipSpaces(location, i)
+
+	for _, op := range comparisonOps {
+		if strings.HasPrefix(location[i:], op) {
+			c.op = op
+			i += len(op)
+			break
+		}
+	}
+
+	if c.op == "" {
+		return c, i, nil
+	}
+
+	value, i, err := parseLiteral(location, skipSpaces(location, i))
+	if err != nil {
+		return comparison{}, 0, err
+	}
+	c.value = value
+
+	return c, i, nil
+}
+
+// Parses the literal starting at `location[i]`.  Numbers are parsed as float64
+// to match decoded JSON.
+func parseLiteral(location string, i int) (interface{}, int, error) {
+	if i >= len(location) {
+		return nil, 0, fmt.Errorf("missing literal at offset %d", i)
+	}
+
+	if location[i] == '\'' || location[i] == '"' {
+		return parseQuoted(location, i)
+	}
+
+	start := i
+	for i < len(location) && !strings.ContainsRune(" &|)", rune(location[i])) {
+		i++
+	}
+
+	text := location[start:i]
+	switch text {
+	case "true":
+		return true, i, nil
+	case "false":
+		return false, i, nil
+	case "null":
+		return nil, i, nil
+	}
+
+	number, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid literal %q at offset %d", text, start)
+	}
+
+	return number, i, nil
+}
+
+func skipSpaces(location string, i int) int {
+	for i < len(location) && location[i] == ' ' {
+		i++
+	}
+
+	return i
+}
+
+// Returns true iff the filter matches a value.
+func (f *filter) eval(value interface{}) bool {
+	for _, conjunction := range f.any {
+		matched := true
+		for _, c := range conjunction {
+			if !c.eval(value) {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns true iff the comparison matches a value.  Comparisons against a path
+// that doesn't exist, or against a container, never match.
+func (c comparison) eval(value interface{}) bool {
+	actual, ok := lookupPath(value, c.path)
+	if !ok {
+		return false
+	}
+
+	if c.op == "" {
+		return true
+	}
+
+	switch actual.(type) {
+	case map[string]interface{}, []interface{}:
+		return false
+	}
+
+	switch c.op {
+	case "==":
+		return actual == c.value
+	case "!=":
+		return actual != c.value
+	}
+
+	if a, ok := actual.(float64); ok {
+		if b, ok := c.value.(float64); ok {
+			return compareOrdered(c.op, a < b, a == b)
+		}
+	}
+
+	if a, ok := actual.(string); ok {
+		if b, ok := c.value.(string); ok {
+			return compareOrdered(c.op, a < b, a == b)
+		}
+	}
+
+	return false
+}
+
+func compareOrdered(op string, less bool, equal bool) bool {
+	switch op {
+	case "<":
+		return less
+	case "<=":
+		return less || equal
+	case ">":
+		return !less && !equal
+	case ">=":
+		return !less
+	}
+
+	return false
+}
+
+// Returns the value at a path of keys and indexes within a decoded document,
+// and whether it exists.
+func lookupPath(value interface{}, path []pathStep) (interface{}, bool) {
+	for _, step := range path {
+		switch typed := value.(type) {
+		case map[string]interface{}:
+			if step.isIndex {
+				return nil, false
+			}
+
+			v, ok := typed[step.key]
+			if !ok {
+				return nil, false
+			}
+			value = v
+
+		case []interface{}:
+			if !step.isIndex || step.index >= len(typed) {
+				return nil, false
+			}
+			value = typed[step.index]
+
+		default:
+			return nil, false
+		}
+	}
+
+	return value, true
+}
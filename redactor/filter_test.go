@@ -0,0 +1,123 @@
+package redactor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFilter(t *testing.T) {
+	type testCase struct {
+		name     string
+		location string
+		out      *filter
+		valid    bool
+	}
+
+	cases := []testCase{
+		{
+			name:     "with an existence check",
+			location: "?(@.a)",
+			out:      &filter{any: [][]comparison{{comparison{path: []pathStep{pathStep{key: "a"}}}}}},
+			valid:    true,
+		},
+		{
+			name:     "with a string comparison",
+			location: `?(@.type=="click")`,
+			out:      &filter{any: [][]comparison{{comparison{path: []pathStep{pathStep{key: "type"}}, op: "==", value: "click"}}}},
+			valid:    true,
+		},
+		{
+			name:     "with conjunctions and disjunctions",
+			location: "?(@['a b'][0] >= 1.5 && @.c != null || @.d == true)",
+			out: &filter{any: [][]comparison{
+				{
+					comparison{path: []pathStep{pathStep{key: "a b"}, pathStep{index: 0, isIndex: true}}, op: ">=", value: 1.5},
+					comparison{path: []pathStep{pathStep{key: "c"}}, op: "!=", value: nil},
+				},
+				{
+					comparison{path: []pathStep{pathStep{key: "d"}}, op: "==", value: true},
+				},
+			}},
+			valid: true,
+		},
+		{
+			name:     "with no @",
+			location: "?(a == 1)",
+			valid:    false,
+		},
+		{
+			name:     "with an invalid literal",
+			location: "?(@.a == click)",
+			valid:    false,
+		},
+		{
+			name:     "with no closing parenthesis",
+			location: "?(@.a == 1",
+			valid:    false,
+		},
+		{
+			name:     "with a wildcard path",
+			location: "?(@[*] == 1)",
+			valid:    false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			f, end, err := parseFilter(c.location, 0)
+			if !c.valid {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, c.out, f)
+			assert.Equal(t, len(c.location), end)
+		})
+	}
+}
+
+func TestFilterEval(t *testing.T) {
+	value := map[string]interface{}{
+		"type":  "click",
+		"price": 12.0,
+		"tags":  []interface{}{"a", "b"},
+		"user":  map[string]interface{}{"admin": false},
+	}
+
+	type testCase struct {
+		name   string
+		filter string
+		match  bool
+	}
+
+	cases := []testCase{
+		{name: "with an existing key", filter: "?(@.type)", match: true},
+		{name: "with a missing key", filter: "?(@.kind)", match: false},
+		{name: "with an equal string", filter: "?(@.type == 'click')", match: true},
+		{name: "with an unequal string", filter: "?(@.type == 'view')", match: false},
+		{name: "with a not-equal string", filter: "?(@.type != 'view')", match: true},
+		{name: "with a number comparison", filter: "?(@.price > 10)", match: true},
+		{name: "with a failed number comparison", filter: "?(@.price <= 10)", match: false},
+		{name: "with a string ordering", filter: "?(@.type < 'd')", match: true},
+		{name: "with mismatched types", filter: "?(@.price < 'd')", match: false},
+		{name: "with a nested key", filter: "?(@.user.admin == false)", match: true},
+		{name: "with an index", filter: "?(@.tags[1] == 'b')", match: true},
+		{name: "with an index out of range", filter: "?(@.tags[2] == 'b')", match: false},
+		{name: "with a container", filter: "?(@.tags == null)", match: false},
+		{name: "with a conjunction", filter: "?(@.type == 'click' && @.price < 10)", match: false},
+		{name: "with a disjunction", filter: "?(@.type == 'view' || @.price > 10)", match: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			f, _, err := parseFilter(c.filter, 0)
+			assert.Nil(t, err)
+			assert.Equal(t, c.match, f.eval(value))
+		})
+	}
+
+	f, _, _ := parseFilter("?(@.type)", 0)
+	assert.False(t, f.eval("click"))
+}
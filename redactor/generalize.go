@@ -0,0 +1,194 @@
+package redactor
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Precisions dates may be truncated to by ActionTruncateDate.
+const (
+	DateYear  = "year"
+	DateMonth = "month"
+	DateDay   = "day"
+)
+
+// The prefix lengths IP addresses are truncated to by default: the last
+// octet of an IPv4 address and all but the routing prefix of an IPv6 one.
+const (
+	defaultIPv4Prefix = 24
+	defaultIPv6Prefix = 48
+)
+
+// Returns an error if the options of a generalization action are invalid.
+func (r ConfigRule) validateGeneralization() error {
+	switch r.action() {
+	case ActionTruncate:
+		if r.Keep < 0 {
+			return fmt.Errorf("truncate action can't keep %d characters", r.Keep)
+		}
+	case ActionTruncateDate:
+		switch r.To {
+		case DateYear, DateMonth, DateDay:
+		default:
+			return fmt.Errorf("truncate_date action needs `to` of year, month or day, not %q", r.To)
+		}
+	case ActionTruncateIP:
+		if r.IPv4Prefix < 0 || r.IPv4Prefix > 32 || r.IPv6Prefix < 0 || r.IPv6Prefix > 128 {
+			return fmt.Errorf("truncate_ip action has an invalid prefix length")
+		}
+	case ActionRound:
+		if r.Digits < 0 {
+			return fmt.Errorf("round action can't round to %d digits", r.Digits)
+		}
+	case ActionBucket:
+		if (r.Size > 0) == (len(r.Bounds) > 0) {
+			return fmt.Errorf("bucket action needs either a size or bounds")
+		}
+		if !sort.Float64sAreSorted(r.Bounds) {
+			return fmt.Errorf("bucket action bounds must be in ascending order")
+		}
+	}
+
+	return nil
+}
+
+// Returns the generalized value for a value matched by the rule, or false if
+// the value can't be generalized (e.g. a date that can't be parsed), in which
+// case it's redacted as usual.  Numbers may also be given as strings, and
+// keep their type.
+func (r ConfigRule) generalize(value interface{}) (interface{}, bool) {
+	switch r.action() {
+	case ActionTruncate:
+		if s, ok := value.(string); ok {
+			return truncate(s, r.Keep), true
+		}
+	case ActionTruncateDate:
+		if s, ok := value.(string); ok {
+			if truncated, ok := truncateDate(s, r.To); ok {
+				return truncated, true
+			}
+		}
+	case ActionTruncateIP:
+		if s, ok := value.(string); ok {
+			if truncated, ok := truncateIP(s, r.IPv4Prefix, r.IPv6Prefix); ok {
+				return truncated, true
+			}
+		}
+	case ActionRound:
+		return mapNumber(value, func(n float64) (float64, bool) {
+			return round(n, r.Digits), true
+		})
+	case ActionBucket:
+		if r.Size > 0 {
+			return mapNumber(value, func(n float64) (float64, bool) {
+				return math.Floor(n/r.Size) * r.Size, true
+			})
+		}
+		return mapNumber(value, func(n float64) (float64, bool) {
+			return bucket(n, r.Bounds)
+		})
+	}
+
+	return nil, false
+}
+
+// Applies `fn` to a number, or a string holding one.  Returns false if the
+// value isn't a number or `fn` returns false.
+func mapNumber(value interface{}, fn func(float64) (float64, bool)) (interface{}, bool) {
+	switch typedValue := value.(type) {
+	case float64:
+		if n, ok := fn(typedValue); ok {
+			return n, true
+		}
+	case string:
+		n, err := strconv.ParseFloat(typedValue, 64)
+		if err != nil {
+			return nil, false
+		}
+		if n, ok := fn(n); ok {
+			return strconv.FormatFloat(n, 'f', -1, 64), true
+		}
+	}
+
+	return nil, false
+}
+
+// Keeps the first `keep` characters of a string, as in `100` for the postal
+// code `10001`.
+func truncate(s string, keep int) string {
+	runes := []rune(s)
+	if len(runes) <= keep {
+		return s
+	}
+
+	return string(runes[:keep])
+}
+
+// Truncates a date to the start of its year, month or day, keeping its
+// layout, as in `1987-01-01` for `1987-06-05` truncated to the year.
+func truncateDate(s string, to string) (string, bool) {
+	for _, layout := range fakeDateLayouts {
+		t, err := time.ParseInLocation(layout, s, time.UTC)
+		if err != nil {
+			continue
+		}
+
+		switch to {
+		case DateYear:
+			t = time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, t.Location())
+		case DateMonth:
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+		case DateDay:
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		}
+
+		return t.Format(layout), true
+	}
+
+	return "", false
+}
+
+// Zeroes all but the first `ipv4Prefix` or `ipv6Prefix` bits of an IP
+// address, as in `192.168.1.0` for `192.168.1.42`.  Zero prefix lengths take
+// the defaults.
+func truncateIP(s string, ipv4Prefix int, ipv6Prefix int) (string, bool) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return "", false
+	}
+
+	if ipv4Prefix == 0 {
+		ipv4Prefix = defaultIPv4Prefix
+	}
+	if ipv6Prefix == 0 {
+		ipv6Prefix = defaultIPv6Prefix
+	}
+
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(ipv4Prefix, 32)).String(), true
+	}
+
+	return ip.Mask(net.CIDRMask(ipv6Prefix, 128)).String(), true
+}
+
+// Rounds a number to `digits` decimal places, as in `40.71` for the latitude
+// `40.712776` to 2 digits.
+func round(n float64, digits int) float64 {
+	scale := math.Pow(10, float64(digits))
+	return math.Round(n*scale) / scale
+}
+
+// Returns the lower bound of the range a number falls in.  Returns false for
+// numbers below the first bound, which fall in no range.
+func bucket(n float64, bounds []float64) (float64, bool) {
+	i := sort.Search(len(bounds), func(i int) bool { return bounds[i] > n })
+	if i == 0 {
+		return 0, false
+	}
+
+	return bounds[i-1], true
+}
@@ -0,0 +1,79 @@
+package redactor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateGeneralization(t *testing.T) {
+	type testCase struct {
+		name  string
+		rule  ConfigRule
+		valid bool
+	}
+
+	cases := []testCase{
+		{name: "with a truncate", rule: ConfigRule{Action: "truncate", Keep: 3}, valid: true},
+		{name: "with a date truncated to the month", rule: ConfigRule{Action: "truncate_date", To: "month"}, valid: true},
+		{name: "with a date truncated to the hour", rule: ConfigRule{Action: "truncate_date", To: "hour"}, valid: false},
+		{name: "with default ip prefixes", rule: ConfigRule{Action: "truncate_ip"}, valid: true},
+		{name: "with an invalid ip prefix", rule: ConfigRule{Action: "truncate_ip", IPv4Prefix: 33}, valid: false},
+		{name: "with a round", rule: ConfigRule{Action: "round", Digits: 2}, valid: true},
+		{name: "with a negative round", rule: ConfigRule{Action: "round", Digits: -1}, valid: false},
+		{name: "with a bucket size", rule: ConfigRule{Action: "bucket", Size: 10}, valid: true},
+		{name: "with bucket bounds", rule: ConfigRule{Action: "bucket", Bounds: []float64{0, 18, 65}}, valid: true},
+		{name: "with unsorted bucket bounds", rule: ConfigRule{Action: "bucket", Bounds: []float64{18, 0}}, valid: false},
+		{name: "with no bucket size or bounds", rule: ConfigRule{Action: "bucket"}, valid: false},
+		{name: "with a bucket size and bounds", rule: ConfigRule{Action: "bucket", Size: 10, Bounds: []float64{0}}, valid: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.rule.validateAction()
+			assert.Equal(t, c.valid, err == nil)
+		})
+	}
+}
+
+func TestGeneralize(t *testing.T) {
+	type testCase struct {
+		name  string
+		rule  ConfigRule
+		value interface{}
+		out   interface{}
+		ok    bool
+	}
+
+	cases := []testCase{
+		{name: "with a postal code", rule: ConfigRule{Action: "truncate", Keep: 3}, value: "10001", out: "100", ok: true},
+		{name: "with a short postal code", rule: ConfigRule{Action: "truncate", Keep: 3}, value: "10", out: "10", ok: true},
+		{name: "with a date truncated to the year", rule: ConfigRule{Action: "truncate_date", To: "year"}, value: "1987-06-05", out: "1987-01-01", ok: true},
+		{name: "with a timestamp truncated to the month", rule: ConfigRule{Action: "truncate_date", To: "month"}, value: "1987-06-05T04:03:02Z", out: "1987-06-01T00:00:00Z", ok: true},
+		{name: "with a timestamp truncated to the day", rule: ConfigRule{Action: "truncate_date", To: "day"}, value: "1987-06-05T04:03:02Z", out: "1987-06-05T00:00:00Z", ok: true},
+		{name: "with a date in another layout", rule: ConfigRule{Action: "truncate_date", To: "month"}, value: "06/05/1987", out: "06/01/1987", ok: true},
+		{name: "with an unparseable date", rule: ConfigRule{Action: "truncate_date", To: "year"}, value: "last tuesday", out: nil, ok: false},
+		{name: "with an ipv4 address", rule: ConfigRule{Action: "truncate_ip"}, value: "192.168.1.42", out: "192.168.1.0", ok: true},
+		{name: "with an ipv4 prefix", rule: ConfigRule{Action: "truncate_ip", IPv4Prefix: 16}, value: "192.168.1.42", out: "192.168.0.0", ok: true},
+		{name: "with an ipv6 address", rule: ConfigRule{Action: "truncate_ip"}, value: "2001:db8:85a3::8a2e:370:7334", out: "2001:db8:85a3::", ok: true},
+		{name: "with an invalid ip", rule: ConfigRule{Action: "truncate_ip"}, value: "localhost", out: nil, ok: false},
+		{name: "with a latitude", rule: ConfigRule{Action: "round", Digits: 2}, value: 40.712776, out: 40.71, ok: true},
+		{name: "with a latitude string", rule: ConfigRule{Action: "round", Digits: 1}, value: "-74.005974", out: "-74", ok: true},
+		{name: "with a non-numeric string", rule: ConfigRule{Action: "round", Digits: 1}, value: "north", out: nil, ok: false},
+		{name: "with a bucket size", rule: ConfigRule{Action: "bucket", Size: 10}, value: 37.0, out: 30.0, ok: true},
+		{name: "with bucket bounds", rule: ConfigRule{Action: "bucket", Bounds: []float64{0, 18, 25, 65}}, value: 37.0, out: 25.0, ok: true},
+		{name: "with a number above the bounds", rule: ConfigRule{Action: "bucket", Bounds: []float64{0, 18, 25, 65}}, value: 90.0, out: 65.0, ok: true},
+		{name: "with a number below the bounds", rule: ConfigRule{Action: "bucket", Bounds: []float64{18, 25}}, value: 3.0, out: nil, ok: false},
+		{name: "with a number string below the bounds", rule: ConfigRule{Action: "bucket", Bounds: []float64{18, 25}}, value: "17.5", out: nil, ok: false},
+		{name: "with a number on the first bound", rule: ConfigRule{Action: "bucket", Bounds: []float64{18, 25}}, value: 18.0, out: 18.0, ok: true},
+		{name: "with a bool", rule: ConfigRule{Action: "bucket", Size: 10}, value: true, out: nil, ok: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out, ok := c.rule.replace(c.value)
+			assert.Equal(t, c.ok, ok)
+			assert.Equal(t, c.out, out)
+		})
+	}
+}
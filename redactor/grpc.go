@@ -0,0 +1,190 @@
+package redactor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// The largest gRPC message we'll buffer for redaction.
+const maxGRPCMessageSize = 16 * 1024 * 1024
+
+// Headers needed to transport a gRPC call, which are always passed through
+// by header redaction.
+var grpcHeaders = []string{"Content-Type", "Te", "Grpc-Timeout", "Grpc-Encoding", "Grpc-Accept-Encoding"}
+
+// IsGRPC returns true iff the headers describe a gRPC call.
+func IsGRPC(header http.Header) bool {
+	contentType := getContentType(header)
+	return contentType == "application/grpc" || strings.HasPrefix(contentType, "application/grpc+")
+}
+
+// Returns true iff the header is needed to transport a gRPC call.
+func isGRPCHeader(name string) bool {
+	for _, h := range grpcHeaders {
+		if http.CanonicalHeaderKey(name) == h {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GRPCMatch returns the first grpc match clause for a gRPC request path.
+func (r *Redactor) GRPCMatch(path string) GRPCMatch {
+	return r.config.FindGRPCMatch(path)
+}
+
+// RedactGRPCRequest redacts the messages and metadata of a gRPC call to
+// `path` according to its first grpc match clause.  Messages are redacted as
+// they're streamed, so client-streaming calls are supported.  Mutates req.
+//
+// Messages of methods missing from the config's descriptor sets can't be
+// decoded, so are replaced with empty messages.
+func (r *Redactor) RedactGRPCRequest(path string, req *http.Request) {
+	match := r.GRPCMatch(path)
+
+	var message *protoMessage
+	if method := r.descriptors.method(path); method != nil {
+		message = r.descriptors.messages[method.InputType]
+	}
+
+	if req.Body != nil {
+		encoding := req.Header.Get("Grpc-Encoding")
+		req.Body = newGRPCRedactingReader(req.Body, encoding, func(data []byte) ([]byte, error) {
+			if message == nil {
+				return []byte{}, fmt.Errorf("no descriptor for gRPC method %s", path)
+			}
+			return redactProtobuf(match.Body, r.descriptors, message, data, "$")
+		})
+	}
+
+	// Redacted messages may change in size.
+	req.ContentLength = -1
+	req.Header.Del("Content-Length")
+
+	req.Header = redactHeader(match.RuleOptions, req.Header, isGRPCHeader)
+}
+
+// RedactGRPCResponse redacts the messages of a gRPC response to a call to
+// `path`, if its grpc match clause has `redact_response` set.  Trailers are
+// passed through.  Mutates resp.
+func (r *Redactor) RedactGRPCResponse(path string, resp *http.Response) {
+	match := r.GRPCMatch(path)
+	if !match.RedactResponse || resp.Body == nil {
+		return
+	}
+
+	var message *protoMessage
+	if method := r.descriptors.method(path); method != nil {
+		message = r.descriptors.messages[method.OutputType]
+	}
+
+	encoding := resp.Header.Get("Grpc-Encoding")
+	resp.Body = newGRPCRedactingReader(resp.Body, encoding, func(data []byte) ([]byte, error) {
+		if message == nil {
+			return []byte{}, fmt.Errorf("no descriptor for gRPC method %s", path)
+		}
+		return redactProtobuf(match.Response, r.descriptors, message, data, "$")
+	})
+
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+}
+
+// A reader over a stream of length-prefixed gRPC messages that redacts each
+// message and re-frames it.  Compressed messages are decompressed, and
+// redacted messages are always sent uncompressed, which the gRPC protocol
+// allows regardless of the call's encoding.
+type grpcRedactingReader struct {
+	source   io.ReadCloser
+	encoding string
+	redact   func([]byte) ([]byte, error)
+	pending  bytes.Buffer
+	err      error
+}
+
+func newGRPCRedactingReader(source io.ReadCloser, encoding string, redact func([]byte) ([]byte, error)) *grpcRedactingReader {
+	return &grpcRedactingReader{source: source, encoding: encoding, redact: redact}
+}
+
+func (g *grpcRedactingReader) Read(p []byte) (int, error) {
+	for g.pending.Len() == 0 && g.err == nil {
+		g.err = g.next()
+	}
+
+	if g.pending.Len() > 0 {
+		return g.pending.Read(p)
+	}
+
+	return 0, g.err
+}
+
+func (g *grpcRedactingReader) Close() error {
+	return g.source.Close()
+}
+
+// Reads, redacts and re-frames the next message onto the pending buffer.
+func (g *grpcRedactingReader) next() error {
+	header := make([]byte, 5)
+	_, err := io.ReadFull(g.source, header)
+	if err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("grpc: truncated message header")
+	}
+	if err != nil {
+		return err
+	}
+
+	compressed := header[0] == 1
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > maxGRPCMessageSize {
+		return fmt.Errorf("grpc: message of %d bytes is too large to redact", length)
+	}
+
+	data := make([]byte, length)
+	_, err = io.ReadFull(g.source, data)
+	if err != nil {
+		return fmt.Errorf("grpc: truncated message: %v", err)
+	}
+
+	var redacted []byte
+	if compressed {
+		data, err = g.decompress(data)
+	}
+	if err == nil {
+		redacted, err = g.redact(data)
+	}
+	if err != nil {
+		// Like request bodies, a message we can't redact is replaced.
+		log.Println(err)
+		redacted = []byte{}
+	}
+
+	binary.BigEndian.PutUint32(header[1:], uint32(len(redacted)))
+	header[0] = 0
+
+	g.pending.Write(header)
+	g.pending.Write(redacted)
+
+	return nil
+}
+
+// Decompresses a message with the call's encoding.
+func (g *grpcRedactingReader) decompress(data []byte) ([]byte, error) {
+	if g.encoding != "gzip" {
+		return nil, fmt.Errorf("grpc: unsupported message encoding %q", g.encoding)
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(io.LimitReader(reader, maxGRPCMessageSize))
+}
@@ -0,0 +1,144 @@
+package redactor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func grpcFrame(compressed bool, message []byte) []byte {
+	header := make([]byte, 5)
+	if compressed {
+		header[0] = 1
+	}
+	binary.BigEndian.PutUint32(header[1:], uint32(len(message)))
+	return append(header, message...)
+}
+
+func gzipped(data []byte) []byte {
+	buffer := &bytes.Buffer{}
+	writer := gzip.NewWriter(buffer)
+	writer.Write(data)
+	writer.Close()
+	return buffer.Bytes()
+}
+
+func makeGRPCRedactor(t *testing.T) *Redactor {
+	config := Config{
+		GRPCDescriptorSets: []string{"testdata/users.pb"},
+		Match: MatchOptions{
+			GRPC: []GRPCMatch{
+				GRPCMatch{
+					Service:        "test.Users",
+					RedactResponse: true,
+					RuleOptions: RuleOptions{
+						Body:     []ConfigRule{ConfigRule{Whitelist: "$.id"}},
+						Response: []ConfigRule{ConfigRule{Whitelist: "$.created"}},
+					},
+				},
+			},
+		},
+	}
+
+	redactor, err := Compile(config)
+	assert.Nil(t, err)
+	return redactor
+}
+
+func TestIsGRPC(t *testing.T) {
+	assert.True(t, IsGRPC(http.Header{"Content-Type": []string{"application/grpc"}}))
+	assert.True(t, IsGRPC(http.Header{"Content-Type": []string{"application/grpc+proto"}}))
+	assert.False(t, IsGRPC(http.Header{"Content-Type": []string{"application/json"}}))
+	assert.False(t, IsGRPC(http.Header{}))
+}
+
+func TestRedactGRPCRequest(t *testing.T) {
+	redactor := makeGRPCRedactor(t)
+
+	user1 := pbConcat(pbString(1, "u1"), pbString(2, "diggy@net.cool"))
+	user2 := pbConcat(pbString(1, "u2"), pbString(2, "grapes@net.cool"))
+
+	type testCase struct {
+		name     string
+		path     string
+		encoding string
+		body     []byte
+		out      []byte
+	}
+
+	cases := []testCase{
+		{
+			name: "with a unary call",
+			path: "/test.Users/GetUser",
+			body: grpcFrame(false, user1),
+			out:  grpcFrame(false, pbConcat(pbString(1, "u1"), pbString(2, "REDACTED"))),
+		},
+		{
+			name:     "with a client-streaming call and compression",
+			path:     "/test.Users/CreateUsers",
+			encoding: "gzip",
+			body:     pbConcat(grpcFrame(false, user1), grpcFrame(true, gzipped(user2))),
+			out: pbConcat(
+				grpcFrame(false, pbConcat(pbString(1, "u1"), pbString(2, "REDACTED"))),
+				grpcFrame(false, pbConcat(pbString(1, "u2"), pbString(2, "REDACTED"))),
+			),
+		},
+		{
+			name:     "with an unsupported compression",
+			path:     "/test.Users/GetUser",
+			encoding: "snappy",
+			body:     grpcFrame(true, user1),
+			out:      grpcFrame(false, []byte{}),
+		},
+		{
+			name: "with an unknown method",
+			path: "/test.Users/DeleteUser",
+			body: grpcFrame(false, user1),
+			out:  grpcFrame(false, []byte{}),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			request, _ := http.NewRequest("POST", c.path, bytes.NewReader(c.body))
+			request.Header.Set("Content-Type", "application/grpc")
+			if c.encoding != "" {
+				request.Header.Set("Grpc-Encoding", c.encoding)
+			}
+
+			redactor.RedactGRPCRequest(c.path, request)
+
+			body, err := ioutil.ReadAll(request.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, c.out, body)
+			assert.Equal(t, int64(-1), request.ContentLength)
+		})
+	}
+
+	t.Log("Running with a truncated stream")
+	request, _ := http.NewRequest("POST", "/test.Users/GetUser", bytes.NewReader(grpcFrame(false, user1)[:4]))
+	redactor.RedactGRPCRequest("/test.Users/GetUser", request)
+	_, err := ioutil.ReadAll(request.Body)
+	assert.NotNil(t, err)
+}
+
+func TestRedactGRPCResponse(t *testing.T) {
+	redactor := makeGRPCRedactor(t)
+
+	message := pbConcat(pbVarint(1, 2), pbMessage(2, pbString(1, "u1")))
+	resp := &http.Response{
+		Header: http.Header{"Content-Type": []string{"application/grpc"}},
+		Body:   ioutil.NopCloser(bytes.NewReader(grpcFrame(false, message))),
+	}
+
+	redactor.RedactGRPCResponse("/test.Users/CreateUsers", resp)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, grpcFrame(false, pbConcat(pbVarint(1, 2), pbMessage(2, pbString(1, "REDACTED")))), body)
+}
@@ -0,0 +1,35 @@
+package redactor
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// LoadHashKey reads the secret that fakes and hashes are keyed with: a hex
+// encoded key of at least 256 bits, as generated by `openssl rand -hex 32`.
+func LoadHashKey(file string) ([]byte, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) < 32 {
+		return nil, fmt.Errorf("hash key: %s must hold a hex encoded key of at least 256 bits", file)
+	}
+
+	return key, nil
+}
+
+// Returns the HMAC-SHA256 of a value.  Unlike a bare hash, it can't be
+// reversed by hashing guesses (like every email address in a leak) without
+// the key.
+func keyedHash(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,54 @@
+package redactor
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A hash key for tests.
+var testHashKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestLoadHashKey(t *testing.T) {
+	dir := t.TempDir()
+
+	type testCase struct {
+		name  string
+		data  string
+		valid bool
+	}
+
+	cases := []testCase{
+		{name: "with a 256-bit key", data: strings.Repeat("ab", 32) + "\n", valid: true},
+		{name: "with a longer key", data: strings.Repeat("ab", 64), valid: true},
+		{name: "with a short key", data: strings.Repeat("ab", 16)},
+		{name: "with a key that isn't hex", data: strings.Repeat("zz", 32)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			file := filepath.Join(dir, "hash.key")
+			ioutil.WriteFile(file, []byte(c.data), 0600)
+
+			key, err := LoadHashKey(file)
+			assert.Equal(t, c.valid, err == nil)
+			if c.valid {
+				assert.Equal(t, len(strings.TrimSpace(c.data))/2, len(key))
+			}
+		})
+	}
+
+	_, err := LoadHashKey(filepath.Join(dir, "missing.key"))
+	assert.NotNil(t, err)
+}
+
+func TestKeyedHash(t *testing.T) {
+	sum := keyedHash(testHashKey, "diggy@net.cool")
+	assert.Equal(t, 32, len(sum))
+	assert.Equal(t, sum, keyedHash(testHashKey, "diggy@net.cool"))
+	assert.NotEqual(t, sum, keyedHash(testHashKey, "diggy@net.coo"))
+	assert.NotEqual(t, sum, keyedHash([]byte("another key"), "diggy@net.cool"))
+}
@@ -0,0 +1,147 @@
+package redactor
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// Extract the media type from a set of headers, lowercased, taking care to
+// strip any charset or boundary information (delimited by a ';' character).
+// Returns the empty string if not found.
+//
+// e.g. getContentType("application/diggy; charset=utf8")
+//   => "application/diggy"
+func getContentType(header http.Header) string {
+	mediaType, _ := parseMediaType(header.Get("Content-Type"))
+	return mediaType
+}
+
+// Reads and redacts a request or response body against `rules` of `match`.
+// If the type of the body can't be inferred, the redacted body is zero bytes.
+// A body compressed according to its Content-Encoding is decompressed (to at
+// most the match's limit) and the redacted body re-compressed the same way.
+// If its charset was converted to UTF-8, the Content-Type is updated.  The
+// original body is closed.
+func redactBodyReader(match HTTPMatch, rules []ConfigRule, header http.Header, body io.ReadCloser) ([]byte, error) {
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	if getContentType(header) == "" || len(data) == 0 {
+		return []byte{}, nil
+	}
+
+	codings, err := parseContentEncoding(header)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	data, err = decompressBody(codings, data, match.maxDecompressedSize())
+	if err != nil {
+		return []byte{}, err
+	}
+
+	contentType := header.Get("Content-Type")
+	redacted, err := mapDocument(rules, match.contentTypes, contentType, data)
+	if err != nil || len(redacted) == 0 {
+		return redacted, err
+	}
+
+	compressed, err := compressBody(codings, redacted)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	header.Set("Content-Type", redactedContentType(contentType))
+	return compressed, nil
+}
+
+// Replaces a request or response body with its redacted version, updating
+// the headers describing it.  An empty body has no Content-Encoding.
+func setRedactedBody(header http.Header, body []byte) io.ReadCloser {
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	if len(body) == 0 {
+		header.Del("Content-Encoding")
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(body))
+}
+
+// Redact values from the request body unless the key location is whitelisted
+// in the config.  If the type of the body can't be inferred, the body will be
+// set to zero bytes.  Bodies of records are streamed (see streamRecords).
+// Mutates r.
+func redactBody(match HTTPMatch, r *http.Request) error {
+	if r.Body == nil {
+		return nil
+	}
+
+	// The original body mustn't be sent again on a retry or redirect.
+	r.GetBody = nil
+
+	if reader, ok := streamRecords(match, match.Body, r.Header, r.Body); ok {
+		r.Body = reader
+		r.ContentLength = -1
+		return nil
+	}
+
+	redactedBody, err := redactBodyReader(match, match.Body, r.Header, r.Body)
+
+	r.Body = setRedactedBody(r.Header, redactedBody)
+	r.ContentLength = int64(len(redactedBody))
+
+	return err
+}
+
+// RedactRequest redacts the body, path, querystring and headers of a request
+// according to `match`.  Mutates r, so hosts must find the match clause
+// before redacting the path.
+//
+// If the body can't be parsed, it is still replaced (with zero bytes) and the
+// error is returned, so a request is never passed on unredacted.  Bodies of
+// NDJSON or JSON text sequence records are instead redacted as they're read,
+// so if a record can't be parsed, reading the body fails after the records
+// before it.
+func RedactRequest(match HTTPMatch, r *http.Request) error {
+	err := redactBody(match, r)
+
+	r.URL = RedactPath(match, r.URL)
+	r.URL.RawQuery = RedactQuerystring(match, r.URL)
+	r.Header = RedactHeader(match, r.Header)
+
+	return err
+}
+
+// RedactResponse redacts the body of a response against the `rule
+// "response"` whitelist of `match`, if the match has `redact_response` set.
+// Its `Set-Cookie` headers are filtered by the match's `rule "cookie"`
+// whitelist, if any.  Bodies of NDJSON or JSON text sequence records are
+// redacted as they're read (see RedactRequest).  Mutates resp.
+func RedactResponse(match HTTPMatch, resp *http.Response) error {
+	if len(match.Cookie) > 0 {
+		resp.Header = RedactCookies(match, resp.Header)
+	}
+
+	if !match.RedactResponse || resp.Body == nil {
+		return nil
+	}
+
+	if reader, ok := streamRecords(match, match.Response, resp.Header, resp.Body); ok {
+		resp.Body = reader
+		resp.ContentLength = -1
+		return nil
+	}
+
+	redactedBody, err := redactBodyReader(match, match.Response, resp.Header, resp.Body)
+
+	resp.Body = setRedactedBody(resp.Header, redactedBody)
+	resp.ContentLength = int64(len(redactedBody))
+
+	return err
+}
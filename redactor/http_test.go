@@ -0,0 +1,179 @@
+package redactor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeRequest(body string, contentType string) *http.Request {
+	request, _ := http.NewRequest("GET", "", strings.NewReader(body))
+
+	if contentType != "" {
+		request.Header.Add("Content-Type", contentType)
+	}
+
+	return request
+}
+
+func TestGetContentType(t *testing.T) {
+	request, err := http.NewRequest("GET", "", strings.NewReader(""))
+	if err != nil {
+		t.Fail()
+	}
+
+	request.Header.Add("Content-Type", "application/json; charset=utf8")
+	result := getContentType(request.Header)
+	assert.Equal(t, result, "application/json")
+}
+
+func TestRedactBody(t *testing.T) {
+	type testCase struct {
+		name         string
+		match        HTTPMatch
+		request      *http.Request
+		expectedBody string
+	}
+
+	cases := []testCase{
+		{
+			name:         "with an empty JSON body",
+			match:        HTTPMatch{},
+			request:      makeRequest(`{}`, "application/json"),
+			expectedBody: "{}",
+		},
+		{
+			name:         "with a non-empty JSON body",
+			match:        HTTPMatch{},
+			request:      makeRequest(`{"a": "data"}`, "application/json"),
+			expectedBody: `{"a":"REDACTED"}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := redactBody(c.match, c.request)
+			if err != nil {
+				t.Fail()
+			}
+
+			body, err := ioutil.ReadAll(c.request.Body)
+			if err != nil {
+				t.Fail()
+			}
+
+			assert.Equal(t, string(body[:]), c.expectedBody)
+			assert.Equal(t, strconv.FormatInt(c.request.ContentLength, 10), c.request.Header.Get("Content-Length"))
+			assert.Equal(t, c.request.ContentLength, int64(len(body)))
+		})
+	}
+}
+
+func TestRedactRequest(t *testing.T) {
+	match := HTTPMatch{
+		RedactResponse: true,
+		RuleOptions: RuleOptions{
+			Body:        []ConfigRule{ConfigRule{Whitelist: "$.a"}},
+			Querystring: []ConfigRule{ConfigRule{Whitelist: "a"}},
+			Header:      []ConfigRule{ConfigRule{Whitelist: "Accept"}, ConfigRule{Whitelist: "Accept-Encoding"}},
+		},
+	}
+
+	request := makeRequest(`{"a": 1, "b": 2}`, "application/json")
+	request.URL.RawQuery = "a=1&b=2"
+	request.Header.Add("Accept", "*/*")
+	request.Header.Add("Accept-Encoding", "gzip")
+	request.Header.Add("Authorization", "secret")
+
+	err := RedactRequest(match, request)
+	assert.Nil(t, err)
+
+	body, err := ioutil.ReadAll(request.Body)
+	assert.Nil(t, err)
+
+	assert.Equal(t, `{"a":1,"b":0}`, string(body))
+	assert.Equal(t, "a=1&b=REDACTED", request.URL.RawQuery)
+	assert.Equal(t, "*/*", request.Header.Get("Accept"))
+	assert.Equal(t, "REDACTED", request.Header.Get("Authorization"))
+	assert.Equal(t, "gzip", request.Header.Get("Accept-Encoding"))
+}
+
+func TestRedactResponse(t *testing.T) {
+	makeResponse := func(body string) *http.Response {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}
+	}
+
+	type testCase struct {
+		name         string
+		match        HTTPMatch
+		body         string
+		expectedBody string
+	}
+
+	cases := []testCase{
+		{
+			name:         "without redact_response",
+			match:        HTTPMatch{},
+			body:         `{"a": "data"}`,
+			expectedBody: `{"a": "data"}`,
+		},
+		{
+			name:         "with redact_response",
+			match:        HTTPMatch{RedactResponse: true},
+			body:         `{"a": "data"}`,
+			expectedBody: `{"a":"REDACTED"}`,
+		},
+		{
+			name: "with redact_response and a whitelist",
+			match: HTTPMatch{
+				RedactResponse: true,
+				RuleOptions:    RuleOptions{Response: []ConfigRule{ConfigRule{Whitelist: "$.a"}}},
+			},
+			body:         `{"a": "data", "b": "data"}`,
+			expectedBody: `{"a":"data","b":"REDACTED"}`,
+		},
+		{
+			name:         "with redact_response and an empty body",
+			match:        HTTPMatch{RedactResponse: true},
+			body:         "",
+			expectedBody: "",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp := makeResponse(c.body)
+			err := RedactResponse(c.match, resp)
+			assert.Nil(t, err)
+
+			body, err := ioutil.ReadAll(resp.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, c.expectedBody, string(body))
+		})
+	}
+}
+
+func TestRedactResponseCookies(t *testing.T) {
+	match := HTTPMatch{RuleOptions: RuleOptions{Cookie: []ConfigRule{ConfigRule{Whitelist: "session"}}}}
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Set-Cookie": []string{"session=abc; Path=/", "_ga=GA1.2.3"}},
+		Body:       ioutil.NopCloser(strings.NewReader(`{"a": "data"}`)),
+	}
+
+	err := RedactResponse(match, resp)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"session=abc; Path=/"}, resp.Header["Set-Cookie"])
+
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a": "data"}`, string(body))
+}
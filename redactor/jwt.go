@@ -0,0 +1,446 @@
+package redactor
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha256" // Registers the hashes of jwtAlgorithms
+	_ "crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Modes of ActionJWT.  JWTResign, the default, replaces a token with one
+// holding its redacted claims, signed with the proxy's key.  JWTClaims
+// replaces it with the redacted claims themselves, or for headers, moves them
+// to ClaimsHeader.
+const (
+	JWTResign = "resign"
+	JWTClaims = "claims"
+)
+
+// ClaimsHeader carries the verified and redacted claims of a JWT taken from
+// a header in JWTClaims mode, as base64url encoded JSON (like a JWT's
+// payload).  It's removed from every request, so it can't be forged.
+const ClaimsHeader = "X-Privacy-Proxy-Claims"
+
+// The smallest HMAC secret accepted, in bytes.
+const minJWTSecretSize = 32
+
+// ErrInvalidJWT is returned for tokens that can't be parsed or verified, or
+// have expired.
+var ErrInvalidJWT = errors.New("jwt: invalid token")
+
+// The hash and key type of each supported JWT algorithm.
+var jwtAlgorithms = map[string]struct {
+	hash crypto.Hash
+	kind string
+}{
+	"HS256": {crypto.SHA256, "hmac"},
+	"HS384": {crypto.SHA384, "hmac"},
+	"HS512": {crypto.SHA512, "hmac"},
+	"RS256": {crypto.SHA256, "rsa"},
+	"RS384": {crypto.SHA384, "rsa"},
+	"RS512": {crypto.SHA512, "rsa"},
+	"ES256": {crypto.SHA256, "ecdsa"},
+	"ES384": {crypto.SHA384, "ecdsa"},
+	"ES512": {crypto.SHA512, "ecdsa"},
+	"EdDSA": {0, "ed25519"},
+}
+
+// JWTKeys holds the keys JWTs are verified with, and the proxy's key that
+// JWTResign re-signs them with.
+type JWTKeys struct {
+	verify       []interface{}
+	signing      interface{}
+	signingAlg   string
+	signingKeyID string
+}
+
+// LoadJWTKeys reads the key files of a `jwt` block.  Each file holds either a
+// PEM encoded key (a public key to verify with, or the private signing key)
+// or a hex encoded HMAC secret of at least 256 bits.
+func LoadJWTKeys(options JWTOptions) (*JWTKeys, error) {
+	keys := &JWTKeys{signingKeyID: options.SigningKeyID}
+
+	if len(options.VerifyKeys) == 0 {
+		return nil, fmt.Errorf("jwt: no verify_keys")
+	}
+
+	for _, file := range options.VerifyKeys {
+		key, err := loadJWTKey(file)
+		if err != nil {
+			return nil, err
+		}
+
+		switch key.(type) {
+		case []byte, *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+			keys.verify = append(keys.verify, key)
+		default:
+			return nil, fmt.Errorf("jwt: %s: not a public key or secret", file)
+		}
+	}
+
+	if options.SigningKey != "" {
+		key, err := loadJWTKey(options.SigningKey)
+		if err != nil {
+			return nil, err
+		}
+
+		keys.signing = key
+		switch typedKey := key.(type) {
+		case []byte:
+			keys.signingAlg = "HS256"
+		case *rsa.PrivateKey:
+			keys.signingAlg = "RS256"
+		case *ecdsa.PrivateKey:
+			keys.signingAlg = map[int]string{256: "ES256", 384: "ES384", 521: "ES512"}[typedKey.Curve.Params().BitSize]
+		case ed25519.PrivateKey:
+			keys.signingAlg = "EdDSA"
+		}
+
+		if keys.signingAlg == "" {
+			return nil, fmt.Errorf("jwt: %s: not a private key or secret", options.SigningKey)
+		}
+	}
+
+	return keys, nil
+}
+
+// Reads a PEM encoded key or hex encoded secret.
+func loadJWTKey(file string) (interface{}, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		secret, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(secret) < minJWTSecretSize {
+			return nil, fmt.Errorf("jwt: %s: expected a PEM key or a hex encoded secret of at least 256 bits", file)
+		}
+		return secret, nil
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		err = fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("jwt: %s: %v", file, err)
+	}
+
+	return key, nil
+}
+
+// Verify checks a token's signature against the verify keys, and its `exp`
+// and `nbf` claims against the current time.  Returns its claims.
+func (k *JWTKeys) Verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidJWT
+	}
+
+	header := struct {
+		Alg string `json:"alg"`
+	}{}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, ErrInvalidJWT
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidJWT
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+
+	verified := false
+	for _, key := range k.verify {
+		if verifyJWTSignature(header.Alg, key, signed, signature) {
+			verified = true
+			break
+		}
+	}
+
+	if !verified {
+		return nil, ErrInvalidJWT
+	}
+
+	claims := map[string]interface{}{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, ErrInvalidJWT
+	}
+
+	now := float64(time.Now().Unix())
+	if exp, ok := claims["exp"].(float64); ok && now >= exp {
+		return nil, ErrInvalidJWT
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now < nbf {
+		return nil, ErrInvalidJWT
+	}
+
+	return claims, nil
+}
+
+// Sign returns a token holding `claims`, signed with the signing key.
+func (k *JWTKeys) Sign(claims map[string]interface{}) (string, error) {
+	if k.signing == nil {
+		return "", fmt.Errorf("jwt: no signing_key")
+	}
+
+	header := map[string]string{"alg": k.signingAlg, "typ": "JWT"}
+	if k.signingKeyID != "" {
+		header["kid"] = k.signingKeyID
+	}
+
+	encodedHeader, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+
+	encodedClaims, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(encodedHeader) + "." + base64.RawURLEncoding.EncodeToString(encodedClaims)
+
+	signature, err := signJWT(k.signingAlg, k.signing, []byte(signed))
+	if err != nil {
+		return "", err
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Decodes a base64url encoded JSON part of a token.
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// Returns the digest of `data` for an algorithm's hash.
+func jwtDigest(hash crypto.Hash, data []byte) []byte {
+	h := hash.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// Returns true iff `signature` is a valid signature of `signed` by `key`
+// using `alg`.  Keys of the wrong type for the algorithm never verify, so a
+// public key can't be used as an HMAC secret.
+func verifyJWTSignature(alg string, key interface{}, signed []byte, signature []byte) bool {
+	algorithm, ok := jwtAlgorithms[alg]
+	if !ok {
+		return false
+	}
+
+	switch typedKey := key.(type) {
+	case []byte:
+		if algorithm.kind != "hmac" {
+			return false
+		}
+		mac := hmac.New(algorithm.hash.New, typedKey)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), signature)
+
+	case *rsa.PublicKey:
+		if algorithm.kind != "rsa" {
+			return false
+		}
+		return rsa.VerifyPKCS1v15(typedKey, algorithm.hash, jwtDigest(algorithm.hash, signed), signature) == nil
+
+	case *ecdsa.PublicKey:
+		size := (typedKey.Curve.Params().BitSize + 7) / 8
+		if algorithm.kind != "ecdsa" || len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(typedKey, jwtDigest(algorithm.hash, signed), r, s)
+
+	case ed25519.PublicKey:
+		if algorithm.kind != "ed25519" {
+			return false
+		}
+		return ed25519.Verify(typedKey, signed, signature)
+	}
+
+	return false
+}
+
+// Signs `signed` with `key` using `alg`.
+func signJWT(alg string, key interface{}, signed []byte) ([]byte, error) {
+	algorithm := jwtAlgorithms[alg]
+
+	switch typedKey := key.(type) {
+	case []byte:
+		mac := hmac.New(algorithm.hash.New, typedKey)
+		mac.Write(signed)
+		return mac.Sum(nil), nil
+
+	case *rsa.PrivateKey:
+		return rsa.SignPKCS1v15(rand.Reader, typedKey, algorithm.hash, jwtDigest(algorithm.hash, signed))
+
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, typedKey, jwtDigest(algorithm.hash, signed))
+		if err != nil {
+			return nil, err
+		}
+
+		size := (typedKey.Curve.Params().BitSize + 7) / 8
+		signature := make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+		return signature, nil
+
+	case ed25519.PrivateKey:
+		return ed25519.Sign(typedKey, signed), nil
+	}
+
+	return nil, fmt.Errorf("jwt: unsupported signing key")
+}
+
+// Returns the rule's JWT mode, defaulting to JWTResign.
+func (r ConfigRule) jwtMode() string {
+	if r.Mode == "" {
+		return JWTResign
+	}
+
+	return r.Mode
+}
+
+// Returns the rules the claims of a token are whitelisted by.
+func (r ConfigRule) claimRules() []ConfigRule {
+	rules := make([]ConfigRule, len(r.Claims))
+	for i, claim := range r.Claims {
+		rules[i] = ConfigRule{Whitelist: claim, LeafOnly: r.LeafOnly}
+	}
+
+	return rules
+}
+
+// Returns an error if the options of ActionJWT are invalid.
+func (r ConfigRule) validateJWT() error {
+	if r.jwtKeys == nil {
+		return fmt.Errorf("jwt action needs a jwt block")
+	}
+
+	switch r.jwtMode() {
+	case JWTResign:
+		if r.jwtKeys.signing == nil {
+			return fmt.Errorf("jwt action in resign mode needs a signing_key")
+		}
+	case JWTClaims:
+	default:
+		return fmt.Errorf("unknown jwt mode %q", r.Mode)
+	}
+
+	for _, claim := range r.Claims {
+		if _, err := compileLocation(claim); err != nil {
+			return fmt.Errorf("invalid claim %q: %v", claim, err)
+		}
+	}
+
+	return nil
+}
+
+// Verifies a token and redacts its claims against the rule's claims
+// whitelist.  Returns the redacted claims in JWTClaims mode, or a token
+// holding them signed with the proxy's key.  Tokens that can't be verified
+// are logged (without the token) and redacted.
+func (r ConfigRule) replaceJWT(token string) (interface{}, bool) {
+	claims, err := r.jwtKeys.Verify(token)
+	if err != nil {
+		log.Printf("%v at %s\n", err, r.Whitelist)
+		return nil, false
+	}
+
+	redacted := redact(r.claimRules(), claims, "$")
+	if r.jwtMode() == JWTClaims {
+		return redacted, true
+	}
+
+	resigned, err := r.jwtKeys.Sign(redacted.(map[string]interface{}))
+	if err != nil {
+		log.Println(err)
+		return nil, false
+	}
+
+	return resigned, true
+}
+
+// Redacts a header holding a JWT, with or without an auth scheme (as in
+// `Bearer <token>`), into `result`.  In JWTClaims mode the header is replaced
+// by ClaimsHeader.
+func (r ConfigRule) redactJWTHeader(result map[string][]string, name string, value string) {
+	scheme, token := "", value
+	if i := strings.LastIndexByte(value, ' '); i >= 0 {
+		scheme, token = value[:i+1], value[i+1:]
+	}
+
+	replaced, ok := r.replaceJWT(token)
+	if !ok {
+		result[name] = append(result[name], RedactedStr)
+		return
+	}
+
+	if r.jwtMode() == JWTClaims {
+		encoded, err := json.Marshal(replaced)
+		if err != nil {
+			result[name] = append(result[name], RedactedStr)
+			return
+		}
+		result[ClaimsHeader] = append(result[ClaimsHeader], base64.RawURLEncoding.EncodeToString(encoded))
+		return
+	}
+
+	result[name] = append(result[name], scheme+replaced.(string))
+}
+
+// Returns an error if any of the header rules has an action other than
+// ActionPass or ActionJWT, or invalid JWT options.
+func validateHeaderRules(rules []ConfigRule) error {
+	for _, rule := range rules {
+		switch rule.action() {
+		case ActionPass:
+		case ActionJWT:
+			if err := rule.validateJWT(); err != nil {
+				return fmt.Errorf("invalid header whitelist %q: %v", rule.Whitelist, err)
+			}
+		default:
+			return fmt.Errorf("invalid header whitelist %q: headers only support the jwt action", rule.Whitelist)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,311 @@
+package redactor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A 256-bit HMAC secret, hex encoded.
+const testJWTSecret = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+// Writes a key file to a temporary directory, returning its path.
+func writeJWTKey(t *testing.T, name string, data []byte) string {
+	file := filepath.Join(t.TempDir(), name)
+	assert.Nil(t, ioutil.WriteFile(file, data, 0600))
+	return file
+}
+
+// Returns JWTOptions verifying tokens signed with testJWTSecret and
+// re-signing them with a new ECDSA key, and that key.
+func makeJWTOptions(t *testing.T) (JWTOptions, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	private, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err)
+
+	return JWTOptions{
+		VerifyKeys:   []string{writeJWTKey(t, "secret", []byte(testJWTSecret+"\n"))},
+		SigningKey:   writeJWTKey(t, "proxy.pem", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: private})),
+		SigningKeyID: "proxy-1",
+	}, key
+}
+
+// Returns a token holding `claims` signed with testJWTSecret using `alg`.
+func makeJWT(t *testing.T, alg string, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	assert.Nil(t, err)
+	payload, err := json.Marshal(claims)
+	assert.Nil(t, err)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	secret := []byte{}
+	for i := 0; i < 32; i++ {
+		secret = append(secret, byte(i))
+	}
+
+	signature, err := signJWT(alg, secret, []byte(signed))
+	assert.Nil(t, err)
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// Returns the claims of a token without verifying it.
+func jwtClaims(t *testing.T, token string) map[string]interface{} {
+	claims := map[string]interface{}{}
+	assert.Nil(t, decodeJWTPart(strings.Split(token, ".")[1], &claims))
+	return claims
+}
+
+func TestJWTKeysVerify(t *testing.T) {
+	options, _ := makeJWTOptions(t)
+	keys, err := LoadJWTKeys(options)
+	assert.Nil(t, err)
+
+	claims := map[string]interface{}{"sub": "42", "email": "diggy@net.cool"}
+	valid := makeJWT(t, "HS256", claims)
+	parts := strings.Split(valid, ".")
+
+	type testCase struct {
+		name  string
+		token string
+		valid bool
+	}
+
+	cases := []testCase{
+		{name: "with a valid token", token: valid, valid: true},
+		{name: "with another HMAC algorithm", token: makeJWT(t, "HS512", claims), valid: true},
+		{name: "with a tampered payload", token: parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"1"}`)) + "." + parts[2]},
+		{name: "with no signature", token: parts[0] + "." + parts[1] + "."},
+		{name: "with the none algorithm", token: base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."},
+		{name: "with an expired token", token: makeJWT(t, "HS256", map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()})},
+		{name: "with a token not valid yet", token: makeJWT(t, "HS256", map[string]interface{}{"nbf": time.Now().Add(time.Minute).Unix()})},
+		{name: "with an unexpired token", token: makeJWT(t, "HS256", map[string]interface{}{"exp": time.Now().Add(time.Minute).Unix()}), valid: true},
+		{name: "with a malformed token", token: "diggy@net.cool"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result, err := keys.Verify(c.token)
+			assert.Equal(t, c.valid, err == nil)
+			if c.valid {
+				assert.NotNil(t, result)
+			}
+		})
+	}
+}
+
+func TestJWTKeysSign(t *testing.T) {
+	options, key := makeJWTOptions(t)
+	keys, err := LoadJWTKeys(options)
+	assert.Nil(t, err)
+
+	token, err := keys.Sign(map[string]interface{}{"sub": "42"})
+	assert.Nil(t, err)
+
+	public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.Nil(t, err)
+
+	verifier, err := LoadJWTKeys(JWTOptions{VerifyKeys: []string{
+		writeJWTKey(t, "proxy.pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public})),
+	}})
+	assert.Nil(t, err)
+
+	claims, err := verifier.Verify(token)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"sub": "42"}, claims)
+
+	header := map[string]string{}
+	assert.Nil(t, decodeJWTPart(strings.Split(token, ".")[0], &header))
+	assert.Equal(t, map[string]string{"alg": "ES256", "typ": "JWT", "kid": "proxy-1"}, header)
+}
+
+func TestLoadJWTKeys(t *testing.T) {
+	secret := writeJWTKey(t, "secret", []byte(testJWTSecret))
+	short := writeJWTKey(t, "short", []byte("0001"))
+
+	type testCase struct {
+		name    string
+		options JWTOptions
+		valid   bool
+	}
+
+	cases := []testCase{
+		{name: "with a secret", options: JWTOptions{VerifyKeys: []string{secret}}, valid: true},
+		{name: "with a signing secret", options: JWTOptions{VerifyKeys: []string{secret}, SigningKey: secret}, valid: true},
+		{name: "with no verify keys", options: JWTOptions{SigningKey: secret}},
+		{name: "with a short secret", options: JWTOptions{VerifyKeys: []string{short}}},
+		{name: "with a missing file", options: JWTOptions{VerifyKeys: []string{secret + ".missing"}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := LoadJWTKeys(c.options)
+			assert.Equal(t, c.valid, err == nil)
+		})
+	}
+}
+
+func TestRedactJWT(t *testing.T) {
+	options, _ := makeJWTOptions(t)
+	keys, err := LoadJWTKeys(options)
+	assert.Nil(t, err)
+
+	token := makeJWT(t, "HS256", map[string]interface{}{"sub": "42", "email": "diggy@net.cool", "org": map[string]interface{}{"id": 7.0, "name": "Button"}})
+
+	t.Log("Running in resign mode")
+	rules := []ConfigRule{ConfigRule{Whitelist: "$.token", Action: "jwt", Claims: []string{"$.sub", "$.org.id"}, jwtKeys: keys}}
+	result := redact(rules, map[string]interface{}{"token": token}, "$").(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"sub":   "42",
+		"email": "REDACTED",
+		"org":   map[string]interface{}{"id": 7.0, "name": "REDACTED"},
+	}, jwtClaims(t, result["token"].(string)))
+
+	t.Log("Running in claims mode")
+	rules[0].Mode = "claims"
+	result = redact(rules, map[string]interface{}{"token": token}, "$").(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"sub":   "42",
+		"email": "REDACTED",
+		"org":   map[string]interface{}{"id": 7.0, "name": "REDACTED"},
+	}, result["token"])
+
+	t.Log("Running with an invalid token")
+	result = redact(rules, map[string]interface{}{"token": token + "x"}, "$").(map[string]interface{})
+	assert.Equal(t, "REDACTED", result["token"])
+}
+
+func TestRedactHeaderWithJWT(t *testing.T) {
+	options, _ := makeJWTOptions(t)
+	keys, err := LoadJWTKeys(options)
+	assert.Nil(t, err)
+
+	token := makeJWT(t, "HS256", map[string]interface{}{"sub": "42", "email": "diggy@net.cool"})
+	makeJWTMatch := func(mode string) HTTPMatch {
+		return HTTPMatch{RuleOptions: RuleOptions{Header: []ConfigRule{
+			ConfigRule{Whitelist: "Authorization", Action: "jwt", Mode: mode, Claims: []string{"$.sub"}, jwtKeys: keys},
+		}}}
+	}
+
+	header := http.Header{
+		"Authorization": {"Bearer " + token},
+		"User-Agent":    {"curl"},
+		ClaimsHeader:    {"forged"},
+	}
+
+	t.Log("Running in resign mode")
+	result := RedactHeader(makeJWTMatch(""), header)
+	assert.Equal(t, "curl", result.Get("User-Agent"))
+	assert.Equal(t, "", result.Get(ClaimsHeader))
+	assert.True(t, strings.HasPrefix(result.Get("Authorization"), "Bearer "))
+	assert.Equal(t, map[string]interface{}{"sub": "42", "email": "REDACTED"}, jwtClaims(t, strings.TrimPrefix(result.Get("Authorization"), "Bearer ")))
+
+	t.Log("Running in claims mode")
+	result = RedactHeader(makeJWTMatch("claims"), header)
+	assert.Equal(t, "", result.Get("Authorization"))
+	claims := map[string]interface{}{}
+	assert.Nil(t, decodeJWTPart(result.Get(ClaimsHeader), &claims))
+	assert.Equal(t, map[string]interface{}{"sub": "42", "email": "REDACTED"}, claims)
+
+	t.Log("Running with an invalid token")
+	header.Set("Authorization", "Bearer nope")
+	result = RedactHeader(makeJWTMatch("claims"), header)
+	assert.Equal(t, "REDACTED", result.Get("Authorization"))
+	assert.Equal(t, "", result.Get(ClaimsHeader))
+}
+
+func TestCompileWithJWTHeader(t *testing.T) {
+	options, _ := makeJWTOptions(t)
+
+	data := fmt.Sprintf(`
+jwt {
+  verify_keys = [%q]
+  signing_key = %q
+}
+
+match "http" {
+  rule "header" {
+    whitelist = "Authorization"
+    action = "jwt"
+    claims = ["$.sub"]
+  }
+}
+
+match "grpc" {
+  rule "header" {
+    whitelist = "Authorization"
+    action = "jwt"
+    mode = "claims"
+  }
+}
+`, options.VerifyKeys[0], options.SigningKey)
+
+	config := Config{}
+	assert.Nil(t, ParseConfig([]byte(data), &config))
+
+	redactor, err := Compile(config)
+	assert.Nil(t, err)
+
+	token := makeJWT(t, "HS256", map[string]interface{}{"sub": "42", "email": "diggy@net.cool"})
+	header := http.Header{"Authorization": {"Bearer " + token}}
+
+	result := redactor.Header("GET", "/", header)
+	assert.Equal(t, map[string]interface{}{"sub": "42", "email": "REDACTED"}, jwtClaims(t, strings.TrimPrefix(result.Get("Authorization"), "Bearer ")))
+
+	req, err := http.NewRequest("POST", "/pkg.Service/Method", nil)
+	assert.Nil(t, err)
+	req.Header = header.Clone()
+	redactor.RedactGRPCRequest("/pkg.Service/Method", req)
+	assert.Equal(t, "", req.Header.Get("Authorization"))
+	assert.NotEqual(t, "", req.Header.Get(ClaimsHeader))
+}
+
+func TestValidateJWT(t *testing.T) {
+	options, _ := makeJWTOptions(t)
+	keys, err := LoadJWTKeys(options)
+	assert.Nil(t, err)
+
+	verifyOnly, err := LoadJWTKeys(JWTOptions{VerifyKeys: options.VerifyKeys})
+	assert.Nil(t, err)
+
+	type testCase struct {
+		name  string
+		rule  ConfigRule
+		valid bool
+	}
+
+	cases := []testCase{
+		{name: "with keys", rule: ConfigRule{Action: "jwt", jwtKeys: keys}, valid: true},
+		{name: "with no keys", rule: ConfigRule{Action: "jwt"}},
+		{name: "with no signing key", rule: ConfigRule{Action: "jwt", jwtKeys: verifyOnly}},
+		{name: "with no signing key in claims mode", rule: ConfigRule{Action: "jwt", Mode: "claims", jwtKeys: verifyOnly}, valid: true},
+		{name: "with an unknown mode", rule: ConfigRule{Action: "jwt", Mode: "decode", jwtKeys: keys}},
+		{name: "with an invalid claim", rule: ConfigRule{Action: "jwt", Claims: []string{"$.a("}, jwtKeys: keys}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.rule.validateAction()
+			assert.Equal(t, c.valid, err == nil)
+		})
+	}
+
+	assert.NotNil(t, validateQueryRules("", []ConfigRule{ConfigRule{Whitelist: "token", Action: "jwt", Mode: "claims", jwtKeys: keys}}))
+	assert.NotNil(t, validateHeaderRules([]ConfigRule{ConfigRule{Whitelist: "Authorization", Action: "mask"}}))
+}
@@ -0,0 +1,199 @@
+package redactor
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"unicode"
+)
+
+// The prefix of the envelopes values are encrypted into.
+const envelopePrefix = "enc:"
+
+// The size of the smallest sealed value in an envelope: a GCM nonce and tag.
+const minSealedSize = 12 + 16
+
+// Keyring holds the keys that `encrypt` rules encrypt values with.  The last
+// key in a keyring file is the active one, used to encrypt; the others are
+// kept to decrypt values encrypted before the keys were rotated.
+type Keyring struct {
+	keys   map[string]cipher.AEAD
+	active string
+}
+
+// LoadKeyring reads a keyring file.  See ParseKeyring.
+func LoadKeyring(file string) (*Keyring, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	keyring, err := ParseKeyring(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	return keyring, nil
+}
+
+// ParseKeyring parses a keyring.  Each line is a key ID and a hex encoded
+// 256-bit key separated by whitespace, and the last key is active, so keys are
+// rotated by appending a line.  Blank lines and lines starting with `#` are
+// ignored.
+func ParseKeyring(data []byte) (*Keyring, error) {
+	keyring := &Keyring{keys: map[string]cipher.AEAD{}}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 || strings.Contains(fields[0], ":") {
+			return nil, fmt.Errorf("line %d: expected a key ID and key", lineNumber)
+		}
+
+		key, err := hex.DecodeString(fields[1])
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("line %d: key must be a hex encoded 256-bit key", lineNumber)
+		}
+
+		if _, ok := keyring.keys[fields[0]]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key ID %q", lineNumber, fields[0])
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		keyring.keys[fields[0]] = aead
+		keyring.active = fields[0]
+	}
+
+	if keyring.active == "" {
+		return nil, fmt.Errorf("keyring has no keys")
+	}
+
+	return keyring, scanner.Err()
+}
+
+// Encrypt encrypts the JSON encoding of a value with the active key, so any
+// value (even an Object or Array) can be recovered exactly.  The result is an
+// envelope string, `enc:<key ID>:<base64 nonce and ciphertext>`.
+func (k *Keyring) Encrypt(value interface{}) (string, error) {
+	plain, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	aead := k.keys[k.active]
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	// The key ID is authenticated, so an envelope can't be moved to another.
+	sealed := aead.Seal(nonce, nonce, plain, []byte(k.active))
+
+	return envelopePrefix + k.active + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt recovers the value in an envelope made by Encrypt, with whichever
+// key it was encrypted with.
+func (k *Keyring) Decrypt(envelope string) (interface{}, error) {
+	if !IsEnvelope(envelope) {
+		return nil, fmt.Errorf("keyring: not an envelope")
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(envelope, envelopePrefix), ":", 2)
+
+	aead, ok := k.keys[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("keyring: unknown key ID %q", parts[0])
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("keyring: malformed envelope")
+	}
+
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(parts[0]))
+	if err != nil {
+		return nil, fmt.Errorf("keyring: can't decrypt envelope with key %q", parts[0])
+	}
+
+	var value interface{}
+	err = json.Unmarshal(plain, &value)
+	return value, err
+}
+
+// DecryptDocument returns a copy of a decoded JSON document with every
+// envelope in it decrypted.  Strings that aren't envelopes, even if they start
+// with `enc:`, are left as they are.
+func (k *Keyring) DecryptDocument(value interface{}) (interface{}, error) {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{})
+		for key, v := range typedValue {
+			decrypted, err := k.DecryptDocument(v)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = decrypted
+		}
+		return m, nil
+	case []interface{}:
+		m := make([]interface{}, len(typedValue))
+		for i, v := range typedValue {
+			decrypted, err := k.DecryptDocument(v)
+			if err != nil {
+				return nil, err
+			}
+			m[i] = decrypted
+		}
+		return m, nil
+	case string:
+		if IsEnvelope(typedValue) {
+			return k.Decrypt(typedValue)
+		}
+	}
+
+	return value, nil
+}
+
+// IsEnvelope returns true iff a string has the form of an envelope made by
+// Keyring.Encrypt: `enc:`, a key ID (as ParseKeyring allows), `:` and the
+// standard base64 encoding of a sealed value.
+func IsEnvelope(s string) bool {
+	if !strings.HasPrefix(s, envelopePrefix) {
+		return false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(s, envelopePrefix), ":", 2)
+	if len(parts) != 2 || parts[0] == "" || strings.IndexFunc(parts[0], unicode.IsSpace) >= 0 {
+		return false
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(parts[1])
+	return err == nil && len(sealed) >= minSealedSize
+}
@@ -0,0 +1,146 @@
+package redactor
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testKeyring = `
+# Rotated 2018-01
+k1 000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f
+k2 202122232425262728292a2b2c2d2e2f303132333435363738393a3b3c3d3e3f
+`
+
+func TestParseKeyring(t *testing.T) {
+	type testCase struct {
+		name   string
+		data   string
+		active string
+		valid  bool
+	}
+
+	cases := []testCase{
+		{name: "with keys", data: testKeyring, active: "k2", valid: true},
+		{name: "with no keys", data: "# empty\n", valid: false},
+		{name: "with a short key", data: "k1 0001", valid: false},
+		{name: "with no key", data: "k1", valid: false},
+		{name: "with a key ID containing a colon", data: "k:1 " + strings.Repeat("00", 32), valid: false},
+		{name: "with a duplicate key ID", data: "k1 " + strings.Repeat("00", 32) + "\nk1 " + strings.Repeat("11", 32), valid: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			keyring, err := ParseKeyring([]byte(c.data))
+			assert.Equal(t, c.valid, err == nil)
+			if c.valid {
+				assert.Equal(t, c.active, keyring.active)
+			}
+		})
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	keyring, err := ParseKeyring([]byte(testKeyring))
+	assert.Nil(t, err)
+
+	t.Log("Running with values of each type")
+	for _, value := range []interface{}{"diggy@net.cool", 42.0, true, nil, map[string]interface{}{"a": []interface{}{"b"}}} {
+		envelope, err := keyring.Encrypt(value)
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(envelope, "enc:k2:"))
+		assert.True(t, IsEnvelope(envelope))
+
+		decrypted, err := keyring.Decrypt(envelope)
+		assert.Nil(t, err)
+		assert.Equal(t, value, decrypted)
+	}
+
+	t.Log("Running with a value encrypted before rotation")
+	old, err := ParseKeyring([]byte(strings.Split(testKeyring, "k2")[0]))
+	assert.Nil(t, err)
+	envelope, err := old.Encrypt("data")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(envelope, "enc:k1:"))
+
+	decrypted, err := keyring.Decrypt(envelope)
+	assert.Nil(t, err)
+	assert.Equal(t, "data", decrypted)
+
+	t.Log("Running with a retired key")
+	envelope, err = keyring.Encrypt("data")
+	assert.Nil(t, err)
+	_, err = old.Decrypt(envelope)
+	assert.NotNil(t, err)
+
+	t.Log("Running with an envelope moved to another key")
+	_, err = keyring.Decrypt(strings.Replace(envelope, "enc:k2:", "enc:k1:", 1))
+	assert.NotNil(t, err)
+
+	t.Log("Running with something that isn't an envelope")
+	_, err = keyring.Decrypt("data")
+	assert.NotNil(t, err)
+}
+
+func TestIsEnvelope(t *testing.T) {
+	sealed := base64.StdEncoding.EncodeToString(make([]byte, 40))
+
+	type testCase struct {
+		name     string
+		s        string
+		envelope bool
+	}
+
+	cases := []testCase{
+		{name: "with an envelope", s: "enc:k1:" + sealed, envelope: true},
+		{name: "with no prefix", s: "k1:" + sealed},
+		{name: "with no key ID", s: "enc::" + sealed},
+		{name: "with a key ID with spaces", s: "enc:k 1:" + sealed},
+		{name: "with no payload", s: "enc:k1:"},
+		{name: "with a payload that isn't base64", s: "enc:k1:not base64!"},
+		{name: "with a url-safe base64 payload", s: "enc:k1:" + base64.URLEncoding.EncodeToString(make([]byte, 40)) + "-_"},
+		{name: "with a payload too short to be sealed", s: "enc:k1:AAAA"},
+		{name: "with text like an envelope", s: "enc:note:see ticket 12"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.envelope, IsEnvelope(c.s))
+		})
+	}
+}
+
+func TestDecryptDocument(t *testing.T) {
+	keyring, err := ParseKeyring([]byte(testKeyring))
+	assert.Nil(t, err)
+
+	email, _ := keyring.Encrypt("diggy@net.cool")
+	address, _ := keyring.Encrypt(map[string]interface{}{"city": "NYC"})
+
+	document := map[string]interface{}{
+		"email":   email,
+		"users":   []interface{}{map[string]interface{}{"address": address}},
+		"plain":   "data",
+		"note":    "enc:see:ticket 12",
+		"counter": 1.0,
+	}
+
+	decrypted, err := keyring.DecryptDocument(document)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"email":   "diggy@net.cool",
+		"users":   []interface{}{map[string]interface{}{"address": map[string]interface{}{"city": "NYC"}}},
+		"plain":   "data",
+		"note":    "enc:see:ticket 12",
+		"counter": 1.0,
+	}, decrypted)
+
+	t.Log("Running with an envelope of an unknown key")
+	other, err := ParseKeyring([]byte("k3 " + strings.Repeat("cd", 32)))
+	assert.Nil(t, err)
+	envelope, _ := other.Encrypt("data")
+	_, err = keyring.DecryptDocument(map[string]interface{}{"a": envelope})
+	assert.NotNil(t, err)
+}
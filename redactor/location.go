@@ -0,0 +1,460 @@
+package redactor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Compiled locations, keyed by location string.
+var locationCache sync.Map
+
+// Characters that can't appear in a key written as `.key`.  Keys containing
+// them must be quoted, as in `$['user.name']`.
+const reservedKeyChars = ".[]()'\"*\\"
+
+type segmentKind int
+
+const (
+	segmentKey segmentKind = iota
+	segmentAnyKey
+	segmentIndex
+	segmentAnyIndex
+	segmentSlice
+	segmentFilter
+)
+
+// One segment of a location, which matches one step in the path to a value.
+// A descendant segment (`..`) first skips any number of steps.  Negative
+// indexes and slice bounds count back from the end of the array.
+type segment struct {
+	kind       segmentKind
+	key        string
+	index      int
+	descendant bool
+
+	// Slices only.  Bounds are optional, and step defaults to 1.
+	start, end       int
+	hasStart, hasEnd bool
+	step             int
+
+	filter *filter
+}
+
+// A step in the path from the root of a document to a value: either an
+// object key or an array index.  Where they're known (i.e. during the redact
+// walk) a step carries the length of its array, for negative indexes, and the
+// value it leads to, for filters; otherwise length is -1 and hasValue false.
+type pathStep struct {
+	key     string
+	index   int
+	isIndex bool
+	length  int
+
+	value    interface{}
+	hasValue bool
+}
+
+// A parsed whitelist location.
+type locationPattern struct {
+	segments []segment
+}
+
+// Parses a location string capable of matching against the locations of data
+// in a tree-type data structure (like a JSON or XML blob).
+//
+// For instance, `$.a[*].c` whitelists both `c` values of
+// `{ "a": [{ "c": 4 }, { "c": 2 }] }`.  A location is made up of:
+//
+//   - `$` specifies the root of the document
+//   - `.key` specifies dereferencing a key on an Object
+//   - `['key']` (or `["key"]`) does the same for keys that can't be written
+//     bare, like those containing `.`
+//   - `.*` specifies any key on an Object
+//   - `..` specifies any number of levels, so `$..id` matches `id` anywhere
+//   - `[n]` specifies dereferencing index n (zero-indexed) of an Array, or
+//     the nth from the end if n is negative
+//   - `[*]` specifies all indexes of an Array
+//   - `[start:end]` (or `[start:end:step]`) specifies a slice of an Array,
+//     where either bound may be omitted or negative
+//   - `[?(@.key == 'value')]` specifies the elements (or values of an
+//     Object) matching a filter (see parseFilter)
+func parseLocation(location string) (*locationPattern, error) {
+	if !strings.HasPrefix(location, "$") {
+		return nil, fmt.Errorf("location must start with $")
+	}
+
+	pattern := &locationPattern{}
+
+	i := 1
+	for i < len(location) {
+		seg := segment{}
+
+		switch location[i] {
+		case '.':
+			i++
+			if i < len(location) && location[i] == '.' {
+				seg.descendant = true
+				i++
+
+				if i < len(location) && location[i] == '[' {
+					var err error
+					seg, i, err = parseBracket(location, i)
+					if err != nil {
+						return nil, err
+					}
+					seg.descendant = true
+					break
+				}
+			}
+
+			if i < len(location) && location[i] == '*' {
+				seg.kind = segmentAnyKey
+				i++
+				break
+			}
+
+			start := i
+			for i < len(location) && location[i] != '.' && location[i] != '[' {
+				i++
+			}
+
+			key := location[start:i]
+			if !isBareKey(key) {
+				return nil, fmt.Errorf("invalid key %q at offset %d", key, start)
+			}
+
+			seg.kind = segmentKey
+			seg.key = key
+
+		case '[':
+			var err error
+			seg, i, err = parseBracket(location, i)
+			if err != nil {
+				return nil, err
+			}
+
+		default:
+			return nil, fmt.Errorf("unexpected %q at offset %d", location[i], i)
+		}
+
+		pattern.segments = append(pattern.segments, seg)
+	}
+
+	return pattern, nil
+}
+
+// Parses the bracketed segment starting at `location[i]`, returning it and the
+// offset just after it.
+func parseBracket(location string, i int) (segment, int, error) {
+	start := i
+	i++
+
+	if i >= len(location) {
+		return segment{}, 0, fmt.Errorf("unterminated [ at offset %d", start)
+	}
+
+	seg := segment{}
+
+	switch c := location[i]; {
+	case c == '\'' || c == '"':
+		key, end, err := parseQuoted(location, i)
+		if err != nil {
+			return segment{}, 0, err
+		}
+
+		seg.kind = segmentKey
+		seg.key = key
+		i = end
+
+	case c == '*':
+		seg.kind = segmentAnyIndex
+		i++
+
+	case c == '?':
+		f, end, err := parseFilter(location, i)
+		if err != nil {
+			return segment{}, 0, err
+		}
+
+		seg.kind = segmentFilter
+		seg.filter = f
+		i = end
+
+	default:
+		end := strings.IndexByte(location[i:], ']')
+		if end < 0 {
+			return segment{}, 0, fmt.Errorf("unterminated [ at offset %d", start)
+		}
+
+		var err error
+		seg, err = parseIndex(location[i : i+end])
+		if err != nil {
+			return segment{}, 0, fmt.Errorf("%v at offset %d", err, i)
+		}
+
+		i += end
+	}
+
+	if i >= len(location) || location[i] != ']' {
+		return segment{}, 0, fmt.Errorf("unterminated [ at offset %d", start)
+	}
+
+	return seg, i + 1, nil
+}
+
+// Parses an index (`n` or `-n`) or slice (`start:end:step`).
+func parseIndex(text string) (segment, error) {
+	if !strings.Contains(text, ":") {
+		index, err := strconv.Atoi(text)
+		if err != nil {
+			return segment{}, fmt.Errorf("invalid index %q", text)
+		}
+
+		return segment{kind: segmentIndex, index: index}, nil
+	}
+
+	parts := strings.Split(text, ":")
+	if len(parts) > 3 {
+		return segment{}, fmt.Errorf("invalid slice %q", text)
+	}
+
+	seg := segment{kind: segmentSlice, step: 1}
+
+	bounds := []*int{&seg.start, &seg.end, &seg.step}
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return segment{}, fmt.Errorf("invalid slice %q", text)
+		}
+
+		*bounds[i] = n
+		seg.hasStart = seg.hasStart || i == 0
+		seg.hasEnd = seg.hasEnd || i == 1
+	}
+
+	if seg.step < 1 {
+		return segment{}, fmt.Errorf("invalid slice step in %q", text)
+	}
+
+	return seg, nil
+}
+
+// Parses the quoted string starting at `location[i]`, returning it and the
+// offset just after the closing quote.  A backslash escapes the next
+// character.
+func parseQuoted(location string, i int) (string, int, error) {
+	quote := location[i]
+	start := i
+	i++
+
+	var key strings.Builder
+	for i < len(location) {
+		c := location[i]
+
+		switch {
+		case c == '\\' && i+1 < len(location):
+			key.WriteByte(location[i+1])
+			i += 2
+		case c == quote:
+			return key.String(), i + 1, nil
+		default:
+			key.WriteByte(c)
+			i++
+		}
+	}
+
+	return "", 0, fmt.Errorf("unterminated string at offset %d", start)
+}
+
+// Returns true iff a key can be written bare, as `.key`.
+func isBareKey(key string) bool {
+	return key != "" && !strings.ContainsAny(key, reservedKeyChars)
+}
+
+// Returns the location of the value at `key` of the object at `location`.
+// Keys that can't be written bare are quoted, so the location is unambiguous.
+func keyLocation(location string, key string) string {
+	if isBareKey(key) {
+		return location + "." + key
+	}
+
+	quoted := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(key)
+	return location + "['" + quoted + "']"
+}
+
+// Returns the location of the value at `index` of the array at `location`.
+func indexLocation(location string, index int) string {
+	return location + "[" + strconv.Itoa(index) + "]"
+}
+
+// Returns the location of the value at the end of a path, as built by
+// keyLocation and indexLocation.
+func pathLocation(path []pathStep) string {
+	location := "$"
+	for _, step := range path {
+		if step.isIndex {
+			location = indexLocation(location, step.index)
+		} else {
+			location = keyLocation(location, step.key)
+		}
+	}
+
+	return location
+}
+
+// Parses the location of a value (as built by keyLocation and indexLocation)
+// into the steps leading to it.
+func parsePath(location string) ([]pathStep, error) {
+	// Not cached, since paths come from the data.
+	pattern, err := parseLocation(location)
+	if err != nil {
+		return nil, err
+	}
+
+	steps := make([]pathStep, len(pattern.segments))
+	for i, seg := range pattern.segments {
+		switch {
+		case seg.descendant:
+			return nil, fmt.Errorf("location %q is not a path", location)
+		case seg.kind == segmentKey:
+			steps[i] = pathStep{key: seg.key}
+		case seg.kind == segmentIndex && seg.index >= 0:
+			steps[i] = pathStep{index: seg.index, isIndex: true, length: -1}
+		default:
+			return nil, fmt.Errorf("location %q is not a path", location)
+		}
+	}
+
+	return steps, nil
+}
+
+// Returns a copy of `path` with `step` appended, so sibling paths built from
+// the same parent never share a backing array.
+func appendStep(path []pathStep, step pathStep) []pathStep {
+	return append(path[:len(path):len(path)], step)
+}
+
+// Parses a location with parseLocation, caching the result so each location
+// is only parsed once.
+func compileLocation(location string) (*locationPattern, error) {
+	if cached, ok := locationCache.Load(location); ok {
+		return cached.(*locationPattern), nil
+	}
+
+	pattern, err := parseLocation(location)
+	if err != nil {
+		return nil, err
+	}
+
+	locationCache.Store(location, pattern)
+	return pattern, nil
+}
+
+// Like compileLocation, but panics if the location can't be parsed.
+func mustCompileLocation(location string) *locationPattern {
+	pattern, err := compileLocation(location)
+	if err != nil {
+		panic(err)
+	}
+
+	return pattern
+}
+
+// matchString returns true iff the pattern matches the location of a value.
+func (p *locationPattern) matchString(location string) bool {
+	steps, err := parsePath(location)
+	if err != nil {
+		return false
+	}
+
+	return p.match(steps)
+}
+
+// Returns true iff the pattern matches the path to a value.
+func (p *locationPattern) match(steps []pathStep) bool {
+	return matchSegments(p.segments, steps)
+}
+
+func matchSegments(segments []segment, steps []pathStep) bool {
+	if len(segments) == 0 {
+		return len(steps) == 0
+	}
+
+	seg := segments[0]
+
+	if seg.descendant {
+		for i := range steps {
+			if seg.matchStep(steps[i]) && matchSegments(segments[1:], steps[i+1:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return len(steps) > 0 && seg.matchStep(steps[0]) && matchSegments(segments[1:], steps[1:])
+}
+
+// Returns true iff the segment matches a single step.
+func (s segment) matchStep(step pathStep) bool {
+	switch s.kind {
+	case segmentKey:
+		return !step.isIndex && step.key == s.key
+	case segmentAnyKey:
+		return !step.isIndex
+	case segmentIndex:
+		if s.index < 0 {
+			return step.isIndex && step.length >= 0 && step.index == step.length+s.index
+		}
+		return step.isIndex && step.index == s.index
+	case segmentAnyIndex:
+		return step.isIndex
+	case segmentSlice:
+		return step.isIndex && s.matchSlice(step)
+	case segmentFilter:
+		return step.hasValue && s.filter.eval(step.value)
+	}
+
+	return false
+}
+
+// Returns true iff a slice segment includes an index step.  Bounds relative
+// to the end of an array of unknown length never match.
+func (s segment) matchSlice(step pathStep) bool {
+	start := 0
+	if s.hasStart {
+		start = s.start
+		if start < 0 {
+			if step.length < 0 {
+				return false
+			}
+			start += step.length
+		}
+		if start < 0 {
+			start = 0
+		}
+	}
+
+	if s.hasEnd {
+		end := s.end
+		if end < 0 {
+			if step.length < 0 {
+				return false
+			}
+			end += step.length
+		}
+
+		if step.index >= end {
+			return false
+		}
+	}
+
+	return step.index >= start && (step.index-start)%s.step == 0
+}
@@ -0,0 +1,346 @@
+package redactor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLocation(t *testing.T) {
+	type testCase struct {
+		name     string
+		location string
+		out      []segment
+		valid    bool
+	}
+
+	cases := []testCase{
+		{
+			name:     "with the root",
+			location: "$",
+			out:      nil,
+			valid:    true,
+		},
+		{
+			name:     "with keys and indexes",
+			location: "$.a[2][*].b",
+			out: []segment{
+				segment{kind: segmentKey, key: "a"},
+				segment{kind: segmentIndex, index: 2},
+				segment{kind: segmentAnyIndex},
+				segment{kind: segmentKey, key: "b"},
+			},
+			valid: true,
+		},
+		{
+			name:     "with quoted keys",
+			location: `$['user.name']["it's"]['a\'b']`,
+			out: []segment{
+				segment{kind: segmentKey, key: "user.name"},
+				segment{kind: segmentKey, key: "it's"},
+				segment{kind: segmentKey, key: "a'b"},
+			},
+			valid: true,
+		},
+		{
+			name:     "with wildcard keys",
+			location: "$.*.id",
+			out: []segment{
+				segment{kind: segmentAnyKey},
+				segment{kind: segmentKey, key: "id"},
+			},
+			valid: true,
+		},
+		{
+			name:     "with recursive descent",
+			location: "$..id..['a b']..[0]..*",
+			out: []segment{
+				segment{kind: segmentKey, key: "id", descendant: true},
+				segment{kind: segmentKey, key: "a b", descendant: true},
+				segment{kind: segmentIndex, index: 0, descendant: true},
+				segment{kind: segmentAnyKey, descendant: true},
+			},
+			valid: true,
+		},
+		{
+			name:     "with a negative index",
+			location: "$.a[-1]",
+			out: []segment{
+				segment{kind: segmentKey, key: "a"},
+				segment{kind: segmentIndex, index: -1},
+			},
+			valid: true,
+		},
+		{
+			name:     "with slices",
+			location: "$[1:3][:-2][::2]",
+			out: []segment{
+				segment{kind: segmentSlice, start: 1, end: 3, hasStart: true, hasEnd: true, step: 1},
+				segment{kind: segmentSlice, end: -2, hasEnd: true, step: 1},
+				segment{kind: segmentSlice, step: 2},
+			},
+			valid: true,
+		},
+		{
+			name:     "with an invalid slice step",
+			location: "$[::0]",
+			valid:    false,
+		},
+		{
+			name:     "with too many slice parts",
+			location: "$[1:2:3:4]",
+			valid:    false,
+		},
+		{
+			name:     "with a negative index in a path",
+			location: "$[-a]",
+			valid:    false,
+		},
+		{
+			name:     "with no root",
+			location: "a.b",
+			valid:    false,
+		},
+		{
+			name:     "with an empty key",
+			location: "$.a..",
+			valid:    false,
+		},
+		{
+			name:     "with a reserved character",
+			location: "$.a(",
+			valid:    false,
+		},
+		{
+			name:     "with an unterminated bracket",
+			location: "$.a[1",
+			valid:    false,
+		},
+		{
+			name:     "with an unterminated string",
+			location: "$['a]",
+			valid:    false,
+		},
+		{
+			name:     "with an invalid index",
+			location: "$.a[b]",
+			valid:    false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pattern, err := parseLocation(c.location)
+			if !c.valid {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, c.out, pattern.segments)
+		})
+	}
+}
+
+func TestKeyLocation(t *testing.T) {
+	assert.Equal(t, "$.a", keyLocation("$", "a"))
+	assert.Equal(t, "$.user-name", keyLocation("$", "user-name"))
+	assert.Equal(t, "$['a.b']", keyLocation("$", "a.b"))
+	assert.Equal(t, `$['it\'s']`, keyLocation("$", "it's"))
+	assert.Equal(t, "$['']", keyLocation("$", ""))
+	assert.Equal(t, "$.a[3]", indexLocation("$.a", 3))
+
+	steps, err := parsePath(keyLocation(indexLocation("$", 1), "a.b[0]"))
+	assert.Nil(t, err)
+	assert.Equal(t, []pathStep{pathStep{index: 1, isIndex: true, length: -1}, pathStep{key: "a.b[0]"}}, steps)
+
+	_, err = parsePath("$.a[*]")
+	assert.NotNil(t, err)
+
+	_, err = parsePath("$.a[-1]")
+	assert.NotNil(t, err)
+}
+
+func TestLocationMatch(t *testing.T) {
+	type testCase struct {
+		name     string
+		pattern  string
+		location string
+		match    bool
+	}
+
+	cases := []testCase{
+		{
+			name:     "with a quoted key",
+			pattern:  "$['user-name']",
+			location: "$.user-name",
+			match:    true,
+		},
+		{
+			name:     "with a key containing a dot",
+			pattern:  "$['a.b']",
+			location: "$['a.b']",
+			match:    true,
+		},
+		{
+			name:     "with nested keys that look like a dotted key",
+			pattern:  "$['a.b']",
+			location: "$.a.b",
+			match:    false,
+		},
+		{
+			name:     "with a wildcard key",
+			pattern:  "$.*.id",
+			location: "$.user.id",
+			match:    true,
+		},
+		{
+			name:     "with a wildcard key and an index",
+			pattern:  "$.*.id",
+			location: "$[0].id",
+			match:    false,
+		},
+		{
+			name:     "with a wildcard key and no key",
+			pattern:  "$.*.id",
+			location: "$.id",
+			match:    false,
+		},
+		{
+			name:     "with recursive descent at the top level",
+			pattern:  "$..id",
+			location: "$.id",
+			match:    true,
+		},
+		{
+			name:     "with recursive descent at depth",
+			pattern:  "$..id",
+			location: "$.a[2].b.id",
+			match:    true,
+		},
+		{
+			name:     "with recursive descent and a different key",
+			pattern:  "$..id",
+			location: "$.a.id.b",
+			match:    false,
+		},
+		{
+			name:     "with recursive descent in the middle",
+			pattern:  "$.a..c[*]",
+			location: "$.a.b[1].c[0]",
+			match:    true,
+		},
+		{
+			name:     "with recursive descent and an index",
+			pattern:  "$..[0]",
+			location: "$.a.b[0]",
+			match:    true,
+		},
+		{
+			name:     "with a negative index of unknown length",
+			pattern:  "$.a[-1]",
+			location: "$.a[2]",
+			match:    false,
+		},
+		{
+			name:     "with a slice",
+			pattern:  "$.a[1:3]",
+			location: "$.a[2]",
+			match:    true,
+		},
+		{
+			name:     "with a slice excluding its end",
+			pattern:  "$.a[1:3]",
+			location: "$.a[3]",
+			match:    false,
+		},
+		{
+			name:     "with an open-ended slice",
+			pattern:  "$.a[2:]",
+			location: "$.a[7]",
+			match:    true,
+		},
+		{
+			name:     "with a slice step",
+			pattern:  "$.a[1::2]",
+			location: "$.a[4]",
+			match:    false,
+		},
+		{
+			name:     "with a slice from the end of unknown length",
+			pattern:  "$.a[-2:]",
+			location: "$.a[4]",
+			match:    false,
+		},
+		{
+			name:     "with a filter and no values",
+			pattern:  "$.a[?(@.b)]",
+			location: "$.a[0]",
+			match:    false,
+		},
+		{
+			name:     "with an invalid location",
+			pattern:  "$..id",
+			location: "$.id[",
+			match:    false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.match, mustCompileLocation(c.pattern).matchString(c.location))
+		})
+	}
+}
+
+func TestLocationMatchWithLength(t *testing.T) {
+	element := func(index int, length int) []pathStep {
+		return []pathStep{pathStep{key: "a"}, pathStep{index: index, isIndex: true, length: length}}
+	}
+
+	type testCase struct {
+		name    string
+		pattern string
+		path    []pathStep
+		match   bool
+	}
+
+	cases := []testCase{
+		{
+			name:    "with the last index",
+			pattern: "$.a[-1]",
+			path:    element(4, 5),
+			match:   true,
+		},
+		{
+			name:    "with not the last index",
+			pattern: "$.a[-1]",
+			path:    element(3, 5),
+			match:   false,
+		},
+		{
+			name:    "with a slice from the end",
+			pattern: "$.a[-2:]",
+			path:    element(3, 5),
+			match:   true,
+		},
+		{
+			name:    "with a slice before the end",
+			pattern: "$.a[:-2]",
+			path:    element(3, 5),
+			match:   false,
+		},
+		{
+			name:    "with a slice from before the start",
+			pattern: "$.a[-10:2]",
+			path:    element(0, 5),
+			match:   true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.match, mustCompileLocation(c.pattern).match(c.path))
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package redactor
+
+import (
+	"fmt"
+	"mime"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Handlers that redact bodies, selected by their media type.  Bodies of
+// HandlerNone types (or types with no handler) are replaced with zero bytes.
+const (
+	HandlerJSON    = "json"
+	HandlerNDJSON  = "ndjson"
+	HandlerJSONSeq = "json-seq"
+	HandlerCSV     = "csv"
+	HandlerTSV     = "tsv"
+	HandlerNone    = "none"
+)
+
+// The handlers of media types that a config's `content_types` doesn't map.
+var defaultContentTypes = map[string]string{
+	JSON:    HandlerJSON,
+	NDJSON:  HandlerNDJSON,
+	JSONSeq: HandlerJSONSeq,
+	CSV:     HandlerCSV,
+	TSV:     HandlerTSV,
+}
+
+// The handlers of structured syntax suffixes (RFC 6839 and RFC 8091), as in
+// `application/vnd.api+json`.
+var suffixHandlers = map[string]string{
+	"json":     HandlerJSON,
+	"json-seq": HandlerJSONSeq,
+}
+
+// Returns true iff a `content_types` key is a glob rather than a media type.
+func isContentTypeGlob(key string) bool {
+	return strings.ContainsAny(key, "*?[")
+}
+
+// Parses a Content-Type into its lowercased media type and its parameters.
+// If the parameters are malformed they're ignored, as they always used to
+// be.  Returns the empty string if there's no media type.
+func parseMediaType(contentType string) (string, map[string]string) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil && err != mime.ErrInvalidMediaParameter {
+		return "", map[string]string{}
+	}
+
+	if params == nil {
+		params = map[string]string{}
+	}
+
+	return mediaType, params
+}
+
+// Returns the handler of a media type.  The config's `content_types` are
+// checked first, by exact media type and then by glob (in sorted order), and
+// then the default handlers and structured syntax suffixes.  Returns the
+// empty string if the type has no handler.
+func contentHandler(types map[string]string, mediaType string) string {
+	if handler, ok := types[mediaType]; ok {
+		return handler
+	}
+
+	globs := []string{}
+	for key := range types {
+		if isContentTypeGlob(key) {
+			globs = append(globs, key)
+		}
+	}
+	sort.Strings(globs)
+
+	for _, glob := range globs {
+		if matched, _ := path.Match(glob, mediaType); matched {
+			return types[glob]
+		}
+	}
+
+	if handler, ok := defaultContentTypes[mediaType]; ok {
+		return handler
+	}
+
+	if i := strings.LastIndexByte(mediaType, '+'); i >= 0 {
+		return suffixHandlers[mediaType[i+1:]]
+	}
+
+	return ""
+}
+
+// ContentHandler returns the handler of a Content-Type (one of the Handler
+// constants) given a config's `content_types`, or the empty string if the
+// type has no handler.
+func ContentHandler(types map[string]string, contentType string) string {
+	mediaType, _ := parseMediaType(contentType)
+	return contentHandler(normalizeContentTypes(types), mediaType)
+}
+
+// Returns a copy of a config's `content_types` keyed by lowercased media type
+// or glob, as contentHandler expects, or nil if there are none.
+func normalizeContentTypes(types map[string]string) map[string]string {
+	if len(types) == 0 {
+		return nil
+	}
+
+	result := map[string]string{}
+	for key, handler := range types {
+		result[strings.ToLower(key)] = handler
+	}
+
+	return result
+}
+
+// Returns true iff a charset needs converting to UTF-8.
+func isForeignCharset(charset string) bool {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8", "us-ascii":
+		return false
+	}
+
+	return true
+}
+
+// Converts a body in `charset` to UTF-8, which is what JSON is parsed as and
+// redacted bodies are written in.  Returns an error if the charset is unknown.
+func decodeCharset(charset string, body []byte) ([]byte, error) {
+	if !isForeignCharset(charset) {
+		return body, nil
+	}
+
+	encoding, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q", charset)
+	}
+
+	return encoding.NewDecoder().Bytes(body)
+}
+
+// Returns the Content-Type of a body after it's been redacted: if its charset
+// was converted to UTF-8, the charset parameter says so.
+func redactedContentType(contentType string) string {
+	mediaType, params := parseMediaType(contentType)
+	if mediaType == "" || !isForeignCharset(params["charset"]) {
+		return contentType
+	}
+
+	params["charset"] = "utf-8"
+	return mime.FormatMediaType(mediaType, params)
+}
+
+// Returns an error if a `content_types` key isn't a media type or glob, or
+// maps to an unknown handler.
+func validateContentTypes(types map[string]string) error {
+	for key, handler := range types {
+		if isContentTypeGlob(key) {
+			if _, err := path.Match(key, ""); err != nil {
+				return fmt.Errorf("invalid content type %q: %v", key, err)
+			}
+		} else if _, _, err := mime.ParseMediaType(key); err != nil {
+			return fmt.Errorf("invalid content type %q: %v", key, err)
+		}
+
+		switch handler {
+		case HandlerJSON, HandlerNDJSON, HandlerJSONSeq, HandlerCSV, HandlerTSV, HandlerNone:
+		default:
+			return fmt.Errorf("unknown handler %q for content type %q", handler, key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package redactor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentHandler(t *testing.T) {
+	types := map[string]string{
+		"application/x-amz-json-1.1": "json",
+		"application/vnd.*":          "none",
+		"text/*":                     "ndjson",
+		"application/problem+json":   "none",
+	}
+
+	type testCase struct {
+		name        string
+		types       map[string]string
+		contentType string
+		handler     string
+	}
+
+	cases := []testCase{
+		{name: "with json", contentType: "application/json", handler: "json"},
+		{name: "with parameters", contentType: "Application/JSON; charset=UTF-8", handler: "json"},
+		{name: "with malformed parameters", contentType: "application/json; charset", handler: "json"},
+		{name: "with a json suffix", contentType: "application/vnd.api+json", handler: "json"},
+		{name: "with another json suffix", contentType: "application/merge-patch+json", handler: "json"},
+		{name: "with a json-seq suffix", contentType: "application/geo+json-seq", handler: "json-seq"},
+		{name: "with ndjson", contentType: "application/x-ndjson", handler: "ndjson"},
+		{name: "with an unsupported type", contentType: "application/xml", handler: ""},
+		{name: "with an unsupported suffix", contentType: "application/atom+xml", handler: ""},
+		{name: "with no type", contentType: "", handler: ""},
+		{name: "with a mapped type", types: types, contentType: "application/x-amz-json-1.1", handler: "json"},
+		{name: "with a mapped glob", types: types, contentType: "text/plain", handler: "ndjson"},
+		{name: "with a mapped suffix type", types: types, contentType: "application/problem+json", handler: "none"},
+		{name: "with a type mapped before its suffix", types: types, contentType: "application/vnd.api+json", handler: "none"},
+		{name: "with an unmapped type", types: types, contentType: "application/json", handler: "json"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mediaType, _ := parseMediaType(c.contentType)
+			assert.Equal(t, c.handler, contentHandler(c.types, mediaType))
+		})
+	}
+}
+
+func TestExportedContentHandler(t *testing.T) {
+	types := map[string]string{"Application/X-Amz-JSON-1.1": "json"}
+
+	assert.Equal(t, HandlerJSON, ContentHandler(types, "application/x-amz-json-1.1; charset=utf-8"))
+	assert.Equal(t, HandlerJSON, ContentHandler(nil, "Application/JSON; charset=utf-8"))
+	assert.Equal(t, HandlerJSON, ContentHandler(nil, "application/vnd.x+json"))
+	assert.Equal(t, HandlerCSV, ContentHandler(nil, "text/csv"))
+	assert.Equal(t, "", ContentHandler(nil, "text/plain"))
+}
+
+func TestDecodeCharset(t *testing.T) {
+	type testCase struct {
+		name    string
+		charset string
+		in      []byte
+		out     string
+		valid   bool
+	}
+
+	cases := []testCase{
+		{name: "with no charset", charset: "", in: []byte("caf\xc3\xa9"), out: "café", valid: true},
+		{name: "with utf-8", charset: "UTF-8", in: []byte("caf\xc3\xa9"), out: "café", valid: true},
+		{name: "with latin-1", charset: "ISO-8859-1", in: []byte("caf\xe9"), out: "café", valid: true},
+		{name: "with utf-16", charset: "utf-16be", in: []byte{0, 'h', 0, 'i'}, out: "hi", valid: true},
+		{name: "with an unknown charset", charset: "klingon", in: []byte("hi")},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out, err := decodeCharset(c.charset, c.in)
+			assert.Equal(t, c.valid, err == nil)
+			if c.valid {
+				assert.Equal(t, c.out, string(out))
+			}
+		})
+	}
+}
+
+func TestRedactedContentType(t *testing.T) {
+	assert.Equal(t, "application/json", redactedContentType("application/json"))
+	assert.Equal(t, "application/json; charset=UTF-8", redactedContentType("application/json; charset=UTF-8"))
+	assert.Equal(t, "application/json; charset=utf-8", redactedContentType("application/json; charset=iso-8859-1"))
+	assert.Equal(t, "application/vnd.api+json; charset=utf-8; ext=bulk", redactedContentType("application/vnd.api+json; ext=bulk; charset=windows-1252"))
+}
+
+func TestValidateContentTypes(t *testing.T) {
+	assert.Nil(t, validateContentTypes(map[string]string{"application/x-amz-json-1.1": "json", "text/*": "none"}))
+	assert.NotNil(t, validateContentTypes(map[string]string{"application/x-amz-json-1.1": "xml"}))
+	assert.NotNil(t, validateContentTypes(map[string]string{"application/[": "json"}))
+	assert.NotNil(t, validateContentTypes(map[string]string{"application/": "json"}))
+}
+
+func TestMapBodyWithContentTypes(t *testing.T) {
+	redactor := MustCompile(Config{
+		ContentTypes: map[string]string{"Application/X-Amz-JSON-1.1": "json", "application/vnd.*": "none"},
+		Match: MatchOptions{HTTP: []HTTPMatch{
+			HTTPMatch{RuleOptions: RuleOptions{Body: []ConfigRule{ConfigRule{Whitelist: "$.a"}}}},
+		}},
+	})
+
+	type testCase struct {
+		name        string
+		contentType string
+		in          []byte
+		out         string
+	}
+
+	cases := []testCase{
+		{name: "with a json suffix", contentType: "application/merge-patch+json", in: []byte(`{"a": 1, "b": 2}`), out: `{"a":1,"b":0}`},
+		{name: "with a mapped type", contentType: "application/x-amz-json-1.1", in: []byte(`{"a": 1, "b": 2}`), out: `{"a":1,"b":0}`},
+		{name: "with a type mapped to none", contentType: "application/vnd.api+json", in: []byte(`{"a": 1}`), out: ``},
+		{name: "with a latin-1 body", contentType: "application/json; charset=iso-8859-1", in: []byte("{\"a\": \"caf\xe9\"}"), out: `{"a":"café"}`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			body, err := redactor.Body("POST", "/", c.contentType, c.in)
+			assert.Nil(t, err)
+			assert.Equal(t, c.out, string(body))
+		})
+	}
+}
+
+func TestRedactBodyWithCharset(t *testing.T) {
+	request, _ := http.NewRequest("POST", "", bytes.NewReader([]byte("{\"a\": \"caf\xe9\"}")))
+	request.Header.Set("Content-Type", "application/json; charset=ISO-8859-1")
+
+	match := HTTPMatch{RuleOptions: RuleOptions{Body: []ConfigRule{ConfigRule{Whitelist: "$.a"}}}}
+	assert.Nil(t, redactBody(match, request))
+
+	body, err := ioutil.ReadAll(request.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a":"café"}`, string(body))
+	assert.Equal(t, "application/json; charset=utf-8", request.Header.Get("Content-Type"))
+}
@@ -0,0 +1,153 @@
+package redactor
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+)
+
+// RedactedHeader is added to every request that has been redacted, so
+// upstream services can tell redacted data from raw data.
+const RedactedHeader = "X-Privacy-Proxy-Redacted"
+
+// A ResponseWriter that buffers the response so its body can be redacted
+// once the wrapped handler has finished writing it.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	return b.body.Write(data)
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+// A ResponseWriter that filters the cookies of the wrapped handler's response
+// as its header is written, so its body is still streamed.
+type cookieResponse struct {
+	http.ResponseWriter
+	match       HTTPMatch
+	wroteHeader bool
+}
+
+func (c *cookieResponse) WriteHeader(status int) {
+	if !c.wroteHeader {
+		header := c.ResponseWriter.Header()
+		redacted := RedactCookies(c.match, header)
+		for name := range header {
+			delete(header, name)
+		}
+		for name, values := range redacted {
+			header[name] = values
+		}
+
+		c.wroteHeader = status >= 200
+	}
+
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *cookieResponse) Write(data []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+
+	return c.ResponseWriter.Write(data)
+}
+
+func (c *cookieResponse) Flush() {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the wrapped ResponseWriter, for http.ResponseController.
+func (c *cookieResponse) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// Middleware returns net/http middleware that redacts requests exactly as the
+// reverse proxy does before passing them to the wrapped handler, so a single
+// config can drive both deployments.  Panics if the config is invalid; use
+// Compile and Redactor.Middleware to handle the error instead.
+func Middleware(config Config) func(http.Handler) http.Handler {
+	return MustCompile(config).Middleware()
+}
+
+// Middleware returns net/http middleware that redacts the body, querystring
+// and headers of each request before passing it to the wrapped handler.  If
+// the matching clause has `redact_response` set, the handler's response is
+// buffered and redacted before being written.  Otherwise, if it filters
+// cookies, only the response's Set-Cookie headers are filtered, and its body
+// is streamed.
+func (r *Redactor) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			match := r.Match(req.Method, req.URL.EscapedPath())
+
+			err := RedactRequest(match, req)
+			if err != nil {
+				log.Println(err)
+			}
+
+			// A streamed body must be closed even if the handler doesn't read
+			// it, and the server only closes the original.
+			if req.Body != nil {
+				defer req.Body.Close()
+			}
+
+			req.RequestURI = req.URL.RequestURI()
+			req.Header.Add(RedactedHeader, "1")
+
+			if !match.RedactResponse {
+				if len(match.Cookie) > 0 {
+					w = &cookieResponse{ResponseWriter: w, match: match}
+				}
+
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			buffered := &bufferedResponse{header: http.Header{}}
+			next.ServeHTTP(buffered, req)
+
+			if buffered.status == 0 {
+				buffered.status = http.StatusOK
+			}
+
+			resp := &http.Response{
+				StatusCode: buffered.status,
+				Header:     buffered.header,
+				Body:       ioutil.NopCloser(&buffered.body),
+			}
+
+			err = RedactResponse(match, resp)
+			if err != nil {
+				log.Println(err)
+			}
+
+			for name, values := range resp.Header {
+				w.Header()[name] = values
+			}
+			w.WriteHeader(resp.StatusCode)
+			io.Copy(w, resp.Body)
+			resp.Body.Close()
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package redactor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	config := Config{
+		Match: MatchOptions{
+			HTTP: []HTTPMatch{
+				HTTPMatch{
+					Path:           "/response",
+					RedactResponse: true,
+					RuleOptions: RuleOptions{
+						Response: []ConfigRule{ConfigRule{Whitelist: "$.ok"}},
+					},
+				},
+				HTTPMatch{
+					Path: "/v1",
+					RuleOptions: RuleOptions{
+						Body:        []ConfigRule{ConfigRule{Whitelist: "$.a"}},
+						Querystring: []ConfigRule{ConfigRule{Whitelist: "a"}},
+					},
+				},
+			},
+		},
+	}
+
+	var received *http.Request
+	var receivedBody string
+
+	handler := Middleware(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = r
+		receivedBody = string(body)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"ok": true, "email": "diggy@net.cool"}`))
+	}))
+
+	type testCase struct {
+		name          string
+		path          string
+		expectedBody  string
+		expectedQuery string
+		expectedResp  string
+	}
+
+	cases := []testCase{
+		{
+			name:          "with a request whitelist",
+			path:          "/v1?a=1&b=2",
+			expectedBody:  `{"a":1,"b":0}`,
+			expectedQuery: "a=1&b=REDACTED",
+			expectedResp:  `{"ok": true, "email": "diggy@net.cool"}`,
+		},
+		{
+			name:          "with response redaction",
+			path:          "/response?a=1",
+			expectedBody:  `{"a":0,"b":0}`,
+			expectedQuery: "a=REDACTED",
+			expectedResp:  `{"email":"REDACTED","ok":true}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			request := httptest.NewRequest("POST", c.path, strings.NewReader(`{"a": 1, "b": 2}`))
+			request.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, request)
+
+			assert.Equal(t, c.expectedBody, receivedBody)
+			assert.Equal(t, c.expectedQuery, received.URL.RawQuery)
+			assert.Equal(t, received.URL.RequestURI(), received.RequestURI)
+			assert.Equal(t, "1", received.Header.Get(RedactedHeader))
+
+			assert.Equal(t, http.StatusCreated, recorder.Code)
+			assert.Equal(t, c.expectedResp, recorder.Body.String())
+		})
+	}
+}
+
+func TestMiddlewareWithCookies(t *testing.T) {
+	config := Config{Match: MatchOptions{HTTP: []HTTPMatch{
+		HTTPMatch{RuleOptions: RuleOptions{Cookie: []ConfigRule{ConfigRule{Whitelist: "session"}}}},
+	}}}
+
+	var received *http.Request
+
+	handler := Middleware(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+		http.SetCookie(w, &http.Cookie{Name: "_ga", Value: "GA1.2.3"})
+		w.Write([]byte("ok"))
+	}))
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("Cookie", "session=abc; _ga=GA1.2.3")
+	recorder := httptest.NewRecorder()
+
+	handler.ServeHTTP(recorder, request)
+
+	assert.Equal(t, "session=abc", received.Header.Get("Cookie"))
+	assert.Equal(t, []string{"session=abc"}, recorder.Header()["Set-Cookie"])
+	assert.Equal(t, "ok", recorder.Body.String())
+}
+
+func TestMiddlewareWithCookiesStreamed(t *testing.T) {
+	config := Config{Match: MatchOptions{HTTP: []HTTPMatch{
+		HTTPMatch{RuleOptions: RuleOptions{Cookie: []ConfigRule{ConfigRule{Whitelist: "session"}}}},
+	}}}
+
+	handler := Middleware(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+		http.SetCookie(w, &http.Cookie{Name: "_ga", Value: "GA1.2.3"})
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("chunk"))
+
+		flusher, ok := w.(http.Flusher)
+		assert.True(t, ok)
+		flusher.Flush()
+
+		// Cookies set once the header is written are never sent.
+		http.SetCookie(w, &http.Cookie{Name: "late", Value: "1"})
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.True(t, recorder.Flushed)
+	assert.Equal(t, []string{"session=abc"}, recorder.Result().Header["Set-Cookie"])
+	assert.Equal(t, "chunk", recorder.Body.String())
+}
+
+func TestMiddlewareWithInvalidConfig(t *testing.T) {
+	config := Config{Match: MatchOptions{HTTP: []HTTPMatch{
+		HTTPMatch{RuleOptions: RuleOptions{Body: []ConfigRule{ConfigRule{Whitelist: "$.a("}}}},
+	}}}
+
+	assert.Panics(t, func() { Middleware(config) })
+}
@@ -0,0 +1,207 @@
+package redactor
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Policies for named path segments that aren't whitelisted.  PathRedact is
+// the default.
+const (
+	PathRedact = "redact"
+	PathHash   = "hash"
+)
+
+// Returns true iff a match clause's path is a template with named segments,
+// as in `/users/{id}/orders`.
+func isPathTemplate(template string) bool {
+	return strings.Contains(template, "{")
+}
+
+// HasPathTemplate returns true iff the match clause's path is a template with
+// named segments.
+func (m HTTPMatch) HasPathTemplate() bool {
+	return isPathTemplate(m.Path)
+}
+
+// Splits a path into its segments, ignoring leading and trailing slashes.
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return []string{}
+	}
+
+	return strings.Split(p, "/")
+}
+
+// Unescapes an escaped path (or segment), or returns it as it is if it can't
+// be unescaped.
+func unescapePath(escaped string) string {
+	decoded, err := url.PathUnescape(escaped)
+	if err != nil {
+		return escaped
+	}
+
+	return decoded
+}
+
+// Splits an escaped path into its segments, unescaping each.  Unlike
+// splitting the decoded path, a segment holding an escaped slash (`%2F`)
+// stays one segment.
+func splitEscapedPath(escaped string) []string {
+	segments := splitPath(escaped)
+	for i, segment := range segments {
+		segments[i] = unescapePath(segment)
+	}
+
+	return segments
+}
+
+// Returns the name of a template segment like `{id}`, or false if it's a
+// literal segment.
+func segmentName(segment string) (string, bool) {
+	if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+
+	return "", false
+}
+
+// Returns true iff an escaped pathname matches a path template.  A named
+// segment matches any single non-empty segment (see splitEscapedPath), and
+// trailing slashes are ignored.
+func matchPathTemplate(template string, pathname string) bool {
+	return matchPathSegments(splitPath(template), splitEscapedPath(pathname))
+}
+
+// Like matchPathTemplate, for paths already split into segments.
+func matchPathSegments(template []string, segments []string) bool {
+	if len(template) != len(segments) {
+		return false
+	}
+
+	for i, t := range template {
+		if _, ok := segmentName(t); ok {
+			if segments[i] == "" {
+				return false
+			}
+		} else if t != segments[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RedactPathSegment redacts the value of a named path segment unless it's
+// whitelisted by a `rule "path"` of the match.  Values that aren't are
+// redacted or hashed according to the match's `path_policy`.
+func RedactPathSegment(match HTTPMatch, name string, value string) string {
+	rule, ok := findNameWhitelistMatch(match.PathRules, name, value)
+	if !ok {
+		if match.PathPolicy == PathHash {
+			return hashValue(match.hashKey, value)
+		}
+		return RedactedStr
+	}
+
+	if rule.action() == ActionPass {
+		return value
+	}
+
+	replaced, ok := rule.replace(value)
+	if !ok || replaced == nil {
+		return RedactedStr
+	}
+
+	return fmt.Sprint(replaced)
+}
+
+// RedactPath redacts the named segments of a URL's path if the match's path
+// is a template, as in `/users/REDACTED/orders` for `/users/{id}/orders`.
+// Literal segments are kept, so the upstream can still route the request.
+// Segments are split from the escaped path, as FindHTTPMatch matches them.
+//
+// Returns a redacted copy of `u`, does not mutate.
+func RedactPath(match HTTPMatch, u *url.URL) *url.URL {
+	result := *u
+
+	if !match.HasPathTemplate() {
+		return &result
+	}
+
+	template := splitPath(match.Path)
+	escaped := splitPath(u.EscapedPath())
+	segments := splitEscapedPath(u.EscapedPath())
+
+	if !matchPathSegments(template, segments) {
+		return &result
+	}
+
+	for i, t := range template {
+		if name, ok := segmentName(t); ok {
+			if value := RedactPathSegment(match, name, segments[i]); value != segments[i] {
+				escaped[i] = url.PathEscape(value)
+			}
+		}
+	}
+
+	rawPath := "/" + strings.Join(escaped, "/")
+	if strings.HasSuffix(u.EscapedPath(), "/") && len(escaped) > 0 {
+		rawPath += "/"
+	}
+
+	result.Path, _ = url.PathUnescape(rawPath)
+	result.RawPath = rawPath
+
+	return &result
+}
+
+// Returns an error if a path template's segment names are empty or repeated,
+// the path policy is unknown, or any of the path rules has an invalid pattern
+// or an action that would remove the segment.
+func validatePathRules(template string, policy string, rules []ConfigRule) error {
+	names := map[string]bool{}
+	for _, segment := range splitPath(template) {
+		name, ok := segmentName(segment)
+		if !ok {
+			if strings.ContainsAny(segment, "{}") {
+				return fmt.Errorf("invalid path segment %q", segment)
+			}
+			continue
+		}
+
+		if name == "" || strings.ContainsAny(name, "{}") || names[name] {
+			return fmt.Errorf("invalid path segment %q", segment)
+		}
+		names[name] = true
+	}
+
+	switch policy {
+	case "", PathRedact, PathHash:
+	default:
+		return fmt.Errorf("unknown path policy %q", policy)
+	}
+
+	for _, rule := range rules {
+		if _, err := compilePattern(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid path whitelist %q: %v", rule.Whitelist, err)
+		}
+
+		switch rule.action() {
+		case ActionDrop, ActionNull:
+			return fmt.Errorf("invalid path whitelist %q: path segments can't be removed", rule.Whitelist)
+		}
+
+		if err := rule.validateAction(); err != nil {
+			return fmt.Errorf("invalid path whitelist %q: %v", rule.Whitelist, err)
+		}
+
+		if err := rule.validateStringAction(); err != nil {
+			return fmt.Errorf("invalid path whitelist %q: %v", rule.Whitelist, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package redactor
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactPath(t *testing.T) {
+	makePathMatch := func(template string, rules ...ConfigRule) HTTPMatch {
+		return HTTPMatch{Path: template, RuleOptions: RuleOptions{PathRules: rules}}
+	}
+
+	type testCase struct {
+		name  string
+		match HTTPMatch
+		in    string
+		out   string
+	}
+
+	cases := []testCase{
+		{
+			name:  "with no template",
+			match: makePathMatch("/users"),
+			in:    "/users",
+			out:   "/users",
+		},
+		{
+			name:  "with a named segment",
+			match: makePathMatch("/users/{id}/orders"),
+			in:    "/users/diggy@net.cool/orders",
+			out:   "/users/REDACTED/orders",
+		},
+		{
+			name:  "with a whitelisted segment",
+			match: makePathMatch("/users/{id}/orders/{order}", ConfigRule{Whitelist: "order"}),
+			in:    "/users/diggy@net.cool/orders/42/",
+			out:   "/users/REDACTED/orders/42/",
+		},
+		{
+			name:  "with a glob whitelist",
+			match: makePathMatch("/{resource}/{id}", ConfigRule{Whitelist: "res*"}),
+			in:    "/users/1",
+			out:   "/users/REDACTED",
+		},
+		{
+			name:  "with a value pattern",
+			match: makePathMatch("/users/{id}", ConfigRule{Whitelist: "id", Pattern: "^[0-9]+$"}),
+			in:    "/users/diggy@net.cool",
+			out:   "/users/REDACTED",
+		},
+		{
+			name:  "with an action",
+			match: makePathMatch("/users/{id}", ConfigRule{Whitelist: "id", Action: "mask", Keep: 2}),
+			in:    "/users/12345",
+			out:   "/users/***45",
+		},
+		{
+			name:  "with the hash policy",
+			match: HTTPMatch{Path: "/users/{id}", PathPolicy: "hash", hashKey: testHashKey},
+			in:    "/users/diggy@net.cool",
+			out:   "/users/" + hashValue(testHashKey, "diggy@net.cool"),
+		},
+		{
+			name:  "with an escaped slash",
+			match: makePathMatch("/files/{name}", ConfigRule{Whitelist: "name"}),
+			in:    "/files/a%2Fb",
+			out:   "/files/a/b",
+		},
+		{
+			name:  "with a path that doesn't match",
+			match: makePathMatch("/users/{id}"),
+			in:    "/users/1/orders",
+			out:   "/users/1/orders",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			u, err := url.Parse(c.in)
+			assert.Nil(t, err)
+
+			result := RedactPath(c.match, u)
+			assert.Equal(t, c.out, result.Path)
+			assert.Equal(t, c.in, u.EscapedPath())
+		})
+	}
+}
+
+func TestRedactPathEscaping(t *testing.T) {
+	match := HTTPMatch{Path: "/files/{name}/{id}", RuleOptions: RuleOptions{PathRules: []ConfigRule{
+		ConfigRule{Whitelist: "name"},
+		ConfigRule{Whitelist: "id", Action: "literal", Value: "a/b"},
+	}}}
+
+	u, err := url.Parse("/files/a%2Fb/1")
+	assert.Nil(t, err)
+
+	result := RedactPath(match, u)
+	assert.Equal(t, "/files/a%2Fb/a%2Fb", result.EscapedPath())
+}
+
+func TestRedactRequestPathWithEscapedSlash(t *testing.T) {
+	redactor := MustCompile(Config{Match: MatchOptions{HTTP: []HTTPMatch{
+		HTTPMatch{Path: "/users/{id}/orders"},
+		HTTPMatch{},
+	}}})
+
+	r, err := http.NewRequest("GET", "http://upstream/users/a%2Fb/orders", nil)
+	assert.Nil(t, err)
+
+	match := redactor.Match(r.Method, r.URL.EscapedPath())
+	assert.Equal(t, "/users/{id}/orders", match.Path)
+	assert.Nil(t, RedactRequest(match, r))
+	assert.Equal(t, "/users/REDACTED/orders", r.URL.EscapedPath())
+
+	assert.Equal(t, "/users/REDACTED/orders", redactor.Path("GET", "/users/a%2Fb/orders"))
+}
+
+func TestValidatePathRules(t *testing.T) {
+	type testCase struct {
+		name     string
+		template string
+		policy   string
+		rules    []ConfigRule
+		valid    bool
+	}
+
+	cases := []testCase{
+		{name: "with a plain path", template: "/users", valid: true},
+		{name: "with a template", template: "/users/{id}", policy: "hash", rules: []ConfigRule{ConfigRule{Whitelist: "id"}}, valid: true},
+		{name: "with an empty name", template: "/users/{}"},
+		{name: "with a repeated name", template: "/{id}/{id}"},
+		{name: "with a partial segment", template: "/users/id-{id}"},
+		{name: "with an unknown policy", template: "/users/{id}", policy: "drop"},
+		{name: "with a null action", template: "/users/{id}", rules: []ConfigRule{ConfigRule{Whitelist: "id", Action: "null"}}},
+		{name: "with an invalid pattern", template: "/users/{id}", rules: []ConfigRule{ConfigRule{Whitelist: "id", Pattern: "("}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validatePathRules(c.template, c.policy, c.rules)
+			assert.Equal(t, c.valid, err == nil)
+		})
+	}
+}
@@ -0,0 +1,628 @@
+package redactor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Field types and labels from google/protobuf/descriptor.proto.
+const (
+	typeDouble   = 1
+	typeFloat    = 2
+	typeInt64    = 3
+	typeUint64   = 4
+	typeInt32    = 5
+	typeFixed64  = 6
+	typeFixed32  = 7
+	typeBool     = 8
+	typeString   = 9
+	typeGroup    = 10
+	typeMessage  = 11
+	typeBytes    = 12
+	typeUint32   = 13
+	typeEnum     = 14
+	typeSfixed32 = 15
+	typeSfixed64 = 16
+	typeSint32   = 17
+	typeSint64   = 18
+
+	labelRepeated = 3
+)
+
+var errTruncated = errors.New("protobuf: truncated message")
+
+// A field of a protobuf message type.
+type protoField struct {
+	Name     string
+	Number   uint64
+	Label    uint64
+	Type     uint64
+	TypeName string
+}
+
+// Returns true iff the field holds a scalar that may be packed.
+func (f *protoField) isPackable() bool {
+	return f.Type != typeString && f.Type != typeBytes && f.Type != typeMessage && f.Type != typeGroup
+}
+
+// A protobuf message type.
+type protoMessage struct {
+	Name     string
+	Fields   map[uint64]*protoField
+	MapEntry bool
+}
+
+// A gRPC method.
+type protoMethod struct {
+	InputType       string
+	OutputType      string
+	ClientStreaming bool
+	ServerStreaming bool
+}
+
+// Descriptors holds the message types and gRPC methods of a set of compiled
+// .proto files, as produced by `protoc --include_imports --descriptor_set_out`.
+type Descriptors struct {
+	messages map[string]*protoMessage
+	methods  map[string]*protoMethod
+}
+
+// LoadDescriptorSet reads a binary FileDescriptorSet from `file`.
+func LoadDescriptorSet(file string) (*Descriptors, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseDescriptorSet(data)
+}
+
+// Returns an empty set of descriptors.
+func newDescriptors() *Descriptors {
+	return &Descriptors{
+		messages: map[string]*protoMessage{},
+		methods:  map[string]*protoMethod{},
+	}
+}
+
+// ParseDescriptorSet parses a binary FileDescriptorSet.
+func ParseDescriptorSet(data []byte) (*Descriptors, error) {
+	descriptors := newDescriptors()
+
+	err := descriptors.add(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return descriptors, nil
+}
+
+// Adds the types of a FileDescriptorSet to the descriptors.
+func (d *Descriptors) add(data []byte) error {
+	return walkFields(data, func(number uint64, wireType int, value []byte, _ uint64) error {
+		if number == 1 && wireType == wireBytes {
+			return d.addFile(value)
+		}
+		return nil
+	})
+}
+
+// Adds the types of a FileDescriptorProto.
+func (d *Descriptors) addFile(data []byte) error {
+	var pkg string
+	var messages, services [][]byte
+
+	err := walkFields(data, func(number uint64, wireType int, value []byte, _ uint64) error {
+		switch {
+		case number == 2 && wireType == wireBytes:
+			pkg = string(value)
+		case number == 4 && wireType == wireBytes:
+			messages = append(messages, value)
+		case number == 6 && wireType == wireBytes:
+			services = append(services, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	prefix := ""
+	if pkg != "" {
+		prefix = pkg + "."
+	}
+
+	for _, message := range messages {
+		if err := d.addMessage(prefix, message); err != nil {
+			return err
+		}
+	}
+
+	for _, service := range services {
+		if err := d.addService(prefix, service); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Adds a DescriptorProto and its nested types.
+func (d *Descriptors) addMessage(prefix string, data []byte) error {
+	message := &protoMessage{Fields: map[uint64]*protoField{}}
+	var nested [][]byte
+
+	err := walkFields(data, func(number uint64, wireType int, value []byte, _ uint64) error {
+		switch {
+		case number == 1 && wireType == wireBytes:
+			message.Name = prefix + string(value)
+		case number == 2 && wireType == wireBytes:
+			field, err := parseField(value)
+			if err != nil {
+				return err
+			}
+			message.Fields[field.Number] = field
+		case number == 3 && wireType == wireBytes:
+			nested = append(nested, value)
+		case number == 7 && wireType == wireBytes:
+			// MessageOptions.map_entry
+			return walkFields(value, func(number uint64, wireType int, _ []byte, v uint64) error {
+				if number == 7 && wireType == wireVarint {
+					message.MapEntry = v != 0
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	d.messages[message.Name] = message
+
+	for _, n := range nested {
+		if err := d.addMessage(message.Name+".", n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Parses a FieldDescriptorProto.
+func parseField(data []byte) (*protoField, error) {
+	field := &protoField{}
+
+	err := walkFields(data, func(number uint64, wireType int, value []byte, v uint64) error {
+		switch {
+		case number == 1 && wireType == wireBytes:
+			field.Name = string(value)
+		case number == 3 && wireType == wireVarint:
+			field.Number = v
+		case number == 4 && wireType == wireVarint:
+			field.Label = v
+		case number == 5 && wireType == wireVarint:
+			field.Type = v
+		case number == 6 && wireType == wireBytes:
+			field.TypeName = strings.TrimPrefix(string(value), ".")
+		}
+		return nil
+	})
+
+	return field, err
+}
+
+// Adds the methods of a ServiceDescriptorProto, keyed by their gRPC path.
+func (d *Descriptors) addService(prefix string, data []byte) error {
+	var name string
+	var methods [][]byte
+
+	err := walkFields(data, func(number uint64, wireType int, value []byte, _ uint64) error {
+		switch {
+		case number == 1 && wireType == wireBytes:
+			name = prefix + string(value)
+		case number == 2 && wireType == wireBytes:
+			methods = append(methods, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, data := range methods {
+		var methodName string
+		method := &protoMethod{}
+
+		err := walkFields(data, func(number uint64, wireType int, value []byte, v uint64) error {
+			switch {
+			case number == 1 && wireType == wireBytes:
+				methodName = string(value)
+			case number == 2 && wireType == wireBytes:
+				method.InputType = strings.TrimPrefix(string(value), ".")
+			case number == 3 && wireType == wireBytes:
+				method.OutputType = strings.TrimPrefix(string(value), ".")
+			case number == 5 && wireType == wireVarint:
+				method.ClientStreaming = v != 0
+			case number == 6 && wireType == wireVarint:
+				method.ServerStreaming = v != 0
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		d.methods["/"+name+"/"+methodName] = method
+	}
+
+	return nil
+}
+
+// Returns the method for a gRPC request path (`/package.Service/Method`).
+func (d *Descriptors) method(path string) *protoMethod {
+	if d == nil {
+		return nil
+	}
+
+	return d.methods[path]
+}
+
+// Calls `fn` for every field of an encoded message.  Length-delimited values
+// are passed as `value`; varint and fixed values are passed as `v`, with
+// `value` holding their raw encoding.
+func walkFields(data []byte, fn func(number uint64, wireType int, value []byte, v uint64) error) error {
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errTruncated
+		}
+		data = data[n:]
+
+		number := tag >> 3
+		wireType := int(tag & 7)
+
+		var value []byte
+		var v uint64
+
+		switch wireType {
+		case wireVarint:
+			v, n = binary.Uvarint(data)
+			if n <= 0 {
+				return errTruncated
+			}
+			value, data = data[:n], data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return errTruncated
+			}
+			v = binary.LittleEndian.Uint64(data)
+			value, data = data[:8], data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return errTruncated
+			}
+			v = uint64(binary.LittleEndian.Uint32(data))
+			value, data = data[:4], data[4:]
+		case wireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return errTruncated
+			}
+			data = data[n:]
+			value, data = data[:length], data[length:]
+		default:
+			return fmt.Errorf("protobuf: unsupported wire type %d", wireType)
+		}
+
+		if err := fn(number, wireType, value, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Appends a field tag.
+func appendTag(b []byte, number uint64, wireType int) []byte {
+	return binary.AppendUvarint(b, number<<3|uint64(wireType))
+}
+
+// Appends a length-delimited field.
+func appendBytesField(b []byte, number uint64, value []byte) []byte {
+	b = appendTag(b, number, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+// Returns the wire type a scalar field type is encoded with.
+func scalarWireType(fieldType uint64) int {
+	switch fieldType {
+	case typeDouble, typeFixed64, typeSfixed64:
+		return wireFixed64
+	case typeFloat, typeFixed32, typeSfixed32:
+		return wireFixed32
+	case typeString, typeBytes, typeMessage:
+		return wireBytes
+	default:
+		return wireVarint
+	}
+}
+
+// Appends the redacted value of a scalar field, without a tag.  Strings are
+// overwritten with RedactedStr, bytes are emptied and everything else is
+// zeroed, mirroring how JSON values are redacted.
+func appendRedactedScalar(b []byte, fieldType uint64) []byte {
+	switch scalarWireType(fieldType) {
+	case wireFixed64:
+		return binary.LittleEndian.AppendUint64(b, 0)
+	case wireFixed32:
+		return binary.LittleEndian.AppendUint32(b, 0)
+	case wireBytes:
+		if fieldType == typeString {
+			b = binary.AppendUvarint(b, uint64(len(RedactedStr)))
+			return append(b, RedactedStr...)
+		}
+		return binary.AppendUvarint(b, 0)
+	default:
+		return binary.AppendUvarint(b, 0)
+	}
+}
+
+// Returns the location of a map entry's value, keyed by its decoded key like
+// a JSON object.
+func mapEntryLocation(entry *protoMessage, data []byte, location string) string {
+	key := ""
+	keyField := entry.Fields[1]
+
+	walkFields(data, func(number uint64, wireType int, value []byte, v uint64) error {
+		if number != 1 || keyField == nil {
+			return nil
+		}
+
+		switch keyField.Type {
+		case typeString:
+			key = string(value)
+		case typeBool:
+			key = strconv.FormatBool(v != 0)
+		case typeSint32, typeSint64:
+			key = strconv.FormatInt(int64(v>>1)^-int64(v&1), 10)
+		case typeInt32, typeInt64, typeSfixed32, typeSfixed64:
+			key = strconv.FormatInt(int64(v), 10)
+		default:
+			key = strconv.FormatUint(v, 10)
+		}
+		return nil
+	})
+
+	return keyLocation(location, key)
+}
+
+// Redacts an encoded protobuf message of type `message`, whitelisting field
+// locations exactly as JSON body locations are (using field names as they
+// appear in the .proto file).  Unknown fields are dropped.
+//
+// Rule actions apply as they do to JSON, except that a dropped or nulled
+// field is omitted (leaving it at its default value), only string fields are
+// replaced or decoded, and elements of packed fields can't be omitted so they're
+// redacted instead.
+func redactProtobuf(rules []ConfigRule, d *Descriptors, message *protoMessage, data []byte, location string) ([]byte, error) {
+	if rule, ok := findLocationWhitelistMatch(rules, location, true); ok && rule.action() == ActionPass {
+		return data, nil
+	}
+
+	result := []byte{}
+	counts := map[uint64]int{}
+
+	err := walkFields(data, func(number uint64, wireType int, value []byte, v uint64) error {
+		field := message.Fields[number]
+		if field == nil {
+			return nil
+		}
+
+		fieldLocation := location + "." + field.Name
+		if field.Label == labelRepeated {
+			if rule, ok := findLocationWhitelistMatch(rules, fieldLocation, true); ok {
+				switch {
+				case rule.action() == ActionPass:
+					result = appendRawField(result, number, wireType, value)
+					return nil
+				case isOmitted(rule):
+					return nil
+				}
+			}
+		}
+
+		if field.Type == typeMessage {
+			fieldMessage := d.messages[field.TypeName]
+			if fieldMessage == nil || wireType != wireBytes {
+				return nil
+			}
+
+			elementLocation := fieldLocation
+			if fieldMessage.MapEntry {
+				elementLocation = mapEntryLocation(fieldMessage, value, fieldLocation)
+			} else if field.Label == labelRepeated {
+				elementLocation = indexLocation(fieldLocation, counts[number])
+				counts[number]++
+			}
+
+			valueField := fieldMessage.Fields[2]
+			container := !fieldMessage.MapEntry || (valueField != nil && valueField.Type == typeMessage)
+			if rule, ok := findLocationWhitelistMatch(rules, elementLocation, container); ok && isOmitted(rule) {
+				return nil
+			}
+
+			var redacted []byte
+			var err error
+			if fieldMessage.MapEntry {
+				redacted, err = redactMapEntry(rules, d, fieldMessage, value, elementLocation)
+			} else {
+				redacted, err = redactProtobuf(rules, d, fieldMessage, value, elementLocation)
+			}
+			if err != nil {
+				return err
+			}
+			result = appendBytesField(result, number, redacted)
+			return nil
+		}
+
+		// A packed repeated scalar holds many elements in one field.
+		if wireType == wireBytes && field.isPackable() {
+			packed := []byte{}
+			err := walkPacked(value, scalarWireType(field.Type), func(element []byte) {
+				elementLocation := indexLocation(fieldLocation, counts[number])
+				counts[number]++
+
+				if rule, ok := findLocationWhitelistMatch(rules, elementLocation, false); ok && rule.action() == ActionPass {
+					packed = append(packed, element...)
+				} else {
+					packed = appendRedactedScalar(packed, field.Type)
+				}
+			})
+			if err != nil {
+				return err
+			}
+			result = appendBytesField(result, number, packed)
+			return nil
+		}
+
+		elementLocation := fieldLocation
+		if field.Label == labelRepeated {
+			elementLocation = indexLocation(fieldLocation, counts[number])
+			counts[number]++
+		}
+
+		result = appendScalarField(result, rules, field, wireType, value, elementLocation)
+		return nil
+	})
+
+	return result, err
+}
+
+// Returns true iff a rule's action omits the values it matches from an
+// encoded message.
+func isOmitted(rule ConfigRule) bool {
+	return rule.action() == ActionDrop || rule.action() == ActionNull
+}
+
+// Appends a field with its original encoding.
+func appendRawField(b []byte, number uint64, wireType int, value []byte) []byte {
+	b = appendTag(b, number, wireType)
+	if wireType == wireBytes {
+		b = binary.AppendUvarint(b, uint64(len(value)))
+	}
+	return append(b, value...)
+}
+
+// Appends a scalar field at `location`, passed through, replaced, omitted or
+// redacted according to the rule that matches it.
+func appendScalarField(b []byte, rules []ConfigRule, field *protoField, wireType int, value []byte, location string) []byte {
+	rule, ok := findLocationWhitelistMatch(rules, location, false)
+	if ok {
+		switch {
+		case rule.action() == ActionPass:
+			return appendRawField(b, field.Number, wireType, value)
+		case isOmitted(rule):
+			return b
+		}
+
+		if field.Type == typeString && wireType == wireBytes && rule.action() == actionDecode {
+			if path, err := parsePath(location); err == nil {
+				if s, ok := redactEncoded(rules, rule.Decode, string(value), path).(string); ok {
+					return appendBytesField(b, field.Number, []byte(s))
+				}
+			}
+		}
+
+		if field.Type == typeString && wireType == wireBytes {
+			if replaced, ok := rule.replace(string(value)); ok {
+				if s, ok := replaced.(string); ok {
+					return appendBytesField(b, field.Number, []byte(s))
+				}
+			}
+		}
+	}
+
+	b = appendTag(b, field.Number, scalarWireType(field.Type))
+	return appendRedactedScalar(b, field.Type)
+}
+
+// Redacts a map entry, keeping its key and redacting its value at
+// `location`.  A message value is checked against the whitelist as a
+// container by redactProtobuf.
+func redactMapEntry(rules []ConfigRule, d *Descriptors, entry *protoMessage, data []byte, location string) ([]byte, error) {
+	result := []byte{}
+
+	err := walkFields(data, func(number uint64, wireType int, value []byte, v uint64) error {
+		field := entry.Fields[number]
+		if field == nil {
+			return nil
+		}
+
+		if number == 1 {
+			result = appendRawField(result, number, wireType, value)
+			return nil
+		}
+
+		if field.Type == typeMessage {
+			valueMessage := d.messages[field.TypeName]
+			if valueMessage == nil {
+				return nil
+			}
+
+			redacted, err := redactProtobuf(rules, d, valueMessage, value, location)
+			if err != nil {
+				return err
+			}
+			result = appendBytesField(result, number, redacted)
+			return nil
+		}
+
+		result = appendScalarField(result, rules, field, wireType, value, location)
+		return nil
+	})
+
+	return result, err
+}
+
+// Calls `fn` with the raw encoding of each element of a packed field.
+func walkPacked(data []byte, wireType int, fn func(element []byte)) error {
+	for len(data) > 0 {
+		var n int
+
+		switch wireType {
+		case wireFixed64:
+			n = 8
+		case wireFixed32:
+			n = 4
+		default:
+			_, n = binary.Uvarint(data)
+			if n <= 0 {
+				return errTruncated
+			}
+		}
+
+		if len(data) < n {
+			return errTruncated
+		}
+
+		fn(data[:n])
+		data = data[n:]
+	}
+
+	return nil
+}
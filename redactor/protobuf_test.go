@@ -0,0 +1,197 @@
+package redactor
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func pbConcat(fields ...[]byte) []byte {
+	result := []byte{}
+	for _, field := range fields {
+		result = append(result, field...)
+	}
+	return result
+}
+
+func pbString(number uint64, value string) []byte {
+	return appendBytesField(nil, number, []byte(value))
+}
+
+func pbVarint(number uint64, value uint64) []byte {
+	return binary.AppendUvarint(appendTag(nil, number, wireVarint), value)
+}
+
+func pbFixed64(number uint64, value uint64) []byte {
+	return binary.LittleEndian.AppendUint64(appendTag(nil, number, wireFixed64), value)
+}
+
+func pbMessage(number uint64, fields ...[]byte) []byte {
+	return appendBytesField(nil, number, pbConcat(fields...))
+}
+
+func loadTestDescriptors(t *testing.T) *Descriptors {
+	descriptors, err := LoadDescriptorSet("testdata/users.pb")
+	assert.Nil(t, err)
+	return descriptors
+}
+
+func TestParseDescriptorSet(t *testing.T) {
+	descriptors := loadTestDescriptors(t)
+
+	assert.Equal(t, &protoMethod{InputType: "test.User", OutputType: "test.User"}, descriptors.method("/test.Users/GetUser"))
+	assert.Equal(t, &protoMethod{InputType: "test.User", OutputType: "test.CreateUsersResponse", ClientStreaming: true}, descriptors.method("/test.Users/CreateUsers"))
+	assert.Nil(t, descriptors.method("/test.Users/DeleteUser"))
+
+	user := descriptors.messages["test.User"]
+	assert.Equal(t, &protoField{Name: "address", Number: 5, Label: 1, Type: typeMessage, TypeName: "test.Address"}, user.Fields[5])
+	assert.True(t, descriptors.messages["test.User.AttributesEntry"].MapEntry)
+
+	_, err := ParseDescriptorSet([]byte{0x0a, 0x05})
+	assert.NotNil(t, err)
+}
+
+func TestRedactProtobuf(t *testing.T) {
+	descriptors := loadTestDescriptors(t)
+	user := descriptors.messages["test.User"]
+
+	message := pbConcat(
+		pbString(1, "u1"),
+		pbString(2, "diggy@net.cool"),
+		pbVarint(3, 30),
+		pbString(4, "a"),
+		pbString(4, "b"),
+		pbMessage(5, pbString(1, "NYC"), pbString(2, "1 Main St")),
+		pbMessage(6, pbString(1, "plan"), pbString(2, "pro")),
+		pbMessage(6, pbString(1, "phone"), pbString(2, "555-1234")),
+		appendBytesField(nil, 7, []byte{1, 2, 3}),
+		pbVarint(8, 1),
+		pbFixed64(9, 0x4059000000000000),
+		pbString(99, "unknown"),
+	)
+
+	leafOnly := true
+
+	type testCase struct {
+		name  string
+		rules []ConfigRule
+		out   []byte
+	}
+
+	cases := []testCase{
+		{
+			name:  "with no rules",
+			rules: []ConfigRule{},
+			out: pbConcat(
+				pbString(1, "REDACTED"),
+				pbString(2, "REDACTED"),
+				pbVarint(3, 0),
+				pbString(4, "REDACTED"),
+				pbString(4, "REDACTED"),
+				pbMessage(5, pbString(1, "REDACTED"), pbString(2, "REDACTED")),
+				pbMessage(6, pbString(1, "plan"), pbString(2, "REDACTED")),
+				pbMessage(6, pbString(1, "phone"), pbString(2, "REDACTED")),
+				appendBytesField(nil, 7, []byte{0, 0, 0}),
+				pbVarint(8, 0),
+				pbFixed64(9, 0),
+			),
+		},
+		{
+			name: "with a whitelist",
+			rules: []ConfigRule{
+				ConfigRule{Whitelist: "$.id"},
+				ConfigRule{Whitelist: "$.tags[1]"},
+				ConfigRule{Whitelist: "$.address.city"},
+				ConfigRule{Whitelist: "$.attributes.plan"},
+				ConfigRule{Whitelist: "$.scores[*]"},
+			},
+			out: pbConcat(
+				pbString(1, "u1"),
+				pbString(2, "REDACTED"),
+				pbVarint(3, 0),
+				pbString(4, "REDACTED"),
+				pbString(4, "b"),
+				pbMessage(5, pbString(1, "NYC"), pbString(2, "REDACTED")),
+				pbMessage(6, pbString(1, "plan"), pbString(2, "pro")),
+				pbMessage(6, pbString(1, "phone"), pbString(2, "REDACTED")),
+				appendBytesField(nil, 7, []byte{1, 2, 3}),
+				pbVarint(8, 0),
+				pbFixed64(9, 0),
+			),
+		},
+		{
+			name: "with leaf-only whole fields whitelisted",
+			rules: []ConfigRule{
+				ConfigRule{Whitelist: "$.tags", LeafOnly: &leafOnly},
+				ConfigRule{Whitelist: "$.address", LeafOnly: &leafOnly},
+				ConfigRule{Whitelist: "$.address.city"},
+			},
+			out: pbConcat(
+				pbString(1, "REDACTED"),
+				pbString(2, "REDACTED"),
+				pbVarint(3, 0),
+				pbString(4, "REDACTED"),
+				pbString(4, "REDACTED"),
+				pbMessage(5, pbString(1, "NYC"), pbString(2, "REDACTED")),
+				pbMessage(6, pbString(1, "plan"), pbString(2, "REDACTED")),
+				pbMessage(6, pbString(1, "phone"), pbString(2, "REDACTED")),
+				appendBytesField(nil, 7, []byte{0, 0, 0}),
+				pbVarint(8, 0),
+				pbFixed64(9, 0),
+			),
+		},
+		{
+			name: "with actions",
+			rules: []ConfigRule{
+				ConfigRule{Whitelist: "$.id", Action: "fake", Format: "uuid", hashKey: testHashKey},
+				ConfigRule{Whitelist: "$.email", Action: "mask", Keep: 4},
+				ConfigRule{Whitelist: "$.age", Action: "drop"},
+				ConfigRule{Whitelist: "$.tags", Action: "null"},
+				ConfigRule{Whitelist: "$.address", Action: "drop"},
+				ConfigRule{Whitelist: "$.attributes.phone", Action: "drop"},
+				ConfigRule{Whitelist: "$.attributes.plan", Action: "literal", Value: "free"},
+			},
+			out: pbConcat(
+				pbString(1, fake(testHashKey, "u1", "uuid")),
+				pbString(2, "**********cool"),
+				pbMessage(6, pbString(1, "plan"), pbString(2, "free")),
+				appendBytesField(nil, 7, []byte{0, 0, 0}),
+				pbVarint(8, 0),
+				pbFixed64(9, 0),
+			),
+		},
+		{
+			name: "with whole fields whitelisted",
+			rules: []ConfigRule{
+				ConfigRule{Whitelist: "$.tags"},
+				ConfigRule{Whitelist: "$.address"},
+			},
+			out: pbConcat(
+				pbString(1, "REDACTED"),
+				pbString(2, "REDACTED"),
+				pbVarint(3, 0),
+				pbString(4, "a"),
+				pbString(4, "b"),
+				pbMessage(5, pbString(1, "NYC"), pbString(2, "1 Main St")),
+				pbMessage(6, pbString(1, "plan"), pbString(2, "REDACTED")),
+				pbMessage(6, pbString(1, "phone"), pbString(2, "REDACTED")),
+				appendBytesField(nil, 7, []byte{0, 0, 0}),
+				pbVarint(8, 0),
+				pbFixed64(9, 0),
+			),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result, err := redactProtobuf(c.rules, descriptors, user, message, "$")
+			assert.Nil(t, err)
+			assert.Equal(t, c.out, result)
+		})
+	}
+
+	t.Log("Running with a truncated message")
+	_, err := redactProtobuf(nil, descriptors, user, message[:len(message)-2], "$")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,291 @@
+package redactor
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Policies for querystring values that aren't whitelisted.  QueryRedact is
+// the default.
+const (
+	QueryRedact = "redact"
+	QueryDrop   = "drop"
+	QueryHash   = "hash"
+)
+
+// Compiled value patterns and key globs, keyed by expression.
+var patternCache sync.Map
+
+// Parses a regular expression, caching the result so each is only parsed
+// once.
+func compilePattern(expr string) (*regexp.Regexp, error) {
+	if cached, ok := patternCache.Load(expr); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	patternCache.Store(expr, pattern)
+	return pattern, nil
+}
+
+// Returns the regular expression equivalent to a glob, where `*` matches any
+// run of characters and `?` any single character.
+func globToPattern(glob string) string {
+	pattern := regexp.QuoteMeta(glob)
+	pattern = strings.Replace(pattern, `\*`, `.*`, -1)
+	pattern = strings.Replace(pattern, `\?`, `.`, -1)
+	return "^" + pattern + "$"
+}
+
+// Returns true iff a querystring key matches a glob.
+func globMatch(glob string, key string) bool {
+	pattern, err := compilePattern(globToPattern(glob))
+	return err == nil && pattern.MatchString(key)
+}
+
+// Returns true iff a rule's value pattern (if any) matches a value.  Only
+// strings can match a pattern.
+func (r ConfigRule) matchesValue(value interface{}, hasValue bool) bool {
+	if r.Pattern == "" {
+		return true
+	}
+
+	s, ok := value.(string)
+	if !hasValue || !ok {
+		return false
+	}
+
+	pattern, err := compilePattern(r.Pattern)
+	return err == nil && pattern.MatchString(s)
+}
+
+// Returns true iff a querystring rule is a location rather than a key glob.
+func isQueryLocation(whitelist string) bool {
+	return strings.HasPrefix(whitelist, "$")
+}
+
+// Returns the path to the `index`th of `count` values of a querystring key,
+// nesting bracketed keys as in `filter[user][id]` (`$.filter.user.id`).  An
+// empty or numeric bracket is an Array index, so `items[]` is `$.items[n]` for
+// the nth value.  A key that isn't well-formed is a single step.
+func queryKeyPath(key string, index int, count int, value string) []pathStep {
+	path := []pathStep{}
+
+	open := strings.IndexByte(key, '[')
+	if open <= 0 || !strings.HasSuffix(key, "]") {
+		path = append(path, pathStep{key: key})
+	} else {
+		path = append(path, pathStep{key: key[:open]})
+
+		for _, part := range strings.Split(key[open+1:len(key)-1], "][") {
+			if strings.ContainsAny(part, "[]") {
+				return []pathStep{{key: key, value: value, hasValue: true}}
+			}
+
+			if part == "" {
+				path = append(path, pathStep{index: index, isIndex: true, length: count})
+			} else if n, err := strconv.Atoi(part); err == nil && n >= 0 {
+				path = append(path, pathStep{index: n, isIndex: true, length: -1})
+			} else {
+				path = append(path, pathStep{key: part})
+			}
+		}
+	}
+
+	last := &path[len(path)-1]
+	last.value = value
+	last.hasValue = true
+
+	return path
+}
+
+// Returns the first querystring rule matching the `index`th of `count`
+// values of a key.  A rule is either a location, matched against the key's
+// path (see queryKeyPath), or a glob matched against the raw key.  A location
+// matching a parent of the path (e.g. `$.filter` for `filter[user][id]`) also
+// matches, unless the rule is leaf-only.
+func findQueryWhitelistMatch(rules []ConfigRule, key string, index int, count int, value string) (ConfigRule, bool) {
+	var path []pathStep
+
+	for _, rule := range rules {
+		if !rule.matchesValue(value, true) {
+			continue
+		}
+
+		if !isQueryLocation(rule.Whitelist) {
+			if globMatch(rule.Whitelist, key) {
+				return rule, true
+			}
+			continue
+		}
+
+		if path == nil {
+			path = queryKeyPath(key, index, count, value)
+		}
+
+		pattern, err := compileLocation(rule.Whitelist)
+		if err != nil {
+			continue
+		}
+
+		if pattern.match(path) {
+			return rule, true
+		}
+
+		if rule.IsLeafOnly() {
+			continue
+		}
+
+		for n := 0; n < len(path); n++ {
+			if pattern.match(path[:n]) {
+				return rule, true
+			}
+		}
+	}
+
+	return ConfigRule{}, false
+}
+
+// Redacts the `index`th of `count` values of a querystring key, applying the
+// match's policy if it isn't whitelisted.  Returns false if the value should be
+// dropped.  Values replaced by a rule's action are formatted as querystring
+// values, with null as empty.
+func redactQueryValue(match HTTPMatch, key string, index int, count int, value string) (string, bool) {
+	rule, ok := findQueryWhitelistMatch(match.Querystring, key, index, count, value)
+	if !ok {
+		switch match.QuerystringPolicy {
+		case QueryDrop:
+			return "", false
+		case QueryHash:
+			return hashValue(match.hashKey, value), true
+		default:
+			return RedactedStr, true
+		}
+	}
+
+	switch rule.action() {
+	case ActionPass:
+		return value, true
+	case ActionDrop:
+		return "", false
+	}
+
+	replaced, ok := rule.replace(value)
+	if !ok {
+		return RedactedStr, true
+	}
+
+	if replaced == nil {
+		return "", true
+	}
+
+	return fmt.Sprint(replaced), true
+}
+
+// RedactQuerystring redacts values from the querystring unless they're
+// whitelisted by the config.  Values that aren't are redacted, dropped or
+// hashed according to the match's `querystring_policy`.  Parameters keep
+// their order, and those passed through keep their original encoding.
+// Parameters that can't be decoded are dropped.
+//
+// Returns a string that can be assigned to any url.URL's RawQuery property.
+func RedactQuerystring(match HTTPMatch, u *url.URL) string {
+	type param struct {
+		rawKey, rawValue string
+		key, value       string
+		hasValue         bool
+	}
+
+	params := []param{}
+	counts := map[string]int{}
+
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+
+		p := param{rawKey: pair}
+		if i := strings.IndexByte(pair, '='); i >= 0 {
+			p.rawKey, p.rawValue, p.hasValue = pair[:i], pair[i+1:], true
+		}
+
+		var err1, err2 error
+		p.key, err1 = url.QueryUnescape(p.rawKey)
+		p.value, err2 = url.QueryUnescape(p.rawValue)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+
+		params = append(params, p)
+		counts[p.key]++
+	}
+
+	result := []string{}
+	indexes := map[string]int{}
+
+	for _, p := range params {
+		index := indexes[p.key]
+		indexes[p.key]++
+
+		value, ok := redactQueryValue(match, p.key, index, counts[p.key], p.value)
+		switch {
+		case !ok:
+			continue
+		case value == p.value && p.hasValue:
+			result = append(result, p.rawKey+"="+p.rawValue)
+		case value == p.value:
+			result = append(result, p.rawKey)
+		default:
+			result = append(result, p.rawKey+"="+url.QueryEscape(value))
+		}
+	}
+
+	return strings.Join(result, "&")
+}
+
+// Returns the hex HMAC-SHA256 of a value keyed with the config's hash key,
+// for QueryHash and PathHash.
+func hashValue(key []byte, value string) string {
+	return hex.EncodeToString(keyedHash(key, value))
+}
+
+// Returns an error if the querystring policy is unknown, or any of the
+// querystring rules has an invalid location, pattern or action.
+func validateQueryRules(policy string, rules []ConfigRule) error {
+	switch policy {
+	case "", QueryRedact, QueryDrop, QueryHash:
+	default:
+		return fmt.Errorf("unknown querystring policy %q", policy)
+	}
+
+	for _, rule := range rules {
+		if isQueryLocation(rule.Whitelist) {
+			if _, err := compileLocation(rule.Whitelist); err != nil {
+				return fmt.Errorf("invalid querystring whitelist %q: %v", rule.Whitelist, err)
+			}
+		}
+
+		if _, err := compilePattern(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid querystring whitelist %q: %v", rule.Whitelist, err)
+		}
+
+		if err := rule.validateAction(); err != nil {
+			return fmt.Errorf("invalid querystring whitelist %q: %v", rule.Whitelist, err)
+		}
+
+		if err := rule.validateStringAction(); err != nil {
+			return fmt.Errorf("invalid querystring whitelist %q: %v", rule.Whitelist, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package redactor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGlobMatch(t *testing.T) {
+	type testCase struct {
+		glob string
+		key  string
+		out  bool
+	}
+
+	cases := []testCase{
+		{glob: "a", key: "a", out: true},
+		{glob: "a", key: "ab", out: false},
+		{glob: "utm_*", key: "utm_source", out: true},
+		{glob: "utm_*", key: "xutm_source", out: false},
+		{glob: "page?", key: "page2", out: true},
+		{glob: "filter[id]", key: "filter[id]", out: true},
+		{glob: "filter[id]", key: "filteri", out: false},
+		{glob: "a.b", key: "axb", out: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.glob+" "+c.key, func(t *testing.T) {
+			assert.Equal(t, c.out, globMatch(c.glob, c.key))
+		})
+	}
+}
+
+func TestQueryKeyPath(t *testing.T) {
+	type testCase struct {
+		name string
+		key  string
+		out  []pathStep
+	}
+
+	cases := []testCase{
+		{
+			name: "with a plain key",
+			key:  "page",
+			out:  []pathStep{{key: "page", value: "v", hasValue: true}},
+		},
+		{
+			name: "with nested keys",
+			key:  "filter[user][id]",
+			out:  []pathStep{{key: "filter"}, {key: "user"}, {key: "id", value: "v", hasValue: true}},
+		},
+		{
+			name: "with an empty bracket",
+			key:  "items[]",
+			out:  []pathStep{{key: "items"}, {index: 1, isIndex: true, length: 3, value: "v", hasValue: true}},
+		},
+		{
+			name: "with an index",
+			key:  "items[4][id]",
+			out:  []pathStep{{key: "items"}, {index: 4, isIndex: true, length: -1}, {key: "id", value: "v", hasValue: true}},
+		},
+		{
+			name: "with a malformed key",
+			key:  "items[a",
+			out:  []pathStep{{key: "items[a", value: "v", hasValue: true}},
+		},
+		{
+			name: "with nested brackets",
+			key:  "a[b[c]]",
+			out:  []pathStep{{key: "a[b[c]]", value: "v", hasValue: true}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.out, queryKeyPath(c.key, 1, 3, "v"))
+		})
+	}
+}
+
+func TestFindQueryWhitelistMatch(t *testing.T) {
+	leafOnly := true
+
+	type testCase struct {
+		name  string
+		rules []ConfigRule
+		key   string
+		value string
+		out   bool
+	}
+
+	cases := []testCase{
+		{name: "with a key", rules: []ConfigRule{{Whitelist: "a"}}, key: "a", value: "1", out: true},
+		{name: "with a location", rules: []ConfigRule{{Whitelist: "$.a"}}, key: "a", value: "1", out: true},
+		{name: "with a wildcard location", rules: []ConfigRule{{Whitelist: "$.filter.*"}}, key: "filter[id]", value: "1", out: true},
+		{name: "with a parent location", rules: []ConfigRule{{Whitelist: "$.filter"}}, key: "filter[id]", value: "1", out: true},
+		{name: "with a leaf-only parent location", rules: []ConfigRule{{Whitelist: "$.filter", LeafOnly: &leafOnly}}, key: "filter[id]", value: "1", out: false},
+		{name: "with a pattern that matches", rules: []ConfigRule{{Whitelist: "a", Pattern: "^[0-9]$"}}, key: "a", value: "1", out: true},
+		{name: "with a pattern that doesn't match", rules: []ConfigRule{{Whitelist: "a", Pattern: "^[0-9]$"}}, key: "a", value: "x", out: false},
+		{name: "with a different key", rules: []ConfigRule{{Whitelist: "$.a"}}, key: "b", value: "1", out: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, ok := findQueryWhitelistMatch(c.rules, c.key, 0, 1, c.value)
+			assert.Equal(t, c.out, ok)
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package redactor
+
+// QueueMatch returns the first queue match clause for the topic.
+func (r *Redactor) QueueMatch(topic string) QueueMatch {
+	return r.config.FindQueueMatch(topic)
+}
+
+// Message redacts a message payload consumed from `topic`.  See MapMessage.
+func (r *Redactor) Message(topic string, contentType string, payload []byte) ([]byte, error) {
+	return MapMessage(r.QueueMatch(topic), contentType, payload)
+}
+
+// MapMessage maps a message payload to a redacted version using the body
+// rules of a queue match clause, exactly as MapBody does for requests.  If
+// `contentType` is empty, the match's content-type (or JSON) is assumed.
+func MapMessage(match QueueMatch, contentType string, payload []byte) ([]byte, error) {
+	if contentType == "" {
+		contentType = match.ContentType
+	}
+
+	if contentType == "" {
+		contentType = JSON
+	}
+
+	return mapDocument(match.Body, match.contentTypes, contentType, payload)
+}
+
+// RedactMessageHeaders redacts the values of any message headers that aren't
+// whitelisted by a `rule "header"`.  Unlike HTTP headers, nothing is needed
+// to transport a message, so headers are always redacted by default.
+//
+// Returns a redacted copy of `headers`, does not mutate.
+func RedactMessageHeaders(match QueueMatch, headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+
+	result := map[string]string{}
+
+	for name, value := range headers {
+		if match.HasHeaderWhitelistMatch(name) {
+			result[name] = value
+		} else {
+			result[name] = RedactedStr
+		}
+	}
+
+	return result
+}
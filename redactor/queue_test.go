@@ -0,0 +1,77 @@
+package redactor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapMessage(t *testing.T) {
+	type testCase struct {
+		name        string
+		match       QueueMatch
+		contentType string
+		payload     string
+		out         string
+	}
+
+	cases := []testCase{
+		{
+			name:    "with no content-type",
+			match:   QueueMatch{RuleOptions: RuleOptions{Body: []ConfigRule{ConfigRule{Whitelist: "$.a"}}}},
+			payload: `{"a": 1, "b": 2}`,
+			out:     `{"a":1,"b":0}`,
+		},
+		{
+			name:        "with an unsupported content-type",
+			match:       QueueMatch{},
+			contentType: "text/plain",
+			payload:     "hello",
+			out:         "",
+		},
+		{
+			name:    "with an unsupported content-type from the match",
+			match:   QueueMatch{ContentType: "text/plain"},
+			payload: "hello",
+			out:     "",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result, err := MapMessage(c.match, c.contentType, []byte(c.payload))
+			assert.Nil(t, err)
+			assert.Equal(t, c.out, string(result))
+		})
+	}
+}
+
+func TestRedactMessageHeaders(t *testing.T) {
+	match := QueueMatch{RuleOptions: RuleOptions{Header: []ConfigRule{ConfigRule{Whitelist: "trace-id"}}}}
+	headers := map[string]string{"trace-id": "abc", "user-email": "diggy@net.cool"}
+
+	result := RedactMessageHeaders(match, headers)
+	assert.Equal(t, map[string]string{"trace-id": "abc", "user-email": "REDACTED"}, result)
+	assert.Nil(t, RedactMessageHeaders(match, nil))
+}
+
+func TestRedactorMessage(t *testing.T) {
+	config := Config{Match: MatchOptions{Queue: []QueueMatch{
+		QueueMatch{Topic: "events.*", RuleOptions: RuleOptions{Body: []ConfigRule{ConfigRule{Whitelist: "$.id"}}}},
+	}}}
+
+	redactor, err := Compile(config)
+	assert.Nil(t, err)
+
+	result, err := redactor.Message("events.click", "", []byte(`{"id": 1, "email": "diggy@net.cool"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"email":"REDACTED","id":1}`, string(result))
+
+	result, err = redactor.Message("users", "", []byte(`{"id": 1}`))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"id":0}`, string(result))
+
+	config.Match.Queue[0].Topic = "events.["
+	_, err = Compile(config)
+	assert.NotNil(t, err)
+}
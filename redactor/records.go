@@ -0,0 +1,143 @@
+package redactor
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+)
+
+// The record separator that starts each record of a JSON text sequence
+// (RFC 7464).
+const recordSeparator = 0x1e
+
+// RedactRecords redacts a stream of JSON records of the given content-type
+// (NDJSON or JSONSeq, or a type mapped to their handlers) from `in`, writing
+// each redacted record to `out` as soon as it's read.  Each record is
+// redacted independently against the body rules of `match`, rooted at `$` as
+// though it were a whole document.  RedactRequest and RedactResponse stream
+// uncompressed UTF-8 record bodies the same way.
+//
+// If a record can't be parsed, an error naming it is returned and the output
+// holds only the records before it.
+func RedactRecords(match HTTPMatch, contentType string, in io.Reader, out io.Writer) error {
+	mediaType, _ := parseMediaType(contentType)
+	return redactRecords(match.Body, contentHandler(match.contentTypes, mediaType), in, out)
+}
+
+// Returns a reader of a request or response body whose records are redacted
+// against `rules` as they're read, if the body's type has a record handler
+// and it's in UTF-8 and uncompressed; otherwise returns false, and the body
+// is redacted whole.  Its Content-Length is removed, as it's no longer known.
+// If a record can't be parsed, the reader fails with an error naming it.
+// The original body is closed once it's read, or the reader is closed.
+func streamRecords(match HTTPMatch, rules []ConfigRule, header http.Header, body io.ReadCloser) (io.ReadCloser, bool) {
+	mediaType, params := parseMediaType(header.Get("Content-Type"))
+
+	handler := contentHandler(match.contentTypes, mediaType)
+	if handler != HandlerNDJSON && handler != HandlerJSONSeq {
+		return nil, false
+	}
+
+	if codings, err := parseContentEncoding(header); err != nil || len(codings) > 0 || isForeignCharset(params["charset"]) {
+		return nil, false
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		defer body.Close()
+
+		err := redactRecords(rules, handler, body, writer)
+		if err != nil && err != io.ErrClosedPipe {
+			log.Println(err)
+		}
+		writer.CloseWithError(err)
+	}()
+
+	header.Del("Content-Length")
+	return reader, true
+}
+
+// Redacts a stream of records with `handler` against a list of location
+// whitelist rules.  See RedactRecords.
+func redactRecords(rules []ConfigRule, handler string, in io.Reader, out io.Writer) error {
+	switch handler {
+	case HandlerNDJSON:
+		return redactLines(rules, in, out)
+	case HandlerJSONSeq:
+		return redactSequence(rules, in, out)
+	}
+
+	return fmt.Errorf("unsupported record handler %q", handler)
+}
+
+// Redacts newline-delimited JSON, one record per line.  Blank lines and a
+// missing newline after the last record are kept, so the output has the
+// same lines as the input.
+func redactLines(rules []ConfigRule, in io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(in)
+
+	for number := 1; ; number++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if len(line) == 0 {
+			return nil
+		}
+
+		newline := bytes.HasSuffix(line, []byte("\n"))
+		record := bytes.TrimRight(line, "\r\n")
+
+		if len(bytes.TrimSpace(record)) > 0 {
+			redacted, err := redactJSON(rules, record)
+			if err != nil {
+				return fmt.Errorf("line %d: %v", number, err)
+			}
+			record = redacted
+		}
+
+		if newline {
+			record = append(record, '\n')
+		}
+
+		if _, err := out.Write(record); err != nil {
+			return err
+		}
+	}
+}
+
+// Redacts a JSON text sequence, in which each record is preceded by a record
+// separator and followed by a newline.  Empty records are skipped.
+func redactSequence(rules []ConfigRule, in io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(in)
+
+	for number := 0; ; {
+		chunk, err := reader.ReadBytes(recordSeparator)
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		record := bytes.TrimSpace(bytes.TrimSuffix(chunk, []byte{recordSeparator}))
+		if len(record) > 0 {
+			number++
+
+			redacted, err := redactJSON(rules, record)
+			if err != nil {
+				return fmt.Errorf("record %d: %v", number, err)
+			}
+
+			record = append(append([]byte{recordSeparator}, redacted...), '\n')
+			if _, err := out.Write(record); err != nil {
+				return err
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
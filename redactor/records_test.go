@@ -0,0 +1,191 @@
+package redactor
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactRecords(t *testing.T) {
+	match := HTTPMatch{RuleOptions: RuleOptions{Body: []ConfigRule{
+		ConfigRule{Whitelist: "$.event"},
+		ConfigRule{Whitelist: "$.user.id"},
+	}}}
+
+	type testCase struct {
+		name        string
+		contentType string
+		in          string
+		out         string
+		valid       bool
+	}
+
+	cases := []testCase{
+		{
+			name:        "with ndjson",
+			contentType: "application/x-ndjson",
+			in:          "{\"event\": \"click\", \"ip\": \"10.0.0.1\"}\n{\"event\": \"view\", \"user\": {\"id\": 7, \"email\": \"diggy@net.cool\"}}\n",
+			out:         "{\"event\":\"click\",\"ip\":\"REDACTED\"}\n{\"event\":\"view\",\"user\":{\"email\":\"REDACTED\",\"id\":7}}\n",
+			valid:       true,
+		},
+		{
+			name:        "with blank lines and no trailing newline",
+			contentType: "application/x-ndjson",
+			in:          "{\"event\": \"click\"}\r\n\n[\"diggy@net.cool\"]",
+			out:         "{\"event\":\"click\"}\n\n[\"REDACTED\"]",
+			valid:       true,
+		},
+		{
+			name:        "with an empty ndjson body",
+			contentType: "application/x-ndjson",
+			in:          "",
+			out:         "",
+			valid:       true,
+		},
+		{
+			name:        "with an invalid ndjson record",
+			contentType: "application/x-ndjson",
+			in:          "{\"event\": \"click\"}\n{\"event\":\n",
+		},
+		{
+			name:        "with a json text sequence",
+			contentType: "application/json-seq",
+			in:          "\x1e{\"event\": \"click\", \"ip\": \"10.0.0.1\"}\n\x1e\x1e{\"event\": \"view\"}\n",
+			out:         "\x1e{\"event\":\"click\",\"ip\":\"REDACTED\"}\n\x1e{\"event\":\"view\"}\n",
+			valid:       true,
+		},
+		{
+			name:        "with an invalid sequence record",
+			contentType: "application/json-seq",
+			in:          "\x1e{\"event\": \"click\"}\n\x1e{\"event\":\n",
+		},
+		{
+			name:        "with an unsupported content-type",
+			contentType: "application/json",
+			in:          "{}",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := RedactRecords(match, c.contentType, strings.NewReader(c.in), &out)
+			assert.Equal(t, c.valid, err == nil)
+			if c.valid {
+				assert.Equal(t, c.out, out.String())
+			}
+		})
+	}
+}
+
+func TestMapBodyWithRecords(t *testing.T) {
+	match := HTTPMatch{RuleOptions: RuleOptions{Body: []ConfigRule{ConfigRule{Whitelist: "$.event"}}}}
+
+	body, err := MapBody(match, "application/x-ndjson", []byte("{\"event\": \"click\", \"ip\": \"10.0.0.1\"}\n{\"event\": \"view\"}\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"event\":\"click\",\"ip\":\"REDACTED\"}\n{\"event\":\"view\"}\n", string(body))
+
+	body, err = MapBody(match, "application/json-seq", []byte("\x1e{\"event\": \"click\"}\n\x1e{\"event\":"))
+	assert.NotNil(t, err)
+	assert.Equal(t, []byte{}, body)
+}
+
+func TestRedactBodyWithRecords(t *testing.T) {
+	match := HTTPMatch{RuleOptions: RuleOptions{Body: []ConfigRule{ConfigRule{Whitelist: "$.event"}}}}
+
+	type testCase struct {
+		name        string
+		contentType string
+		encoding    string
+		body        string
+		out         string
+		streamed    bool
+		valid       bool
+	}
+
+	cases := []testCase{
+		{
+			name:        "with ndjson",
+			contentType: "application/x-ndjson",
+			body:        "{\"event\": \"click\", \"ip\": \"10.0.0.1\"}\n{\"event\": \"view\"}\n",
+			out:         "{\"event\":\"click\",\"ip\":\"REDACTED\"}\n{\"event\":\"view\"}\n",
+			streamed:    true,
+			valid:       true,
+		},
+		{
+			name:        "with an invalid record",
+			contentType: "application/json-seq",
+			body:        "\x1e{\"event\": \"click\"}\n\x1e{\"event\":",
+			out:         "\x1e{\"event\":\"click\"}\n",
+			streamed:    true,
+		},
+		{
+			name:        "with gzip",
+			contentType: "application/x-ndjson",
+			encoding:    "gzip",
+			body:        "{\"event\": \"click\", \"ip\": \"10.0.0.1\"}\n",
+			out:         "{\"event\":\"click\",\"ip\":\"REDACTED\"}\n",
+			valid:       true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			request := makeRequest(c.body, c.contentType)
+			if c.encoding != "" {
+				request = makeRequest(string(compressString(t, c.encoding, false, c.body)), c.contentType)
+				request.Header.Set("Content-Encoding", c.encoding)
+			}
+
+			err := redactBody(match, request)
+			assert.Nil(t, err)
+			assert.Nil(t, request.GetBody)
+
+			body, err := ioutil.ReadAll(request.Body)
+			assert.Equal(t, c.valid, err == nil)
+			if c.encoding != "" {
+				codings, err := parseContentEncoding(request.Header)
+				assert.Nil(t, err)
+				body, err = decompressBody(codings, body, 1024)
+				assert.Nil(t, err)
+			}
+			assert.Equal(t, c.out, string(body))
+
+			if c.streamed {
+				assert.Equal(t, int64(-1), request.ContentLength)
+				assert.Equal(t, "", request.Header.Get("Content-Length"))
+			} else {
+				assert.NotEqual(t, int64(-1), request.ContentLength)
+			}
+		})
+	}
+}
+
+func TestRedactResponseStreamsRecords(t *testing.T) {
+	match := HTTPMatch{RedactResponse: true, RuleOptions: RuleOptions{Response: []ConfigRule{ConfigRule{Whitelist: "$.event"}}}}
+
+	in, upstream := io.Pipe()
+	resp := &http.Response{
+		Header: http.Header{"Content-Type": {"application/x-ndjson"}, "Content-Length": {"100"}},
+		Body:   in,
+	}
+
+	err := RedactResponse(match, resp)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	// The first record is readable before the upstream has sent the rest.
+	go upstream.Write([]byte("{\"event\": \"click\", \"ip\": \"10.0.0.1\"}\n"))
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"event\":\"click\",\"ip\":\"REDACTED\"}\n", line)
+	assert.Equal(t, "", resp.Header.Get("Content-Length"))
+	upstream.Close()
+}
@@ -0,0 +1,516 @@
+// Package redactor is the core of Privacy Proxy.  It redacts all data from
+// request bodies, querystrings and headers while preserving the shape of the
+// data, except for values whitelisted by the `match` clauses of a config.
+//
+// The redactor knows nothing about how requests arrive; hosts such as the
+// reverse proxy compile a Config once and then ask the resulting Redactor to
+// redact each request's parts given its method and path.
+package redactor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// What we redact a value, we overwrite it with these, depending on type.
+const (
+	RedactedStr    = "REDACTED"
+	RedactedNumber = 0.0
+	RedactedBool   = false
+)
+
+// Supported content types
+const (
+	JSON    = "application/json"
+	NDJSON  = "application/x-ndjson"
+	JSONSeq = "application/json-seq"
+	CSV     = "text/csv"
+	TSV     = "text/tab-separated-values"
+)
+
+// Headers describing the (already redacted) body, which are always passed
+// through by RedactHeader.
+var bodyHeaders = []string{"Content-Type", "Content-Length"}
+
+// Returns true iff two strings are equivalent regardless of trailing slashes
+func isSamePath(a string, b string) bool {
+	return strings.TrimRight(a, "/") == strings.TrimRight(b, "/")
+}
+
+// Returns true iff two strings are equal regardless of case
+func isSameCaseInsensitive(a string, b string) bool {
+	return strings.ToLower(a) == strings.ToLower(b)
+}
+
+// Redactor redacts the parts of a request according to a compiled config.
+// A Redactor is safe for concurrent use.
+type Redactor struct {
+	config      Config
+	descriptors *Descriptors
+}
+
+// Compile validates a config and prepares it for redacting.  An error is
+// returned if any whitelist location can't be parsed or has an invalid
+// action, or if the config's vault, keyring, JWT keys or hash key can't be
+// opened.  Rules that don't set `leaf_only` take the config's default, and
+// each match clause inherits the config's `content_types` handlers.
+func Compile(config Config) (*Redactor, error) {
+	secrets := ruleSecrets{}
+
+	if config.Vault != nil {
+		var err error
+		secrets.vault, err = OpenVault(*config.Vault)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.Keyring != "" {
+		var err error
+		secrets.keyring, err = LoadKeyring(config.Keyring)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.JWT != nil {
+		var err error
+		secrets.jwtKeys, err = LoadJWTKeys(*config.JWT)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.HashKey != "" {
+		var err error
+		secrets.hashKey, err = LoadHashKey(config.HashKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return compile(config, secrets)
+}
+
+// Validate checks a config as Compile does, except that its vault, keyring,
+// JWT keys and hash key aren't opened: rules are checked as though each was
+// configured.  It's for checking configs that will be compiled elsewhere,
+// with other secrets, as a control plane does.
+func Validate(config Config) error {
+	_, err := compile(config, ruleSecrets{
+		vault:   placeholderVault{},
+		keyring: &Keyring{},
+		jwtKeys: &JWTKeys{signing: []byte{}},
+		hashKey: []byte{},
+	})
+	return err
+}
+
+// The secrets that Compile attaches to rules.
+type ruleSecrets struct {
+	vault   Vault
+	keyring *Keyring
+	jwtKeys *JWTKeys
+	hashKey []byte
+}
+
+// A vault standing in for a real one while a config is validated.
+type placeholderVault struct{}
+
+func (placeholderVault) Tokenize(value string) (string, error) {
+	return "", fmt.Errorf("vault: placeholder vault can't tokenize")
+}
+
+func (placeholderVault) Detokenize(token string) (string, error) {
+	return "", fmt.Errorf("vault: placeholder vault can't detokenize")
+}
+
+// Compiles a config with `secrets` attached to its rules.  See Compile.
+func compile(config Config, secrets ruleSecrets) (*Redactor, error) {
+	leafOnly := config.LeafOnly
+	config.Match = config.Match.mapRules(func(rule ConfigRule) ConfigRule {
+		if rule.LeafOnly == nil && leafOnly {
+			rule.LeafOnly = &leafOnly
+		}
+		rule.vault = secrets.vault
+		rule.keyring = secrets.keyring
+		rule.jwtKeys = secrets.jwtKeys
+		rule.hashKey = secrets.hashKey
+		return rule
+	})
+
+	if err := validateContentTypes(config.ContentTypes); err != nil {
+		return nil, err
+	}
+
+	contentTypes := normalizeContentTypes(config.ContentTypes)
+
+	for i := range config.Match.HTTP {
+		config.Match.HTTP[i].contentTypes = contentTypes
+		config.Match.HTTP[i].hashKey = secrets.hashKey
+	}
+
+	for i := range config.Match.Queue {
+		config.Match.Queue[i].contentTypes = contentTypes
+	}
+
+	for _, match := range config.Match.HTTP {
+		for _, rules := range [][]ConfigRule{match.Body, match.Response} {
+			if err := validateRules(rules); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := validateQueryRules(match.QuerystringPolicy, match.Querystring); err != nil {
+			return nil, err
+		}
+
+		if match.QuerystringPolicy == QueryHash && match.hashKey == nil {
+			return nil, fmt.Errorf("querystring policy %q needs a hash_key", QueryHash)
+		}
+
+		if err := validatePathRules(match.Path, match.PathPolicy, match.PathRules); err != nil {
+			return nil, err
+		}
+
+		if match.PathPolicy == PathHash && match.hashKey == nil {
+			return nil, fmt.Errorf("path policy %q needs a hash_key", PathHash)
+		}
+
+		if err := validateCookieRules(match.Cookie); err != nil {
+			return nil, err
+		}
+
+		if err := validateHeaderRules(match.Header); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, match := range config.Match.Queue {
+		if _, err := path.Match(match.Topic, ""); err != nil {
+			return nil, fmt.Errorf("invalid topic %q: %v", match.Topic, err)
+		}
+
+		if err := validateRules(match.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, match := range config.Match.GRPC {
+		for _, rules := range [][]ConfigRule{match.Body, match.Response} {
+			if err := validateRules(rules); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := validateHeaderRules(match.Header); err != nil {
+			return nil, err
+		}
+	}
+
+	descriptors := newDescriptors()
+	for _, file := range config.GRPCDescriptorSets {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		err = descriptors.add(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid descriptor set %q: %v", file, err)
+		}
+	}
+
+	return &Redactor{config: config, descriptors: descriptors}, nil
+}
+
+// Returns an error if any of the location whitelist rules can't be parsed, or
+// has an invalid pattern or action.
+func validateRules(rules []ConfigRule) error {
+	for _, rule := range rules {
+		if _, err := compileLocation(rule.Whitelist); err != nil {
+			return fmt.Errorf("invalid whitelist %q: %v", rule.Whitelist, err)
+		}
+
+		if _, err := compilePattern(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid whitelist %q: %v", rule.Whitelist, err)
+		}
+
+		if err := rule.validateAction(); err != nil {
+			return fmt.Errorf("invalid whitelist %q: %v", rule.Whitelist, err)
+		}
+	}
+
+	return nil
+}
+
+// MustCompile is like Compile but panics if the config is invalid.
+func MustCompile(config Config) *Redactor {
+	redactor, err := Compile(config)
+	if err != nil {
+		panic(err)
+	}
+
+	return redactor
+}
+
+// Config returns the config the Redactor was compiled from.
+func (r *Redactor) Config() Config {
+	return r.config
+}
+
+// Match returns the first http match clause for the method and escaped
+// pathname.  See FindHTTPMatch.
+func (r *Redactor) Match(method string, pathname string) HTTPMatch {
+	return r.config.FindHTTPMatch(method, pathname)
+}
+
+// Body redacts a request body of the given content-type.  See MapBody.
+func (r *Redactor) Body(method string, pathname string, contentType string, body []byte) ([]byte, error) {
+	return MapBody(r.Match(method, pathname), contentType, body)
+}
+
+// Querystring redacts a raw querystring.  See RedactQuerystring.
+func (r *Redactor) Querystring(method string, pathname string, rawQuery string) string {
+	return RedactQuerystring(r.Match(method, pathname), &url.URL{RawQuery: rawQuery})
+}
+
+// Path redacts the named segments of an escaped pathname, returning it
+// escaped.  See RedactPath.
+func (r *Redactor) Path(method string, pathname string) string {
+	u := &url.URL{Path: unescapePath(pathname), RawPath: pathname}
+	return RedactPath(r.Match(method, pathname), u).EscapedPath()
+}
+
+// Header redacts a set of request headers.  See RedactHeader.
+func (r *Redactor) Header(method string, pathname string, header http.Header) http.Header {
+	return RedactHeader(r.Match(method, pathname), header)
+}
+
+// Redact redacts any non-whitelisted key locations from `value`.  If a key is
+// whitelisted, the entire value of that key is passed through.
+//
+// Returns a redacted copy of `value`, does not mutate.
+func Redact(match HTTPMatch, value interface{}, locationPrefix string) interface{} {
+	return redact(match.Body, value, locationPrefix)
+}
+
+// Redacts `value` against a list of location whitelist rules.  See Redact.
+// A prefix that isn't a valid location matches no rules.
+func redact(rules []ConfigRule, value interface{}, locationPrefix string) interface{} {
+	path, err := parsePath(locationPrefix)
+	if err != nil {
+		path, rules = nil, nil
+	}
+
+	redacted, _ := redactPath(rules, value, path)
+	return redacted
+}
+
+// Redacts the value at `path`.  Each step of the path carries its value and
+// array length, so filters and negative indexes can be evaluated.  A
+// whitelisted container is only passed through if a matching rule isn't
+// leaf-only; otherwise it's redacted like any other.  A rule that decodes its
+// value redacts the payload nested in it (see redactEncoded).  Returns false
+// if the value was dropped by its rule.
+func redactPath(rules []ConfigRule, value interface{}, path []pathStep) (interface{}, bool) {
+	if rule, ok := findPathWhitelistMatch(rules, path, isContainer(value)); ok {
+		switch rule.action() {
+		case ActionPass:
+			return value, true
+		case ActionDrop:
+			return nil, false
+		case actionDecode:
+			return redactEncoded(rules, rule.Decode, value, path), true
+		}
+
+		if replaced, ok := rule.replace(value); ok {
+			return replaced, true
+		}
+	}
+
+	return redactValue(rules, value, path), true
+}
+
+// Redacts a value that no rule decided on: containers are recursed into, and
+// everything else is redacted.
+func redactValue(rules []ConfigRule, value interface{}, path []pathStep) interface{} {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{})
+		for k, v := range typedValue {
+			step := pathStep{key: k, value: v, hasValue: true}
+			if redacted, ok := redactPath(rules, v, appendStep(path, step)); ok {
+				m[k] = redacted
+			}
+		}
+		return m
+	case []interface{}:
+		// Dropped elements are nulled, so their siblings keep their indexes.
+		m := make([]interface{}, len(typedValue))
+		for k, v := range typedValue {
+			step := pathStep{index: k, isIndex: true, length: len(typedValue), value: v, hasValue: true}
+			m[k], _ = redactPath(rules, v, appendStep(path, step))
+		}
+		return m
+	case float64:
+		return RedactedNumber
+	case string:
+		return RedactedStr
+	case bool:
+		return RedactedBool
+	default:
+		return nil
+	}
+}
+
+// Returns true iff a decoded value is an Object or Array.
+func isContainer(value interface{}) bool {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return true
+	}
+
+	return false
+}
+
+// MapBody maps a request body to a redacted version, preserving the "shape"
+// of the data.  The body is redacted by the handler of its content-type (see
+// contentHandler), which by default supports:
+//
+// * application/json, and types with a +json suffix
+// * application/x-ndjson
+// * application/json-seq, and types with a +json-seq suffix
+// * text/csv and text/tab-separated-values
+//
+// Each record of newline-delimited JSON or a JSON text sequence is redacted
+// as a document of its own (see RedactRecords), and CSV and TSV as an Array
+// of rows (see redactCSV).  Bodies in a charset other than UTF-8 are
+// converted to it.  If the content-type isn't supported, zero bytes are
+// returned.
+func MapBody(match HTTPMatch, contentType string, body []byte) ([]byte, error) {
+	return mapDocument(match.Body, match.contentTypes, contentType, body)
+}
+
+// Maps a document to a redacted version against a list of location
+// whitelist rules, using the handlers of the config's `content_types`.  See
+// MapBody.
+func mapDocument(rules []ConfigRule, types map[string]string, contentType string, body []byte) ([]byte, error) {
+	mediaType, params := parseMediaType(contentType)
+
+	handler := contentHandler(types, mediaType)
+	if handler == "" || handler == HandlerNone {
+		return []byte{}, nil
+	}
+
+	body, err := decodeCharset(params["charset"], body)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	// RFC 4180's header parameter says whether a CSV's first line names its
+	// columns.
+	header := !strings.EqualFold(params["header"], "absent")
+
+	switch handler {
+	case HandlerJSON:
+		return redactJSON(rules, body)
+	case HandlerCSV:
+		return redactCSV(rules, body, csvDelimiter, header)
+	case HandlerTSV:
+		return redactCSV(rules, body, tsvDelimiter, header)
+	}
+
+	var buffer bytes.Buffer
+	if err := redactRecords(rules, handler, bytes.NewReader(body), &buffer); err != nil {
+		return []byte{}, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// Redacts a JSON document against a list of location whitelist rules.
+func redactJSON(rules []ConfigRule, body []byte) ([]byte, error) {
+	var parsed interface{}
+	err := json.Unmarshal(body, &parsed)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	redacted := redact(rules, parsed, "$")
+
+	newBody, err := json.Marshal(redacted)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	return newBody, nil
+}
+
+// Returns true iff the header describes the request body.
+func isBodyHeader(name string) bool {
+	for _, h := range bodyHeaders {
+		if http.CanonicalHeaderKey(name) == h {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RedactHeader redacts the values of any headers that aren't whitelisted.
+// Header redaction is opt-in: if the match declares no `rule "header"`
+// clauses that whitelist a header, the headers are returned unchanged (other
+// than those holding JWTs) since most are needed to transport the request.
+// Content-Type and Content-Length are always passed through.  If the match
+// declares `rule "cookie"` clauses, cookies are filtered by those instead
+// (see RedactCookies).
+//
+// Returns a redacted copy of `header`, does not mutate.
+func RedactHeader(match HTTPMatch, header http.Header) http.Header {
+	if len(match.Cookie) == 0 {
+		return redactHeader(match.RuleOptions, header, isBodyHeader)
+	}
+
+	return redactHeader(match.RuleOptions, RedactCookies(match, header), func(name string) bool {
+		return isBodyHeader(name) || isCookieHeader(name)
+	})
+}
+
+// Redacts the values of any headers that aren't whitelisted by `rules` or
+// allowed by `passthrough`.  Headers matched by a `jwt` rule are redacted by
+// it, and ClaimsHeader is always removed.  See RedactHeader.
+func redactHeader(rules RuleOptions, header http.Header, passthrough func(string) bool) http.Header {
+	result := http.Header{}
+	optedIn := hasHeaderWhitelist(rules.Header)
+
+	for name, values := range header {
+		if http.CanonicalHeaderKey(name) == ClaimsHeader {
+			continue
+		}
+
+		rule, ok := findHeaderWhitelistMatch(rules.Header, name)
+
+		for _, v := range values {
+			if ok && rule.action() == ActionJWT {
+				rule.redactJWTHeader(result, name, v)
+				continue
+			}
+
+			value := RedactedStr
+			if !optedIn || passthrough(name) || ok {
+				value = v
+			}
+
+			result[name] = append(result[name], value)
+		}
+	}
+
+	return result
+}
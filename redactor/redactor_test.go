@@ -0,0 +1,719 @@
+package redactor
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeBodyMatch(rules ...ConfigRule) HTTPMatch {
+	return HTTPMatch{RuleOptions: RuleOptions{Body: rules}}
+}
+
+func makeQuerystringMatch(rules ...ConfigRule) HTTPMatch {
+	return HTTPMatch{RuleOptions: RuleOptions{Querystring: rules}}
+}
+
+func TestIsSamePath(t *testing.T) {
+	type testCase struct {
+		name string
+		a    string
+		b    string
+		out  bool
+	}
+
+	cases := []testCase{
+		{name: "with exact matches", a: "/v1", b: "/v1", out: true},
+		{name: "with trailing slashes", a: "/v1", b: "/v1/", out: true},
+		{name: "with trailing slashes", a: "/v1//", b: "/v1/", out: true},
+		{name: "with trailing slashes and different paths", a: "/v2", b: "/v1", out: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			match := isSamePath(c.a, c.b)
+			assert.Equal(t, match, c.out)
+		})
+	}
+}
+
+func TestIsSameCaseInsensitive(t *testing.T) {
+	t.Log("Running with equavalent strings")
+	isSame := isSameCaseInsensitive("aba", "aBa")
+	assert.True(t, isSame)
+
+	t.Log("Running with non-equavalent strings")
+	isNotSame := isSameCaseInsensitive("aca", "aBa")
+	assert.False(t, isNotSame)
+}
+
+func TestRedact(t *testing.T) {
+	leafOnly := true
+
+	type testCase struct {
+		name  string
+		match HTTPMatch
+		value interface{}
+		out   interface{}
+	}
+
+	cases := []testCase{
+		{
+			name:  "with a number",
+			match: makeBodyMatch(),
+			value: 10.0,
+			out:   0.0,
+		},
+		{
+			name:  "with nil",
+			match: makeBodyMatch(),
+			value: nil,
+			out:   nil,
+		},
+		{
+			name:  "with an unsupported value",
+			match: makeBodyMatch(),
+			value: 12,
+			out:   nil,
+		},
+		{
+			name:  "with a string",
+			match: makeBodyMatch(),
+			value: "data",
+			out:   "REDACTED",
+		},
+		{
+			name:  "with a boolean",
+			match: makeBodyMatch(),
+			value: true,
+			out:   false,
+		},
+		{
+			name:  "with a slice of values",
+			match: makeBodyMatch(),
+			value: []interface{}{"a", 20.0, true},
+			out:   []interface{}{"REDACTED", 0.0, false},
+		},
+		{
+			name:  "with a map of values",
+			match: makeBodyMatch(),
+			value: map[string]interface{}{"string": "data", "bool": true},
+			out:   map[string]interface{}{"string": "REDACTED", "bool": false},
+		},
+		{
+			name:  "with a map of values",
+			match: makeBodyMatch(),
+			value: map[string]interface{}{"string": "data", "bool": true},
+			out:   map[string]interface{}{"string": "REDACTED", "bool": false},
+		},
+		{
+			name:  "with a map of values that are themselves containers",
+			match: makeBodyMatch(),
+			value: map[string]interface{}{"array": []interface{}{"str1", "str2"}},
+			out:   map[string]interface{}{"array": []interface{}{"REDACTED", "REDACTED"}},
+		},
+		{
+			name:  "with a whitelist",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$.bleep"}, ConfigRule{Whitelist: "$.array[0]"}),
+			value: map[string]interface{}{"array": []interface{}{"str1", "str2"}},
+			out:   map[string]interface{}{"array": []interface{}{"str1", "REDACTED"}},
+		},
+		{
+			name:  "with a whitelist that matches two keys",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$.bleep"}, ConfigRule{Whitelist: "$.array[0]"}),
+			value: map[string]interface{}{"array": []interface{}{"str1", "str2"}, "bleep": "bloop"},
+			out:   map[string]interface{}{"array": []interface{}{"str1", "REDACTED"}, "bleep": "bloop"},
+		},
+		{
+			name:  "with a wildcard whitelist",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$.array[*]"}),
+			value: map[string]interface{}{"array": []interface{}{"str1", "str2"}},
+			out:   map[string]interface{}{"array": []interface{}{"str1", "str2"}},
+		},
+		{
+			name:  "with a recursive descent whitelist",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$..id"}),
+			value: map[string]interface{}{"id": "a", "user": map[string]interface{}{"id": "b", "name": "c"}},
+			out:   map[string]interface{}{"id": "a", "user": map[string]interface{}{"id": "b", "name": "REDACTED"}},
+		},
+		{
+			name:  "with a wildcard key whitelist",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$.users.*.id"}),
+			value: map[string]interface{}{"users": map[string]interface{}{"u1": map[string]interface{}{"id": "a", "name": "b"}}},
+			out:   map[string]interface{}{"users": map[string]interface{}{"u1": map[string]interface{}{"id": "a", "name": "REDACTED"}}},
+		},
+		{
+			name:  "with a whitelisted key containing a dot",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$['a.b']"}),
+			value: map[string]interface{}{"a.b": "data", "a": map[string]interface{}{"b": "data"}},
+			out:   map[string]interface{}{"a.b": "data", "a": map[string]interface{}{"b": "REDACTED"}},
+		},
+		{
+			name:  "with a negative index whitelist",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$.array[-1]"}),
+			value: map[string]interface{}{"array": []interface{}{"str1", "str2", "str3"}},
+			out:   map[string]interface{}{"array": []interface{}{"REDACTED", "REDACTED", "str3"}},
+		},
+		{
+			name:  "with a slice whitelist",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$.array[:-1]"}),
+			value: map[string]interface{}{"array": []interface{}{"str1", "str2", "str3"}},
+			out:   map[string]interface{}{"array": []interface{}{"str1", "str2", "REDACTED"}},
+		},
+		{
+			name:  "with a filter whitelist",
+			match: makeBodyMatch(ConfigRule{Whitelist: `$.events[?(@.type=="click")].target`}),
+			value: map[string]interface{}{"events": []interface{}{
+				map[string]interface{}{"type": "click", "target": "button"},
+				map[string]interface{}{"type": "input", "target": "email"},
+			}},
+			out: map[string]interface{}{"events": []interface{}{
+				map[string]interface{}{"type": "REDACTED", "target": "button"},
+				map[string]interface{}{"type": "REDACTED", "target": "REDACTED"},
+			}},
+		},
+		{
+			name:  "with a leaf-only whitelisted object",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$.user", LeafOnly: &leafOnly}, ConfigRule{Whitelist: "$.user.id"}),
+			value: map[string]interface{}{"user": map[string]interface{}{"id": "a", "email": "b"}},
+			out:   map[string]interface{}{"user": map[string]interface{}{"id": "a", "email": "REDACTED"}},
+		},
+		{
+			name:  "with a leaf-only whitelisted array",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$.array", LeafOnly: &leafOnly}),
+			value: map[string]interface{}{"array": []interface{}{"str1", 2.0}},
+			out:   map[string]interface{}{"array": []interface{}{"REDACTED", 0.0}},
+		},
+		{
+			name:  "with a leaf-only whitelisted leaf",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$.a", LeafOnly: &leafOnly}),
+			value: map[string]interface{}{"a": "data", "b": "data"},
+			out:   map[string]interface{}{"a": "data", "b": "REDACTED"},
+		},
+		{
+			name:  "with leaf-only and whole whitelists of the same object",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$.user", LeafOnly: &leafOnly}, ConfigRule{Whitelist: "$..user"}),
+			value: map[string]interface{}{"user": map[string]interface{}{"id": "a", "email": "b"}},
+			out:   map[string]interface{}{"user": map[string]interface{}{"id": "a", "email": "b"}},
+		},
+		{
+			name:  "with a literal action",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$.a", Action: "literal", Value: "N/A"}),
+			value: map[string]interface{}{"a": "data", "b": "data"},
+			out:   map[string]interface{}{"a": "N/A", "b": "REDACTED"},
+		},
+		{
+			name:  "with a null action",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$.a", Action: "null"}),
+			value: map[string]interface{}{"a": map[string]interface{}{"b": "data"}},
+			out:   map[string]interface{}{"a": nil},
+		},
+		{
+			name:  "with a drop action",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$..ssn", Action: "drop"}),
+			value: map[string]interface{}{"ssn": "data", "b": "data", "array": []interface{}{map[string]interface{}{"ssn": "data"}}},
+			out:   map[string]interface{}{"b": "REDACTED", "array": []interface{}{map[string]interface{}{}}},
+		},
+		{
+			name:  "with a drop action in an array",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$.array[0]", Action: "drop"}),
+			value: map[string]interface{}{"array": []interface{}{"str1", "str2"}},
+			out:   map[string]interface{}{"array": []interface{}{nil, "REDACTED"}},
+		},
+		{
+			name:  "with a mask action",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$.card", Action: "mask", Keep: 4}, ConfigRule{Whitelist: "$.cvv", Action: "mask"}),
+			value: map[string]interface{}{"card": "4111111111111234", "cvv": 123.0},
+			out:   map[string]interface{}{"card": "************1234", "cvv": 0.0},
+		},
+		{
+			name:  "with a fake action",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$.id", Action: "fake", Format: "uuid", hashKey: testHashKey}),
+			value: map[string]interface{}{"id": "u1"},
+			out:   map[string]interface{}{"id": fake(testHashKey, "u1", "uuid")},
+		},
+		{
+			name:  "with an action on a container",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$.user", Action: "mask"}, ConfigRule{Whitelist: "$.user.id"}),
+			value: map[string]interface{}{"user": map[string]interface{}{"id": "a", "email": "b"}},
+			out:   map[string]interface{}{"user": map[string]interface{}{"id": "a", "email": "REDACTED"}},
+		},
+		{
+			name: "with generalizations",
+			match: makeBodyMatch(
+				ConfigRule{Whitelist: "$.dob", Action: "truncate_date", To: "year"},
+				ConfigRule{Whitelist: "$.zip", Action: "truncate", Keep: 3},
+				ConfigRule{Whitelist: "$.ip", Action: "truncate_ip"},
+				ConfigRule{Whitelist: "$.location.*", Action: "round", Digits: 1},
+				ConfigRule{Whitelist: "$.age", Action: "bucket", Size: 10},
+			),
+			value: map[string]interface{}{
+				"dob":      "1987-06-05",
+				"zip":      "10001",
+				"ip":       "10.1.2.3",
+				"location": map[string]interface{}{"lat": 40.712776, "lng": -74.005974},
+				"age":      37.0,
+			},
+			out: map[string]interface{}{
+				"dob":      "1987-01-01",
+				"zip":      "100",
+				"ip":       "10.1.2.0",
+				"location": map[string]interface{}{"lat": 40.7, "lng": -74.0},
+				"age":      30.0,
+			},
+		},
+		{
+			name:  "with a generalization that doesn't apply",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$.dob", Action: "truncate_date", To: "year"}),
+			value: map[string]interface{}{"dob": "unknown"},
+			out:   map[string]interface{}{"dob": "REDACTED"},
+		},
+		{
+			name:  "with a number below the bucket bounds",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$.age", Action: "bucket", Bounds: []float64{18, 65}}),
+			value: map[string]interface{}{"age": 5.0},
+			out:   map[string]interface{}{"age": 0.0},
+		},
+		{
+			name:  "with a value pattern",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$.*", Pattern: "^[a-z]+$"}),
+			value: map[string]interface{}{"a": "data", "b": "diggy@net.cool", "c": 1.0, "d": map[string]interface{}{"e": "data"}},
+			out:   map[string]interface{}{"a": "data", "b": "REDACTED", "c": 0.0, "d": map[string]interface{}{"e": "REDACTED"}},
+		},
+		{
+			name:  "with the first matching rule deciding",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$.a", Action: "null"}, ConfigRule{Whitelist: "$.*"}),
+			value: map[string]interface{}{"a": "data", "b": "data"},
+			out:   map[string]interface{}{"a": nil, "b": "data"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			value := Redact(c.match, c.value, "$")
+			assert.Equal(t, c.out, value)
+		})
+	}
+
+	t.Log("Running with an invalid prefix")
+	assert.Equal(t, "REDACTED", Redact(makeBodyMatch(ConfigRule{Whitelist: "$"}), "data", "$.a["))
+}
+
+func TestMapBody(t *testing.T) {
+	type testCase struct {
+		name  string
+		match HTTPMatch
+		body  string
+		out   string
+	}
+
+	cases := []testCase{
+		{
+			name:  "with a basic body",
+			match: makeBodyMatch(),
+			body:  `{"a": "bloop"}`,
+			out:   `{"a":"REDACTED"}`,
+		},
+		{
+			name:  "with a basic body and a whitelist",
+			match: makeBodyMatch(ConfigRule{Whitelist: "$.a"}),
+			body:  `{"a": "bloop", "b": [true, "hey"]}`,
+			out:   `{"a":"bloop","b":[false,"REDACTED"]}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result, err := MapBody(c.match, "application/json", []byte(c.body))
+			if err != nil {
+				t.Fail()
+			}
+			assert.Equal(t, string(result[:]), c.out)
+		})
+	}
+}
+
+func TestMapBodyWithWrongContentType(t *testing.T) {
+	body := []byte("{ query: { id } }")
+	result, err := MapBody(HTTPMatch{}, "application/graphql", body)
+	if err != nil {
+		t.Fail()
+	}
+	assert.Equal(t, result, []byte{})
+}
+
+func TestRedactQuerystring(t *testing.T) {
+	type testCase struct {
+		name  string
+		match HTTPMatch
+		in    url.URL
+		out   string
+	}
+
+	cases := []testCase{
+		{
+			name:  "with empty query",
+			match: HTTPMatch{},
+			in:    url.URL{RawQuery: ""},
+			out:   "",
+		},
+		{
+			name:  "with a query with no whitelist",
+			match: HTTPMatch{},
+			in:    url.URL{RawQuery: "a=2&b=3"},
+			out:   "a=REDACTED&b=REDACTED",
+		},
+		{
+			name:  "with a query with a single whitelist value",
+			match: makeQuerystringMatch(ConfigRule{Whitelist: "a"}),
+			in:    url.URL{RawQuery: "a=2&b=3"},
+			out:   "a=2&b=REDACTED",
+		},
+		{
+			name:  "with a query with many whitelist values",
+			match: makeQuerystringMatch(ConfigRule{Whitelist: "a"}, ConfigRule{Whitelist: "b"}),
+			in:    url.URL{RawQuery: "a=2&b=3&c=2"},
+			out:   "a=2&b=3&c=REDACTED",
+		},
+		{
+			name:  "with a location whitelist",
+			match: makeQuerystringMatch(ConfigRule{Whitelist: "$.a"}),
+			in:    url.URL{RawQuery: "a=2&b=3"},
+			out:   "a=2&b=REDACTED",
+		},
+		{
+			name:  "with a nested key whitelist",
+			match: makeQuerystringMatch(ConfigRule{Whitelist: "$.filter.user.id"}),
+			in:    url.URL{RawQuery: "filter[user][id]=1&filter[user][email]=a"},
+			out:   "filter[user][id]=1&filter[user][email]=REDACTED",
+		},
+		{
+			name:  "with a parent key whitelist",
+			match: makeQuerystringMatch(ConfigRule{Whitelist: "$.filter"}),
+			in:    url.URL{RawQuery: "filter[user][id]=1&page=2"},
+			out:   "filter[user][id]=1&page=REDACTED",
+		},
+		{
+			name:  "with an array index whitelist",
+			match: makeQuerystringMatch(ConfigRule{Whitelist: "$.items[-1]"}),
+			in:    url.URL{RawQuery: "items[]=a&items[]=b&items[]=c"},
+			out:   "items[]=REDACTED&items[]=REDACTED&items[]=c",
+		},
+		{
+			name:  "with a glob whitelist",
+			match: makeQuerystringMatch(ConfigRule{Whitelist: "utm_*"}),
+			in:    url.URL{RawQuery: "utm_source=a&utm_medium=b&email=c"},
+			out:   "utm_source=a&utm_medium=b&email=REDACTED",
+		},
+		{
+			name:  "with a value pattern",
+			match: makeQuerystringMatch(ConfigRule{Whitelist: "page", Pattern: "^[0-9]+$"}),
+			in:    url.URL{RawQuery: "page=2&page=diggy@net.cool"},
+			out:   "page=2&page=REDACTED",
+		},
+		{
+			name:  "with an action",
+			match: makeQuerystringMatch(ConfigRule{Whitelist: "ip", Action: "truncate_ip"}, ConfigRule{Whitelist: "email", Action: "drop"}),
+			in:    url.URL{RawQuery: "ip=10.1.2.3&email=a"},
+			out:   "ip=10.1.2.0",
+		},
+		{
+			name:  "with the original order and encoding",
+			match: makeQuerystringMatch(ConfigRule{Whitelist: "q"}),
+			in:    url.URL{RawQuery: "z=1&q=a+b%21&flag&a=x"},
+			out:   "z=REDACTED&q=a+b%21&flag=REDACTED&a=REDACTED",
+		},
+		{
+			name:  "with an undecodable parameter",
+			match: makeQuerystringMatch(ConfigRule{Whitelist: "a"}),
+			in:    url.URL{RawQuery: "a=1&b=%zz"},
+			out:   "a=1",
+		},
+		{
+			name:  "with the drop policy",
+			match: HTTPMatch{QuerystringPolicy: "drop", RuleOptions: RuleOptions{Querystring: []ConfigRule{{Whitelist: "b"}}}},
+			in:    url.URL{RawQuery: "a=1&b=2&c=3"},
+			out:   "b=2",
+		},
+		{
+			name:  "with the hash policy",
+			match: HTTPMatch{QuerystringPolicy: "hash", hashKey: testHashKey},
+			in:    url.URL{RawQuery: "email=diggy%40net.cool"},
+			out:   "email=" + hashValue(testHashKey, "diggy@net.cool"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result := RedactQuerystring(c.match, &c.in)
+			assert.Equal(t, result, c.out)
+		})
+	}
+}
+
+func TestRedactHeader(t *testing.T) {
+	makeHeaderMatch := func(rules ...ConfigRule) HTTPMatch {
+		return HTTPMatch{RuleOptions: RuleOptions{Header: rules}}
+	}
+
+	header := http.Header{
+		"Authorization": []string{"Bearer secret"},
+		"Content-Type":  []string{"application/json"},
+		"User-Agent":    []string{"curl"},
+		"X-Forwarded":   []string{"a", "b"},
+	}
+
+	type testCase struct {
+		name  string
+		match HTTPMatch
+		out   http.Header
+	}
+
+	cases := []testCase{
+		{
+			name:  "with no header rules",
+			match: makeHeaderMatch(),
+			out:   header,
+		},
+		{
+			name:  "with a header whitelist",
+			match: makeHeaderMatch(ConfigRule{Whitelist: "user-agent"}),
+			out: http.Header{
+				"Authorization": []string{"REDACTED"},
+				"Content-Type":  []string{"application/json"},
+				"User-Agent":    []string{"curl"},
+				"X-Forwarded":   []string{"REDACTED", "REDACTED"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result := RedactHeader(c.match, header)
+			assert.Equal(t, c.out, result)
+		})
+	}
+
+	assert.Equal(t, "Bearer secret", header.Get("Authorization"))
+}
+
+func TestCompile(t *testing.T) {
+	t.Log("Running with a valid config")
+	config := Config{Match: MatchOptions{HTTP: []HTTPMatch{
+		HTTPMatch{
+			Path:   "/v1",
+			Method: "POST",
+			RuleOptions: RuleOptions{
+				Body:        []ConfigRule{ConfigRule{Whitelist: "$.a"}},
+				Querystring: []ConfigRule{ConfigRule{Whitelist: "a"}},
+			},
+		},
+	}}}
+
+	redactor, err := Compile(config)
+	assert.Nil(t, err)
+
+	body, err := redactor.Body("POST", "/v1", JSON, []byte(`{"a": 1, "b": 2}`))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a":1,"b":0}`, string(body))
+	assert.Equal(t, "a=1&b=REDACTED", redactor.Querystring("POST", "/v1", "a=1&b=2"))
+	assert.Equal(t, "a=REDACTED", redactor.Querystring("GET", "/v1", "a=1"))
+
+	t.Log("Running with leaf-only rules by default")
+	notLeafOnly := false
+	config.LeafOnly = true
+	config.Match.HTTP[0].Body = []ConfigRule{ConfigRule{Whitelist: "$.a"}, ConfigRule{Whitelist: "$.b", LeafOnly: &notLeafOnly}}
+	redactor, err = Compile(config)
+	assert.Nil(t, err)
+
+	body, err = redactor.Body("POST", "/v1", JSON, []byte(`{"a": {"c": 1}, "b": {"c": 2}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a":{"c":0},"b":{"c":2}}`, string(body))
+	assert.Nil(t, config.Match.HTTP[0].Body[0].LeafOnly)
+	config.LeafOnly = false
+
+	t.Log("Running with an invalid whitelist")
+	config.Match.HTTP[0].Body = []ConfigRule{ConfigRule{Whitelist: "$.a("}}
+	_, err = Compile(config)
+	assert.NotNil(t, err)
+
+	t.Log("Running with a tokenize action")
+	config.Match.HTTP[0].Body = []ConfigRule{ConfigRule{Whitelist: "$.a", Action: "tokenize"}}
+	_, err = Compile(config)
+	assert.NotNil(t, err)
+
+	options := makeVaultOptions(t)
+	config.Vault = &options
+	redactor, err = Compile(config)
+	assert.Nil(t, err)
+
+	body, err = redactor.Body("POST", "/v1", JSON, []byte(`{"a": "diggy@net.cool", "b": "data"}`))
+	assert.Nil(t, err)
+
+	parsed := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(body, &parsed))
+	assert.Equal(t, "REDACTED", parsed["b"])
+
+	vault, err := OpenVault(options)
+	assert.Nil(t, err)
+	value, err := vault.Detokenize(parsed["a"].(string))
+	assert.Nil(t, err)
+	assert.Equal(t, "diggy@net.cool", value)
+	config.Vault = nil
+
+	t.Log("Running with an encrypt action")
+	config.Match.HTTP[0].Body = []ConfigRule{ConfigRule{Whitelist: "$.a", Action: "encrypt"}}
+	_, err = Compile(config)
+	assert.NotNil(t, err)
+
+	keyringFile := filepath.Join(t.TempDir(), "keyring")
+	assert.Nil(t, ioutil.WriteFile(keyringFile, []byte(testKeyring), 0600))
+	config.Keyring = keyringFile
+	redactor, err = Compile(config)
+	assert.Nil(t, err)
+
+	body, err = redactor.Body("POST", "/v1", JSON, []byte(`{"a": {"c": 1}, "b": 2}`))
+	assert.Nil(t, err)
+
+	parsed = map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(body, &parsed))
+	assert.Equal(t, 0.0, parsed["b"])
+
+	keyring, err := LoadKeyring(keyringFile)
+	assert.Nil(t, err)
+	decrypted, err := keyring.Decrypt(parsed["a"].(string))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"c": 1.0}, decrypted)
+	config.Keyring = ""
+
+	t.Log("Running with a fake action")
+	config.Match.HTTP[0].Body = []ConfigRule{ConfigRule{Whitelist: "$.a", Action: "fake", Format: "email"}}
+	_, err = Compile(config)
+	assert.NotNil(t, err)
+
+	hashKeyFile := filepath.Join(t.TempDir(), "hash.key")
+	assert.Nil(t, ioutil.WriteFile(hashKeyFile, []byte(hex.EncodeToString(testHashKey)), 0600))
+	config.HashKey = hashKeyFile
+	redactor, err = Compile(config)
+	assert.Nil(t, err)
+
+	body, err = redactor.Body("POST", "/v1", JSON, []byte(`{"a": "diggy@net.cool"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a":"`+fake(testHashKey, "diggy@net.cool", FakeEmail)+`"}`, string(body))
+	config.HashKey = ""
+
+	t.Log("Running with an invalid pattern")
+	config.Match.HTTP[0].Body = []ConfigRule{ConfigRule{Whitelist: "$.a", Pattern: "("}}
+	_, err = Compile(config)
+	assert.NotNil(t, err)
+
+	t.Log("Running with an invalid querystring location")
+	config.Match.HTTP[0].Body = nil
+	config.Match.HTTP[0].Querystring = []ConfigRule{ConfigRule{Whitelist: "$.a("}}
+	_, err = Compile(config)
+	assert.NotNil(t, err)
+
+	t.Log("Running with an invalid querystring policy")
+	config.Match.HTTP[0].Querystring = nil
+	config.Match.HTTP[0].QuerystringPolicy = "encrypt"
+	_, err = Compile(config)
+	assert.NotNil(t, err)
+	config.Match.HTTP[0].QuerystringPolicy = ""
+
+	t.Log("Running with a hash querystring policy")
+	config.Match.HTTP[0].QuerystringPolicy = "hash"
+	_, err = Compile(config)
+	assert.NotNil(t, err)
+
+	config.HashKey = hashKeyFile
+	redactor, err = Compile(config)
+	assert.Nil(t, err)
+	assert.Equal(t, "a="+hashValue(testHashKey, "1"), redactor.Querystring("POST", "/v1", "a=1"))
+	config.Match.HTTP[0].QuerystringPolicy = ""
+	config.HashKey = ""
+
+	t.Log("Running with a path template")
+	config.Match.HTTP = append(config.Match.HTTP, HTTPMatch{
+		Path:        "/users/{id}/orders/{order}",
+		RuleOptions: RuleOptions{PathRules: []ConfigRule{ConfigRule{Whitelist: "order"}}},
+	})
+	redactor, err = Compile(config)
+	assert.Nil(t, err)
+	assert.Equal(t, "/users/REDACTED/orders/42", redactor.Path("GET", "/users/diggy@net.cool/orders/42"))
+	assert.Equal(t, "/v1", redactor.Path("POST", "/v1"))
+
+	config.Match.HTTP[1].PathPolicy = "hash"
+	_, err = Compile(config)
+	assert.NotNil(t, err)
+
+	config.HashKey = hashKeyFile
+	redactor, err = Compile(config)
+	assert.Nil(t, err)
+	assert.Equal(t, "/users/"+hashValue(testHashKey, "diggy@net.cool")+"/orders/42", redactor.Path("GET", "/users/diggy@net.cool/orders/42"))
+	config.Match.HTTP[1].PathPolicy = ""
+	config.HashKey = ""
+
+	config.Match.HTTP[1].PathRules = []ConfigRule{ConfigRule{Whitelist: "order", Action: "drop"}}
+	_, err = Compile(config)
+	assert.NotNil(t, err)
+
+	config.Match.HTTP[1].PathRules = nil
+	config.Match.HTTP[1].Path = "/users/{id}/{id}"
+	_, err = Compile(config)
+	assert.NotNil(t, err)
+	config.Match.HTTP = config.Match.HTTP[:1]
+
+	t.Log("Running with an invalid cookie pattern")
+	config.Match.HTTP[0].Cookie = []ConfigRule{ConfigRule{Whitelist: "session", Pattern: "("}}
+	_, err = Compile(config)
+	assert.NotNil(t, err)
+	config.Match.HTTP[0].Cookie = nil
+
+	t.Log("Running with an invalid content type handler")
+	config.ContentTypes = map[string]string{"application/x-amz-json-1.1": "xml"}
+	_, err = Compile(config)
+	assert.NotNil(t, err)
+	config.ContentTypes = nil
+
+	t.Log("Running with an invalid action")
+	config.Match.HTTP[0].Body = []ConfigRule{ConfigRule{Whitelist: "$.a", Action: "fake"}}
+	_, err = Compile(config)
+	assert.NotNil(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	config := Config{Match: MatchOptions{HTTP: []HTTPMatch{
+		HTTPMatch{
+			RuleOptions: RuleOptions{
+				Body: []ConfigRule{
+					ConfigRule{Whitelist: "$.a", Action: "tokenize"},
+					ConfigRule{Whitelist: "$.b", Action: "encrypt"},
+					ConfigRule{Whitelist: "$.c", Action: "fake", Format: "uuid"},
+					ConfigRule{Whitelist: "$.d", Action: "jwt", Claims: []string{"$.sub"}},
+				},
+			},
+		},
+	}}}
+
+	_, err := Compile(config)
+	assert.NotNil(t, err)
+	assert.Nil(t, Validate(config))
+
+	t.Log("Running with a vault that would be created")
+	vaultPath := filepath.Join(t.TempDir(), "vault.db")
+	config.Vault = &VaultOptions{Path: vaultPath, KeyFile: "missing.key"}
+	assert.Nil(t, Validate(config))
+	_, err = os.Stat(vaultPath)
+	assert.True(t, os.IsNotExist(err))
+
+	t.Log("Running with an invalid whitelist")
+	config.Match.HTTP[0].Body = []ConfigRule{ConfigRule{Whitelist: "$.a("}}
+	assert.NotNil(t, Validate(config))
+}
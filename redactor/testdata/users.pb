@@ -0,0 +1,31 @@
+
+
+users.prototest"
+User
+
+id (	
+email (	
+age (
+tags (	
+address (2.test.Address.
+
+attributes (2.test.User.AttributesEntry
+scores (
+active (
+balance	 (1
+AttributesEntry
+key (	
+value (	:8"'
+Address
+city (	
+street (	"A
+CreateUsersResponse
+created (
+users (2
+.test.User2b
+Users!
+GetUser
+.test.User
+.test.User6
+CreateUsers
+.test.User.test.CreateUsersResponse(bproto3
\ No newline at end of file
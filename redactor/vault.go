@@ -0,0 +1,299 @@
+package redactor
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// The prefix of tokens issued by a vault, so they're recognizable as such.
+const tokenPrefix = "tok_"
+
+// ErrUnknownToken is returned by Detokenize for tokens the vault never issued.
+var ErrUnknownToken = errors.New("vault: unknown token")
+
+// Vault stores the values replaced by `tokenize` rules, so they can be
+// recovered later from their tokens.  Tokenizing the same value twice returns
+// the same token.  A Vault must be safe for concurrent use.
+type Vault interface {
+	Tokenize(value string) (string, error)
+	Detokenize(token string) (string, error)
+}
+
+// VaultOpener opens a vault from the `vault` block of a config.
+type VaultOpener func(options VaultOptions) (Vault, error)
+
+var (
+	vaultOpeners = map[string]VaultOpener{"file": openFileVault}
+
+	// Open vaults, keyed by their options, so that recompiling a config
+	// reuses its vault rather than opening the same store twice.
+	openVaults   = map[VaultOptions]Vault{}
+	openVaultsMu sync.Mutex
+)
+
+// RegisterVault makes a type of vault available to configs as `type = kind`.
+// It's not safe to call concurrently with OpenVault.
+func RegisterVault(kind string, opener VaultOpener) {
+	vaultOpeners[kind] = opener
+}
+
+// OpenVault opens the vault described by a `vault` block, or returns it if
+// it's already open.  Type defaults to "file".
+func OpenVault(options VaultOptions) (Vault, error) {
+	openVaultsMu.Lock()
+	defer openVaultsMu.Unlock()
+
+	if vault, ok := openVaults[options]; ok {
+		return vault, nil
+	}
+
+	kind := options.Type
+	if kind == "" {
+		kind = "file"
+	}
+
+	opener, ok := vaultOpeners[kind]
+	if !ok {
+		return nil, fmt.Errorf("vault: unknown type %q", kind)
+	}
+
+	vault, err := opener(options)
+	if err != nil {
+		return nil, err
+	}
+
+	openVaults[options] = vault
+	return vault, nil
+}
+
+// A record in a file vault.
+type vaultRecord struct {
+	Token string `json:"token"`
+	Value string `json:"value"`
+}
+
+// A vault stored in a local file, encrypted with AES-GCM.  The file is
+// append-only: each line is a base64 encoded nonce and sealed record, so
+// tokenizing a new value only writes that value.  The whole vault is held in
+// memory once opened.
+type fileVault struct {
+	mu     sync.Mutex
+	file   *os.File
+	aead   cipher.AEAD
+	values map[string]string
+	tokens map[string]string
+}
+
+// Opens the vault at `options.Path` with the key in `options.KeyFile`,
+// creating it if it doesn't exist.  The key file holds a hex encoded 256-bit
+// key, as generated by `openssl rand -hex 32`.
+func openFileVault(options VaultOptions) (Vault, error) {
+	if options.Path == "" || options.KeyFile == "" {
+		return nil, fmt.Errorf("vault: a file vault needs a path and key_file")
+	}
+
+	key, err := loadVaultKey(options.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(options.Path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &fileVault{file: file, aead: aead, values: map[string]string{}, tokens: map[string]string{}}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		record, err := v.open(scanner.Text())
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("vault: %s: %v", options.Path, err)
+		}
+
+		v.values[record.Token] = record.Value
+		v.tokens[record.Value] = record.Token
+	}
+
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// Reads a hex encoded 256-bit key from a file.
+func loadVaultKey(file string) ([]byte, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("vault: %s must hold a hex encoded 256-bit key", file)
+	}
+
+	return key, nil
+}
+
+func (v *fileVault) Tokenize(value string) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if token, ok := v.tokens[value]; ok {
+		return token, nil
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	line, err := v.seal(vaultRecord{Token: token, Value: value})
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := v.file.WriteString(line + "\n"); err != nil {
+		return "", err
+	}
+
+	if err := v.file.Sync(); err != nil {
+		return "", err
+	}
+
+	v.values[token] = value
+	v.tokens[value] = token
+
+	return token, nil
+}
+
+func (v *fileVault) Detokenize(token string) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	value, ok := v.values[token]
+	if !ok {
+		return "", ErrUnknownToken
+	}
+
+	return value, nil
+}
+
+// Returns a new random token.
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return tokenPrefix + hex.EncodeToString(b), nil
+}
+
+// NewMemoryVault returns a vault held only in memory, whose values are lost
+// with it.  It's for redacting samples, as the admin API previews, without
+// storing their values.
+func NewMemoryVault() Vault {
+	return &memoryVault{values: map[string]string{}, tokens: map[string]string{}}
+}
+
+// A vault held in memory.  See NewMemoryVault.
+type memoryVault struct {
+	mu     sync.Mutex
+	values map[string]string
+	tokens map[string]string
+}
+
+func (v *memoryVault) Tokenize(value string) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if token, ok := v.tokens[value]; ok {
+		return token, nil
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	v.values[token] = value
+	v.tokens[value] = token
+
+	return token, nil
+}
+
+func (v *memoryVault) Detokenize(token string) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	value, ok := v.values[token]
+	if !ok {
+		return "", ErrUnknownToken
+	}
+
+	return value, nil
+}
+
+// Encrypts a record as a line of the vault file.
+func (v *fileVault) seal(record vaultRecord) (string, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(v.aead.Seal(nonce, nonce, data, nil)), nil
+}
+
+// Decrypts a line of the vault file.
+func (v *fileVault) open(line string) (vaultRecord, error) {
+	record := vaultRecord{}
+
+	data, err := base64.StdEncoding.DecodeString(line)
+	if err != nil {
+		return record, err
+	}
+
+	if len(data) < v.aead.NonceSize() {
+		return record, fmt.Errorf("truncated record")
+	}
+
+	nonce, sealed := data[:v.aead.NonceSize()], data[v.aead.NonceSize():]
+	plain, err := v.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return record, fmt.Errorf("can't decrypt record, is the key right?")
+	}
+
+	err = json.Unmarshal(plain, &record)
+	return record, err
+}
@@ -0,0 +1,164 @@
+package redactor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testVaultKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+// Returns the options of a file vault in a temporary directory.
+func makeVaultOptions(t *testing.T) VaultOptions {
+	dir := t.TempDir()
+
+	keyFile := filepath.Join(dir, "vault.key")
+	err := ioutil.WriteFile(keyFile, []byte(testVaultKey+"\n"), 0600)
+	assert.Nil(t, err)
+
+	return VaultOptions{Path: filepath.Join(dir, "vault.db"), KeyFile: keyFile}
+}
+
+func TestFileVault(t *testing.T) {
+	options := makeVaultOptions(t)
+
+	vault, err := openFileVault(options)
+	assert.Nil(t, err)
+
+	t.Log("Running with a new value")
+	token, err := vault.Tokenize("diggy@net.cool")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(token, "tok_"))
+
+	value, err := vault.Detokenize(token)
+	assert.Nil(t, err)
+	assert.Equal(t, "diggy@net.cool", value)
+
+	t.Log("Running with a value that was already tokenized")
+	again, err := vault.Tokenize("diggy@net.cool")
+	assert.Nil(t, err)
+	assert.Equal(t, token, again)
+
+	other, err := vault.Tokenize("other@net.cool")
+	assert.Nil(t, err)
+	assert.NotEqual(t, token, other)
+
+	t.Log("Running with an unknown token")
+	_, err = vault.Detokenize("tok_unknown")
+	assert.Equal(t, ErrUnknownToken, err)
+
+	t.Log("Running with the file encrypted")
+	data, err := ioutil.ReadFile(options.Path)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "diggy")
+
+	t.Log("Running with the vault reopened")
+	reopened, err := openFileVault(options)
+	assert.Nil(t, err)
+
+	value, err = reopened.Detokenize(token)
+	assert.Nil(t, err)
+	assert.Equal(t, "diggy@net.cool", value)
+
+	again, err = reopened.Tokenize("diggy@net.cool")
+	assert.Nil(t, err)
+	assert.Equal(t, token, again)
+
+	t.Log("Running with the wrong key")
+	err = ioutil.WriteFile(options.KeyFile, []byte(strings.Repeat("ff", 32)), 0600)
+	assert.Nil(t, err)
+	_, err = openFileVault(options)
+	assert.NotNil(t, err)
+
+	t.Log("Running with an invalid key")
+	err = ioutil.WriteFile(options.KeyFile, []byte("short"), 0600)
+	assert.Nil(t, err)
+	_, err = openFileVault(options)
+	assert.NotNil(t, err)
+
+	t.Log("Running with no path")
+	_, err = openFileVault(VaultOptions{KeyFile: options.KeyFile})
+	assert.NotNil(t, err)
+}
+
+func TestMemoryVault(t *testing.T) {
+	vault := NewMemoryVault()
+
+	token, err := vault.Tokenize("diggy@net.cool")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(token, "tok_"))
+
+	again, err := vault.Tokenize("diggy@net.cool")
+	assert.Nil(t, err)
+	assert.Equal(t, token, again)
+
+	value, err := vault.Detokenize(token)
+	assert.Nil(t, err)
+	assert.Equal(t, "diggy@net.cool", value)
+
+	_, err = vault.Detokenize("tok_unknown")
+	assert.Equal(t, ErrUnknownToken, err)
+}
+
+func TestHTTPMatchWithVault(t *testing.T) {
+	options := makeVaultOptions(t)
+	redactor, err := Compile(Config{
+		Vault: &options,
+		Match: MatchOptions{HTTP: []HTTPMatch{
+			HTTPMatch{RuleOptions: RuleOptions{
+				Body:        []ConfigRule{ConfigRule{Whitelist: "$.email", Action: "tokenize"}},
+				Querystring: []ConfigRule{ConfigRule{Whitelist: "email", Action: "tokenize"}},
+			}},
+		}},
+	})
+	assert.Nil(t, err)
+
+	vault := NewMemoryVault()
+	match := redactor.Config().FindHTTPMatch("POST", "/").WithVault(vault)
+
+	body, err := MapBody(match, JSON, []byte(`{"email": "diggy@net.cool"}`))
+	assert.Nil(t, err)
+
+	document := map[string]string{}
+	assert.Nil(t, json.Unmarshal(body, &document))
+	value, err := vault.Detokenize(document["email"])
+	assert.Nil(t, err)
+	assert.Equal(t, "diggy@net.cool", value)
+
+	token, ok := match.Querystring[0].replace("diggy@net.cool")
+	assert.True(t, ok)
+	assert.Equal(t, document["email"], token)
+
+	data, err := ioutil.ReadFile(options.Path)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(data))
+}
+
+func TestOpenVault(t *testing.T) {
+	options := makeVaultOptions(t)
+
+	t.Log("Running with the same options twice")
+	a, err := OpenVault(options)
+	assert.Nil(t, err)
+	b, err := OpenVault(options)
+	assert.Nil(t, err)
+	assert.True(t, a == b)
+
+	t.Log("Running with an unknown type")
+	_, err = OpenVault(VaultOptions{Type: "bolt"})
+	assert.NotNil(t, err)
+
+	t.Log("Running with a registered type")
+	RegisterVault("memory", func(options VaultOptions) (Vault, error) {
+		return a, nil
+	})
+	defer delete(vaultOpeners, "memory")
+
+	c, err := OpenVault(VaultOptions{Type: "memory"})
+	assert.Nil(t, err)
+	assert.True(t, a == c)
+}